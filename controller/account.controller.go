@@ -0,0 +1,244 @@
+package controller
+
+import (
+	"fmt"
+	"go-be/database"
+	"go-be/models"
+	"go-be/utils"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Struct Input DTO
+
+// EmailTokenInput adalah token dari tautan email verifikasi.
+type EmailTokenInput struct {
+	Token string `json:"token" binding:"required"`
+}
+
+// ForgotPasswordInput adalah email akun yang lupa password.
+type ForgotPasswordInput struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+// ResetPasswordInput adalah token dari email reset beserta password baru.
+type ResetPasswordInput struct {
+	Token    string `json:"token" binding:"required"`
+	Password string `json:"password" binding:"required,min=8,max=72"`
+}
+
+// Helper Functions
+
+// emailVerifyTTL adalah masa berlaku tautan verifikasi email (EMAIL_VERIFY_TTL_HOURS, default 48 jam).
+func emailVerifyTTL() time.Duration {
+	return time.Duration(utils.EnvUint("EMAIL_VERIFY_TTL_HOURS", 48)) * time.Hour
+}
+
+// passwordResetTTL adalah masa berlaku tautan reset password (PASSWORD_RESET_TTL_MINUTES, default 30 menit).
+func passwordResetTTL() time.Duration {
+	return time.Duration(utils.EnvUint("PASSWORD_RESET_TTL_MINUTES", 30)) * time.Minute
+}
+
+// frontendLink membuat tautan ke halaman frontend (FRONTEND_URL), dengan token di query string jika ada.
+func frontendLink(path, token string) string {
+	base := os.Getenv("FRONTEND_URL")
+	if base == "" {
+		base = "http://localhost:3000"
+	}
+	if token == "" {
+		return base + path
+	}
+	return fmt.Sprintf("%s%s?token=%s", base, path, url.QueryEscape(token))
+}
+
+// emailBind mengambil email user saat ini; token verifikasi hanya berlaku untuk email yang sama.
+func emailBind(userID uint) (string, error) {
+	var user models.User
+	if err := database.DB.Select("id", "email").First(&user, userID).Error; err != nil {
+		return "", err
+	}
+	return user.Email, nil
+}
+
+// passwordBind mengambil hash password user saat ini; token reset otomatis hangus setelah password berubah.
+func passwordBind(userID uint) (string, error) {
+	var user models.User
+	if err := database.DB.Select("id", "password").First(&user, userID).Error; err != nil {
+		return "", err
+	}
+	return user.Password, nil
+}
+
+// allowEmailRequest membatasi email verifikasi/reset per alamat email agar kotak masuk orang lain tidak dibanjiri.
+func allowEmailRequest(name, email string) bool {
+	allowed, _, err := utils.AllowRequest(name+":email:"+email, utils.EnvUint("EMAIL_REQUEST_LIMIT_PER_HOUR", 3), time.Hour)
+	if err != nil {
+		log.Printf("Warning: Rate limit %s tidak aktif, Redis error: %v", name, err)
+	}
+	return allowed
+}
+
+// sendVerificationEmail mengirim tautan verifikasi ke email user.
+func sendVerificationEmail(user models.User) error {
+	token, err := utils.GenerateActionToken(utils.PurposeVerifyEmail, user.ID, user.Email, emailVerifyTTL())
+	if err != nil {
+		return err
+	}
+	return utils.SendMail(utils.Mail{
+		To:      user.Email,
+		Subject: "Verifikasi email Anda",
+		Body: fmt.Sprintf("Halo %s,\n\nKlik tautan berikut untuk memverifikasi email Anda:\n%s\n\nTautan berlaku %d jam. Abaikan email ini jika Anda tidak mendaftar.\n",
+			user.Name, frontendLink("/verify-email", token), int(emailVerifyTTL().Hours())),
+	})
+}
+
+// sendPasswordResetEmail mengirim tautan reset password ke email user.
+func sendPasswordResetEmail(user models.User) error {
+	token, err := utils.GenerateActionToken(utils.PurposeResetPassword, user.ID, user.Password, passwordResetTTL())
+	if err != nil {
+		return err
+	}
+	return utils.SendMail(utils.Mail{
+		To:      user.Email,
+		Subject: "Reset password",
+		Body: fmt.Sprintf("Halo %s,\n\nKami menerima permintaan reset password akun Anda. Klik tautan berikut untuk membuat password baru:\n%s\n\nTautan berlaku %d menit dan hanya bisa dipakai sekali. Abaikan email ini jika Anda tidak memintanya.\n",
+			user.Name, frontendLink("/reset-password", token), int(passwordResetTTL().Minutes())),
+	})
+}
+
+// sendAccountLockedEmail memberi tahu user bahwa akunnya dikunci sementara karena terlalu banyak percobaan login gagal.
+func sendAccountLockedEmail(user models.User, ip string) error {
+	return utils.SendMail(utils.Mail{
+		To:      user.Email,
+		Subject: "Akun Anda dikunci sementara",
+		Body: fmt.Sprintf("Halo %s,\n\nAda terlalu banyak percobaan login gagal ke akun Anda (terakhir dari IP %s), sehingga login dikunci selama %d menit.\n\nJika itu bukan Anda, segera ganti password lewat menu lupa password:\n%s\n",
+			user.Name, ip, int(utils.LoginLockoutDuration().Minutes()), frontendLink("/forgot-password", "")),
+	})
+}
+
+// Controller Handlers
+
+// VerifyEmail menandai email user sebagai terverifikasi dari token tautan email.
+// Route: POST /verify-email
+func VerifyEmail(c *gin.Context) {
+	var input EmailTokenInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Input tidak valid", "details": err.Error()})
+		return
+	}
+
+	userID, err := utils.ReverseActionToken(input.Token, utils.PurposeVerifyEmail, emailBind)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Tautan verifikasi tidak valid atau sudah kedaluwarsa"})
+		return
+	}
+
+	if err := database.DB.Model(&models.User{}).
+		Where("id = ? AND email_verified_at IS NULL", userID).
+		Update("email_verified_at", time.Now()).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal memverifikasi email"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Email berhasil diverifikasi"})
+}
+
+// ResendVerification mengirim ulang email verifikasi untuk user yang login.
+// Route: POST /users/resend-verification
+func ResendVerification(c *gin.Context) {
+	Id, _ := c.Get("userId")
+	userID := utils.InterfaceToUint(Id)
+
+	var user models.User
+	if err := database.DB.First(&user, userID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+		return
+	}
+	if user.EmailVerifiedAt != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Email sudah terverifikasi"})
+		return
+	}
+	if !allowEmailRequest("verify-email", user.Email) {
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "Terlalu banyak permintaan. Mohon coba lagi nanti."})
+		return
+	}
+	if err := sendVerificationEmail(user); err != nil {
+		log.Printf("Warning: Gagal mengirim email verifikasi ke user %d: %v", user.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal mengirim email verifikasi"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Email verifikasi telah dikirim"})
+}
+
+// ForgotPassword mengirim tautan reset password. Respons selalu sama agar tidak membocorkan
+// email mana yang terdaftar.
+// Route: POST /forgot-password
+func ForgotPassword(c *gin.Context) {
+	var input ForgotPasswordInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Input tidak valid", "details": err.Error()})
+		return
+	}
+	response := gin.H{"message": "Jika email terdaftar, tautan reset password telah dikirim"}
+
+	var user models.User
+	if err := database.DB.Where("LOWER(email) = ?", utils.NormalizeEmail(input.Email)).First(&user).Error; err != nil {
+		c.JSON(http.StatusOK, response)
+		return
+	}
+	if !allowEmailRequest("reset-password", user.Email) {
+		c.JSON(http.StatusOK, response)
+		return
+	}
+	if err := sendPasswordResetEmail(user); err != nil {
+		log.Printf("Warning: Gagal mengirim email reset password ke user %d: %v", user.ID, err)
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// ResetPassword mengganti password dengan token dari email reset, lalu mengakhiri semua sesi login.
+// Route: POST /reset-password
+func ResetPassword(c *gin.Context) {
+	var input ResetPasswordInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Input tidak valid", "details": err.Error()})
+		return
+	}
+
+	userID, err := utils.ReverseActionToken(input.Token, utils.PurposeResetPassword, passwordBind)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Tautan reset password tidak valid atau sudah kedaluwarsa"})
+		return
+	}
+
+	hash, err := utils.HashPassword(input.Password)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to hash password"})
+		return
+	}
+	// Tautan reset dibuka dari email sehingga email sekaligus terbukti milik user
+	if err := database.DB.Model(&models.User{}).Where("id = ?", userID).Updates(map[string]interface{}{
+		"password":                hash,
+		"password_reset_required": false,
+		"email_verified_at":       gorm.Expr("COALESCE(email_verified_at, ?)", time.Now()),
+	}).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal mengganti password"})
+		return
+	}
+	if err := revokeUserSessions(database.DB, userID); err != nil {
+		log.Printf("Warning: Gagal mengakhiri sesi user %d setelah reset password: %v", userID, err)
+	}
+	// Password baru membuktikan pemilik akun, buka kunci login jika sedang terkunci
+	if email, err := emailBind(userID); err == nil {
+		if err := utils.UnlockLogin(utils.NormalizeEmail(email)); err != nil {
+			log.Printf("Warning: Gagal membuka kunci login user %d: %v", userID, err)
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Password berhasil diganti, silakan login kembali"})
+}
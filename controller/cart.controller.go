@@ -1,16 +1,26 @@
 package controller
 
 import (
+	"encoding/json"
 	"go-be/database"
 	"go-be/models"
 	"go-be/utils"
 	"net/http"
+	"sort"
 	"strconv"
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
 )
 
+// Jenis masalah hasil revalidasi keranjang
+const (
+	CartIssuePriceChanged      = "price_changed"
+	CartIssueOutOfStock        = "out_of_stock"
+	CartIssueInsufficientStock = "insufficient_stock"
+	CartIssueProductRemoved    = "product_removed"
+)
+
 // Struct Input DTO
 
 // AddToCartInput adalah struktur data yang diterima saat menambah/mengubah item keranjang.
@@ -24,8 +34,89 @@ type UpdateCartItemInput struct {
 	Quantity uint `json:"quantity" binding:"required,min=1"`
 }
 
+// AcknowledgeCartInput adalah konfirmasi perubahan keranjang. IssuesHash adalah revalidation.issuesHash
+// dari GET /cart, sehingga yang dikonfirmasi hanya perubahan yang sudah dilihat pengguna.
+type AcknowledgeCartInput struct {
+	IssuesHash string `json:"issuesHash" binding:"required"`
+}
+
+// CartIssue adalah perubahan pada item keranjang yang harus dikonfirmasi pengguna sebelum checkout.
+type CartIssue struct {
+	CartItemID  uint   `json:"cartItemId"`
+	ProductID   uint   `json:"productId"`
+	ProductName string `json:"productName"`
+	Type        string `json:"type"`
+	OldPrice    uint   `json:"oldPrice,omitempty"`
+	NewPrice    uint   `json:"newPrice,omitempty"`
+	Quantity    uint   `json:"quantity"`
+	Available   *uint  `json:"available,omitempty"`
+}
+
 // Helper Functions
 
+// preloadProductWithDeleted memuat produk termasuk yang sudah dihapus,
+// agar item yang produknya dihapus tetap terdeteksi saat revalidasi.
+func preloadProductWithDeleted(db *gorm.DB) *gorm.DB {
+	return db.Unscoped()
+}
+
+// revalidateCartItems membandingkan item keranjang dengan kondisi produk saat ini
+// (harga berubah, stok habis/kurang, atau produk dihapus).
+// Item harus dimuat dengan preloadProductWithDeleted; harga aktif produk ikut diisi.
+func revalidateCartItems(db *gorm.DB, items []models.CartItem) ([]CartIssue, error) {
+	if err := applyCartItemPrices(db, items); err != nil {
+		return nil, err
+	}
+	issues := []CartIssue{}
+	for _, item := range items {
+		issue := CartIssue{
+			CartItemID:  item.ID,
+			ProductID:   item.ProductID,
+			ProductName: item.Product.Name,
+			Quantity:    item.Quantity,
+		}
+
+		if item.Product.ID == 0 || item.Product.DeletedAt.Valid {
+			issue.Type = CartIssueProductRemoved
+			issues = append(issues, issue)
+			continue
+		}
+
+		if stock := item.Product.Stock; stock != nil && *stock < item.Quantity {
+			issue.Type = CartIssueInsufficientStock
+			if *stock == 0 {
+				issue.Type = CartIssueOutOfStock
+			}
+			issue.Available = stock
+			issues = append(issues, issue)
+		}
+
+		// PriceAtAdd bernilai 0 untuk item lama yang belum mencatat harga
+		if item.PriceAtAdd != 0 && item.PriceAtAdd != item.Product.ActivePrice {
+			priceIssue := issue
+			priceIssue.Type = CartIssuePriceChanged
+			priceIssue.Available = nil
+			priceIssue.OldPrice = item.PriceAtAdd
+			priceIssue.NewPrice = item.Product.ActivePrice
+			issues = append(issues, priceIssue)
+		}
+	}
+	return issues, nil
+}
+
+// cartIssuesHash membuat sidik jari daftar masalah revalidasi yang tidak bergantung pada urutan item.
+func cartIssuesHash(issues []CartIssue) string {
+	sorted := append([]CartIssue(nil), issues...)
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].CartItemID != sorted[j].CartItemID {
+			return sorted[i].CartItemID < sorted[j].CartItemID
+		}
+		return sorted[i].Type < sorted[j].Type
+	})
+	encoded, _ := json.Marshal(sorted)
+	return utils.HashToken(string(encoded))
+}
+
 // getOrCreateUserCart mencari keranjang aktif  pengguna atau membuatnya jika belum ada.
 func getOrCreateUserCart(userID uint, db *gorm.DB) (models.Cart, error) {
 	var cart models.Cart
@@ -34,7 +125,7 @@ func getOrCreateUserCart(userID uint, db *gorm.DB) (models.Cart, error) {
 
 	if err == gorm.ErrRecordNotFound {
 		// Jika tidak ditemukan, buat keranjang baru
-		cart = models.Cart{UserID: userID}
+		cart = models.Cart{UserID: &userID}
 		if createErr := db.Create(&cart).Error; createErr != nil {
 			return models.Cart{}, createErr
 		}
@@ -45,6 +136,45 @@ func getOrCreateUserCart(userID uint, db *gorm.DB) (models.Cart, error) {
 	return cart, nil
 }
 
+// addProductToCart menambahkan produk ke keranjang tertentu.
+// Jika produk sudah ada di keranjang, kuantitasnya ditambahkan dan created bernilai false.
+func addProductToCart(db *gorm.DB, cartID uint, product models.Product, quantity uint) (models.CartItem, bool, error) {
+	//  Cek apakah item sudah ada di keranjang
+	var cartItem models.CartItem
+	result := db.
+		Where("cart_id = ? AND product_id = ?", cartID, product.ID).
+		First(&cartItem)
+
+	if result.Error == gorm.ErrRecordNotFound {
+		// Harga yang dicatat adalah harga aktif, termasuk harga diskon terjadwal
+		if err := applyActivePrices(db, []*models.Product{&product}); err != nil {
+			return models.CartItem{}, false, err
+		}
+		//  Jika Item tidak ada, buat CartItem baru
+		cartItem = models.CartItem{
+			CartID:     cartID,
+			ProductID:  product.ID,
+			Quantity:   quantity,
+			PriceAtAdd: product.ActivePrice,
+		}
+		if err := db.Create(&cartItem).Error; err != nil {
+			return models.CartItem{}, false, err
+		}
+		return cartItem, true, nil
+	} else if result.Error != nil {
+		return models.CartItem{}, false, result.Error
+	}
+
+	//  Jika Item ADA, perbarui Quantity (tambahkan kuantitas baru)
+	newQuantity := cartItem.Quantity + quantity
+	if err := db.Model(&cartItem).Update("quantity", newQuantity).Error; err != nil {
+		return models.CartItem{}, false, err
+	}
+	// Ambil ulang item setelah update untuk respon
+	db.First(&cartItem, cartItem.ID)
+	return cartItem, false, nil
+}
+
 // Controller Handlers
 
 // AddToCart menambahkan produk ke keranjang pengguna.
@@ -79,40 +209,16 @@ func AddToCart(c *gin.Context) {
 		return
 	}
 
-	//  Cek apakah item sudah ada di keranjang
-	var cartItem models.CartItem
-	result := database.DB.
-		Where("cart_id = ? AND product_id = ?", cart.ID, input.ProductID).
-		First(&cartItem)
-
-	if result.Error == gorm.ErrRecordNotFound {
-		//  Jika Item tidak ada, buat CartItem baru
-		newCartItem := models.CartItem{
-			CartID:    cart.ID,
-			ProductID: input.ProductID,
-			Quantity:  input.Quantity,
-		}
-		if err := database.DB.Create(&newCartItem).Error; err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal menambah item ke keranjang"})
-			return
-		}
-		c.JSON(http.StatusCreated, gin.H{"message": "Produk berhasil ditambahkan ke keranjang", "data": newCartItem})
-
-	} else if result.Error == nil {
-		//  Jika Item ADA, perbarui Quantity (tambahkan kuantitas baru)
-		newQuantity := cartItem.Quantity + input.Quantity
-		if err := database.DB.Model(&cartItem).Update("quantity", newQuantity).Error; err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal memperbarui kuantitas item"})
-			return
-		}
-		// Ambil ulang item setelah update untuk respon
-		database.DB.First(&cartItem, cartItem.ID)
-		c.JSON(http.StatusOK, gin.H{"message": "Kuantitas produk berhasil ditambahkan", "data": cartItem})
-
-	} else {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Terjadi kesalahan saat mencari item keranjang"})
+	cartItem, created, err := addProductToCart(database.DB, cart.ID, product, input.Quantity)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal menambah item ke keranjang"})
 		return
 	}
+	if created {
+		c.JSON(http.StatusCreated, gin.H{"message": "Produk berhasil ditambahkan ke keranjang", "data": cartItem})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Kuantitas produk berhasil ditambahkan", "data": cartItem})
 }
 
 // GetUserCart mengambil detail keranjang aktif pengguna saat ini, termasuk item dan detail produk.
@@ -138,7 +244,7 @@ func GetUserCart(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal mengambil keranjang"})
 		return
 	}
-	if err := database.DB.Preload("Product").Model(&cartItem).Where("cart_id = ? ", cart.ID).Find(&cartItem).Error; err != nil {
+	if err := database.DB.Preload("Product", preloadProductWithDeleted).Model(&cartItem).Where("cart_id = ? ", cart.ID).Find(&cartItem).Error; err != nil {
 
 		if err == gorm.ErrRecordNotFound {
 			// Mengembalikan keranjang kosong sebagai respons jika tidak ditemukan
@@ -148,10 +254,120 @@ func GetUserCart(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal mengambil keranjang"})
 		return
 	}
+	// Ringkasan perubahan harga/stok yang harus dikonfirmasi sebelum checkout
+	issues, err := revalidateCartItems(database.DB, cartItem)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal memeriksa keranjang"})
+		return
+	}
+	totals, err := calculateCartPricing(database.DB, pricingRequest{
+		UserID:     userID,
+		Items:      cartItem,
+		CouponCode: cart.CouponCode,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal menghitung total keranjang"})
+		return
+	}
 	c.JSON(http.StatusOK, gin.H{
 		"message":  "Detail keranjang berhasil diambil",
 		"data":     cart,
 		"dataCart": cartItem,
+		"totals":   totals,
+		"revalidation": gin.H{
+			"requiresAcknowledgement": len(issues) > 0,
+			"issues":                  issues,
+			"issuesHash":              cartIssuesHash(issues),
+		},
+	})
+}
+
+// AcknowledgeCartChanges mengonfirmasi hasil revalidasi keranjang:
+// harga baru disimpan sebagai PriceAtAdd, item yang produknya dihapus atau stoknya habis dibuang,
+// dan kuantitas disesuaikan dengan stok yang tersedia. Jika kondisi keranjang sudah berbeda dari
+// yang dilihat pengguna (issuesHash), tidak ada yang diubah dan masalah terbaru dikembalikan dengan 409.
+// Route: POST /cart/acknowledge
+func AcknowledgeCartChanges(c *gin.Context) {
+	Id, exists := c.Get("userId")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "harus login dulu"})
+		return
+	}
+	userID := utils.InterfaceToUint(Id)
+
+	var input AcknowledgeCartInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Input tidak valid", "details": err.Error()})
+		return
+	}
+
+	var cart models.Cart
+	if err := database.DB.
+		Preload("Items.Product", preloadProductWithDeleted).
+		Where("user_id = ? AND order_id IS NULL", userID).
+		First(&cart).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Keranjang belanja tidak ditemukan"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal mengambil keranjang"})
+		return
+	}
+
+	issues, err := revalidateCartItems(database.DB, cart.Items)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal memeriksa keranjang"})
+		return
+	}
+	if hash := cartIssuesHash(issues); hash != input.IssuesHash {
+		c.JSON(http.StatusConflict, gin.H{
+			"error":      "Keranjang berubah lagi sejak terakhir dilihat, periksa perubahan terbaru",
+			"issues":     issues,
+			"issuesHash": hash,
+		})
+		return
+	}
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		for _, item := range cart.Items {
+			if item.Product.ID == 0 || item.Product.DeletedAt.Valid {
+				if err := tx.Delete(&item).Error; err != nil {
+					return err
+				}
+				continue
+			}
+
+			updates := map[string]interface{}{}
+			if item.PriceAtAdd != item.Product.ActivePrice {
+				updates["price_at_add"] = item.Product.ActivePrice
+			}
+			if stock := item.Product.Stock; stock != nil && *stock < item.Quantity {
+				if *stock == 0 {
+					if err := tx.Delete(&item).Error; err != nil {
+						return err
+					}
+					continue
+				}
+				updates["quantity"] = *stock
+			}
+			if len(updates) > 0 {
+				if err := tx.Model(&item).Updates(updates).Error; err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal mengonfirmasi perubahan keranjang"})
+		return
+	}
+
+	var cartItem []models.CartItem
+	database.DB.Preload("Product").Where("cart_id = ?", cart.ID).Find(&cartItem)
+	c.JSON(http.StatusOK, gin.H{
+		"message":      "Perubahan keranjang berhasil dikonfirmasi",
+		"acknowledged": issues,
+		"dataCart":     cartItem,
 	})
 }
 
@@ -0,0 +1,293 @@
+package controller
+
+import (
+	"go-be/database"
+	"go-be/models"
+	"go-be/utils"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Struct Input DTO
+
+// ApplyCouponInput adalah kode kupon yang dipasang ke keranjang.
+type ApplyCouponInput struct {
+	Code string `json:"code" binding:"required"`
+}
+
+// CouponInput adalah isian kupon dari admin. Field gorm.Model (ID, CreatedAt, DeletedAt) tidak bisa diisi dari request.
+type CouponInput struct {
+	Code           string     `json:"code" binding:"required"`
+	Description    string     `json:"description"`
+	Type           string     `json:"type" binding:"required"`
+	Value          uint       `json:"value"`
+	MaxDiscount    uint       `json:"maxDiscount"`
+	MinSpend       uint       `json:"minSpend"`
+	CategoryID     *uint      `json:"categoryId"`
+	ProductID      *uint      `json:"productId"`
+	FirstOrderOnly bool       `json:"firstOrderOnly"`
+	UsageLimit     uint       `json:"usageLimit"`
+	PerUserLimit   uint       `json:"perUserLimit"`
+	StartsAt       *time.Time `json:"startsAt"`
+	EndsAt         *time.Time `json:"endsAt"`
+	Active         bool       `json:"active"`
+}
+
+// Helper Functions
+
+// applyCouponInput menyalin isian admin ke kupon.
+func applyCouponInput(coupon *models.Coupon, input CouponInput) {
+	coupon.Code = input.Code
+	coupon.Description = input.Description
+	coupon.Type = input.Type
+	coupon.Value = input.Value
+	coupon.MaxDiscount = input.MaxDiscount
+	coupon.MinSpend = input.MinSpend
+	coupon.CategoryID = input.CategoryID
+	coupon.ProductID = input.ProductID
+	coupon.FirstOrderOnly = input.FirstOrderOnly
+	coupon.UsageLimit = input.UsageLimit
+	coupon.PerUserLimit = input.PerUserLimit
+	coupon.StartsAt = input.StartsAt
+	coupon.EndsAt = input.EndsAt
+	coupon.Active = input.Active
+}
+
+// MigrateCouponCodes mengganti unique index kode kupon lama dengan unique index yang hanya
+// berlaku untuk kupon yang belum dihapus, agar kode kupon yang dihapus bisa dibuat lagi.
+// Dipanggil sekali saat aplikasi mulai, setelah migrasi.
+func MigrateCouponCodes() error {
+	if err := database.DB.Exec(`DROP INDEX IF EXISTS idx_coupons_code`).Error; err != nil {
+		return err
+	}
+	return database.DB.Exec(`CREATE UNIQUE INDEX IF NOT EXISTS idx_coupons_code_active
+		ON coupons (code) WHERE deleted_at IS NULL`).Error
+}
+
+// validateCoupon mengecek isian kupon dari admin dan menormalkan kodenya.
+func validateCoupon(coupon *models.Coupon) string {
+	coupon.Code = strings.ToUpper(strings.TrimSpace(coupon.Code))
+	if coupon.Code == "" {
+		return "Kode kupon wajib diisi"
+	}
+	switch coupon.Type {
+	case models.CouponTypePercentage:
+		if coupon.Value == 0 || coupon.Value > 100 {
+			return "Nilai kupon persentase harus 1-100"
+		}
+	case models.CouponTypeFixed:
+		if coupon.Value == 0 {
+			return "Nilai kupon nominal wajib diisi"
+		}
+	case models.CouponTypeFreeShipping:
+	default:
+		return "Jenis kupon harus percentage, fixed, atau free_shipping"
+	}
+	if coupon.StartsAt != nil && coupon.EndsAt != nil && !coupon.EndsAt.After(*coupon.StartsAt) {
+		return "Waktu berakhir harus setelah waktu mulai"
+	}
+	return ""
+}
+
+// Controller Handlers
+
+// ApplyCartCoupon memasang kupon ke keranjang aktif setelah dicek kelayakannya.
+// Route: POST /cart/coupon
+func ApplyCartCoupon(c *gin.Context) {
+	Id, exists := c.Get("userId")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "harus login dulu"})
+		return
+	}
+	userID := utils.InterfaceToUint(Id)
+
+	var input ApplyCouponInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Input tidak valid", "details": err.Error()})
+		return
+	}
+	code := strings.ToUpper(strings.TrimSpace(input.Code))
+
+	var cart models.Cart
+	if err := database.DB.
+		Preload("Items.Product").
+		Where("user_id = ? AND order_id IS NULL", userID).
+		First(&cart).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Keranjang belanja kosong atau tidak ditemukan"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal mengambil keranjang"})
+		return
+	}
+
+	pricing, err := calculateCartPricing(database.DB, pricingRequest{
+		UserID:     userID,
+		Items:      cart.Items,
+		CouponCode: code,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal menghitung total keranjang"})
+		return
+	}
+	if pricing.CouponError != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": pricing.CouponError})
+		return
+	}
+
+	if err := database.DB.Model(&cart).Update("coupon_code", code).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal memasang kupon"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Kupon berhasil dipasang", "data": pricing})
+}
+
+// RemoveCartCoupon melepas kupon dari keranjang aktif.
+// Route: DELETE /cart/coupon
+func RemoveCartCoupon(c *gin.Context) {
+	Id, exists := c.Get("userId")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "harus login dulu"})
+		return
+	}
+	userID := utils.InterfaceToUint(Id)
+
+	if err := database.DB.Model(&models.Cart{}).
+		Where("user_id = ? AND order_id IS NULL", userID).
+		Update("coupon_code", "").Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal melepas kupon"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Kupon berhasil dilepas"})
+}
+
+// GetCoupons mengambil semua kupon untuk admin.
+// Route: GET /coupon-admin
+func GetCoupons(c *gin.Context) {
+	var coupons []models.Coupon
+	if err := database.DB.Order("created_at DESC").Find(&coupons).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal mengambil kupon"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Daftar kupon berhasil diambil", "data": coupons})
+}
+
+// CreateCoupon membuat kupon baru.
+// Route: POST /coupon-admin/create
+func CreateCoupon(c *gin.Context) {
+	var input CouponInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Input tidak valid", "details": err.Error()})
+		return
+	}
+	var coupon models.Coupon
+	applyCouponInput(&coupon, input)
+	if msg := validateCoupon(&coupon); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+
+	var count int64
+	database.DB.Model(&models.Coupon{}).Where("code = ?", coupon.Code).Count(&count)
+	if count > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Kode kupon sudah dipakai"})
+		return
+	}
+
+	if err := database.DB.Create(&coupon).Error; utils.IsUniqueViolation(err) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Kode kupon sudah dipakai"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal membuat kupon"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"message": "Kupon berhasil dibuat", "data": coupon})
+}
+
+// UpdateCoupon memperbarui kupon.
+// Route: PUT /coupon-admin/update/:id
+func UpdateCoupon(c *gin.Context) {
+	var coupon models.Coupon
+	if err := database.DB.First(&coupon, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Kupon tidak ditemukan"})
+		return
+	}
+
+	var input CouponInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Input tidak valid", "details": err.Error()})
+		return
+	}
+	applyCouponInput(&coupon, input)
+	if msg := validateCoupon(&coupon); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+
+	var count int64
+	database.DB.Model(&models.Coupon{}).Where("code = ? AND id <> ?", coupon.Code, coupon.ID).Count(&count)
+	if count > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Kode kupon sudah dipakai"})
+		return
+	}
+
+	if err := database.DB.Save(&coupon).Error; utils.IsUniqueViolation(err) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Kode kupon sudah dipakai"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal memperbarui kupon"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Kupon berhasil diperbarui", "data": coupon})
+}
+
+// DeleteCoupon menghapus kupon. Riwayat pemakaian tetap disimpan.
+// Route: DELETE /coupon-admin/delete/:id
+func DeleteCoupon(c *gin.Context) {
+	var coupon models.Coupon
+	if err := database.DB.First(&coupon, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Kupon tidak ditemukan"})
+		return
+	}
+
+	if err := database.DB.Delete(&coupon).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal menghapus kupon"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Kupon berhasil dihapus"})
+}
+
+// GetCouponRedemptions mengambil riwayat pemakaian sebuah kupon beserta pesanannya.
+// Route: GET /coupon-admin/redemptions/:id
+func GetCouponRedemptions(c *gin.Context) {
+	var redemptions []models.Redemption
+	if err := database.DB.
+		Where("coupon_id = ?", c.Param("id")).
+		Order("created_at DESC").
+		Find(&redemptions).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal mengambil riwayat kupon"})
+		return
+	}
+
+	var total uint
+	for _, redemption := range redemptions {
+		total += redemption.Amount
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":       "Riwayat pemakaian kupon berhasil diambil",
+		"totalUsed":     len(redemptions),
+		"totalDiscount": total,
+		"data":          redemptions,
+	})
+}
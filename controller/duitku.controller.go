@@ -12,12 +12,15 @@ import (
 	"go-be/models"
 	"go-be/utils"
 	"io"
+	"log"
 	"net/http"
 	"os"
 	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 // --- Konfigurasi Duitku (GANTI DENGAN NILAI ASLI ANDA!) ---
@@ -32,7 +35,7 @@ var DUITKU_ENDPOINT = os.Getenv("DUITKU_ENDPOINT")
 
 type ItemDetail struct {
 	Name     string `json:"name"`
-	Price    uint   `json:"price"`
+	Price    int    `json:"price"` // bisa negatif untuk baris diskon
 	Quantity uint   `json:"quantity"`
 }
 
@@ -90,7 +93,7 @@ type DuitkuCallbackInput struct {
 
 // createDuitkuInvoice mengirim request ke API Duitku untuk membuat invoice.
 // createDuitkuInvoice mengirim request ke API Duitku untuk membuat invoice.
-func createDuitkuInvoice(order models.Order, cart models.Cart, customerEmail string, customerPhone string, user models.User) (CreateInvoiceResponse, error) {
+func createDuitkuInvoice(order models.Order, pricing PriceBreakdown, customerEmail string, customerPhone string, user models.User) (CreateInvoiceResponse, error) {
 
 	// Tambahkan Validasi Konfigurasi Wajib
 	if DUITKU_MERCHANT_CODE == "" || DUITKU_API_KEY == "" || DUITKU_ENDPOINT == "" {
@@ -107,7 +110,7 @@ func createDuitkuInvoice(order models.Order, cart models.Cart, customerEmail str
 
 	// 2. Siapkan Payload
 	var items []ItemDetail
-	var checkTotal uint = 0
+	var checkTotal int = 0
 
 	// 2a. Siapkan Address Detail (Billing & Shipping)
 	billingAddress := AddressDetail{
@@ -131,33 +134,63 @@ func createDuitkuInvoice(order models.Order, cart models.Cart, customerEmail str
 		ShippingAddress: billingAddress, // Menggunakan Billing Address untuk Shipping
 	}
 
-	// 2c. Hitung Total dan Siapkan Item Details
-	for _, item := range cart.Items {
-		itemPrice := item.Product.Price
-		itemQuantity := item.Quantity
-
-		checkTotal += itemPrice * itemQuantity
-
+	// 2c. Siapkan Item Details dari rincian mesin harga.
+	// Price di Duitku adalah total per baris (harga x kuantitas) dan jumlah semua
+	// baris harus sama dengan paymentAmount, jadi PPN, diskon, ongkir dan biaya layanan
+	// dikirim sebagai baris tersendiri. Jika harga sudah termasuk PPN, tarifnya
+	// dicantumkan di nama item dan PPN tidak ditambahkan lagi.
+	for _, line := range pricing.Lines {
+		name := line.Name
+		if pricing.TaxInclusive && line.Tax > 0 {
+			name = fmt.Sprintf("%s (termasuk PPN %d%%)", line.Name, line.TaxRate)
+		}
 		items = append(items, ItemDetail{
-			Name:     item.Product.Name,
-			Price:    itemPrice,
-			Quantity: itemQuantity,
+			Name:     name,
+			Price:    int(line.Subtotal),
+			Quantity: line.Quantity,
 		})
 	}
+	if discount := pricing.Discount + pricing.ShippingDiscount; discount > 0 {
+		items = append(items, ItemDetail{Name: "Diskon", Price: -int(discount), Quantity: 1})
+	}
+	if !pricing.TaxInclusive {
+		for _, tax := range pricing.Taxes {
+			items = append(items, ItemDetail{Name: fmt.Sprintf("PPN %d%%", tax.Rate), Price: int(tax.Amount), Quantity: 1})
+		}
+	}
+	if pricing.TaxExempted > 0 {
+		items = append(items, ItemDetail{Name: "Pembebasan PPN", Price: -int(pricing.TaxExempted), Quantity: 1})
+	}
+	if order.GiftCardAmount > 0 {
+		items = append(items, ItemDetail{Name: "Gift Card", Price: -int(order.GiftCardAmount), Quantity: 1})
+	}
+	if order.StoreCreditAmount > 0 {
+		items = append(items, ItemDetail{Name: "Saldo Toko", Price: -int(order.StoreCreditAmount), Quantity: 1})
+	}
+	if pricing.Shipping > 0 {
+		items = append(items, ItemDetail{Name: "Ongkos Kirim", Price: int(pricing.Shipping), Quantity: 1})
+	}
+	if pricing.Services > 0 {
+		items = append(items, ItemDetail{Name: "Biaya Layanan", Price: int(pricing.Services), Quantity: 1})
+	}
+	for _, item := range items {
+		checkTotal += item.Price
+	}
 
 	// Validasi Total
-	if checkTotal != order.TotalPrice {
-		return CreateInvoiceResponse{}, fmt.Errorf("Internal data inconsistency: Calculated total price (%d) does not match Order's TotalPrice (%d). Cannot send to Duitku.", checkTotal, order.TotalPrice)
+	if checkTotal != int(order.AmountDue()) {
+		return CreateInvoiceResponse{}, fmt.Errorf("Internal data inconsistency: Calculated total price (%d) does not match Order's AmountDue (%d). Cannot send to Duitku.", checkTotal, order.AmountDue())
 	}
 
 	// 2d. Buat Struct Payload
 	payload := CreateInvoiceRequest{
-		PaymentAmount:   checkTotal,
-		MerchantOrderID: strconv.FormatUint(uint64(order.ID), 10),
-		ProductDetails:  "Pembayaran Pesanan #" + strconv.FormatUint(uint64(order.ID), 10),
+		PaymentAmount:   order.AmountDue(),
+		MerchantOrderID: order.Number,
+		ProductDetails:  "Pembayaran Pesanan " + order.Number,
 		Email:           customerEmail,
 		PhoneNumber:     customerPhone,
 		CustomerVaName:  "Customer " + strconv.FormatUint(uint64(order.UserID), 10),
+		ItemDetails:     items,
 		CustomerDetail:  customerDtl, // 👈 GUNAKAN customerDtl BERTIPE CustomerDetail
 		CallbackUrl:     DUITKU_CALLBACK_URL,
 		ReturnUrl:       DUITKU_RETURN_URL,
@@ -166,11 +199,8 @@ func createDuitkuInvoice(order models.Order, cart models.Cart, customerEmail str
 
 	payloadBytes, _ := json.Marshal(payload)
 
-	// Logging
-	fmt.Println("----------------------------------------")
-	fmt.Println("DUITKU SIGNATURE:", signature)
-	fmt.Println("DUITKU PAYLOAD:", string(payloadBytes))
-	fmt.Println("----------------------------------------")
+	// Payload berisi data pribadi pelanggan sehingga tidak ikut dicatat
+	log.Printf("Info: Membuat invoice Duitku untuk pesanan %s", order.Number)
 
 	// 3. Kirim HTTP Request
 	req, err := http.NewRequest("POST", DUITKU_ENDPOINT, bytes.NewBuffer(payloadBytes))
@@ -222,6 +252,22 @@ func createDuitkuInvoice(order models.Order, cart models.Cart, customerEmail str
 
 // --- Controller Handlers ---
 
+// errCallbackAmountMismatch dikembalikan saat jumlah di callback tidak sama dengan sisa tagihan pesanan.
+var errCallbackAmountMismatch = errors.New("jumlah pembayaran tidak sesuai")
+
+// callbackTransitionAllowed membatasi perubahan status dari callback pembayaran: hanya pesanan
+// Pending yang bisa menjadi Paid/Failed, dan pesanan Failed hanya bisa aktif lagi jika dibayar.
+// Pesanan yang sudah dibayar atau dikirim tidak pernah diubah oleh callback.
+func callbackTransitionAllowed(current, next string) bool {
+	switch current {
+	case models.OrderStatusPending:
+		return next == models.OrderStatusPaid || next == models.OrderStatusFailed
+	case models.OrderStatusFailed:
+		return next == models.OrderStatusPaid
+	}
+	return false
+}
+
 // HandleDuitkuCallback menerima notifikasi status pembayaran dari Duitku.
 // Route: POST /api/v1/duitku/callback
 func HandleDuitkuCallback(c *gin.Context) {
@@ -246,43 +292,62 @@ func HandleDuitkuCallback(c *gin.Context) {
 		return
 	}
 
-	// 2. Cari Order di database berdasarkan MerchantOrderID
-	orderID, _ := strconv.ParseUint(input.MerchantOrderID, 10, 64)
-	var order models.Order
-	if err := database.DB.First(&order, orderID).Error; err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
-		return
-	}
-
-	// 3. Verifikasi Jumlah (Amount)
-	// Pastikan jumlah yang dibayarkan sama dengan TotalPrice di Order Anda
-	if input.Amount != order.TotalPrice {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Amount mismatch"})
-		return
-	}
-
-	// 4. Proses Status Pembayaran
-	newStatus := order.Status
-
+	// 2. Tentukan status baru dari ResultCode
+	var newStatus string
 	if input.ResultCode == "00" {
-		newStatus = "Paid"
+		newStatus = models.OrderStatusPaid
 	} else if input.ResultCode == "01" {
-		newStatus = "Failed"
+		newStatus = models.OrderStatusFailed
 	} else {
 		// Status lainnya, misalnya 02: Pending
-		newStatus = "Pending"
+		newStatus = models.OrderStatusPending
 	}
 
-	// Hanya update jika status berubah
-	if newStatus != order.Status {
-		if err := database.DB.Model(&order).Update("Status", newStatus).Error; err != nil {
-			// Jika gagal update DB, Anda bisa log error dan mengembalikan non-200 OK
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update order status"})
-			return
+	// 3. Cari dan kunci Order berdasarkan MerchantOrderID (nomor pesanan) agar callback
+	// yang datang bersamaan atau diulang tidak memproses pesanan yang sama dua kali.
+	// Invoice lama masih memakai ID pesanan sebagai MerchantOrderID.
+	var order models.Order
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		locked := tx.Clauses(clause.Locking{Strength: "UPDATE"})
+		err := locked.Where("number = ?", input.MerchantOrderID).First(&order).Error
+		if err == gorm.ErrRecordNotFound {
+			if orderID, parseErr := strconv.ParseUint(input.MerchantOrderID, 10, 64); parseErr == nil {
+				err = locked.First(&order, orderID).Error
+			}
+		}
+		if err != nil {
+			return err
+		}
+
+		// Pastikan jumlah yang dibayarkan sama dengan sisa tagihan setelah gift card/saldo toko
+		if input.Amount != order.AmountDue() {
+			return errCallbackAmountMismatch
+		}
+		if !callbackTransitionAllowed(order.Status, newStatus) {
+			// Callback terlambat atau diulang untuk pesanan yang sudah diproses: abaikan
+			log.Printf("Info: Callback Duitku %s diabaikan untuk pesanan %s berstatus %s", input.ResultCode, order.Number, order.Status)
+			return nil
 		}
+		return updateOrderStatus(tx, &order, newStatus)
+	})
+	switch {
+	case err == gorm.ErrRecordNotFound:
+		c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
+		return
+	case err == errCallbackAmountMismatch:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Amount mismatch"})
+		return
+	case err == errCreditsInsufficient || err == errOutOfStock || err == errInsufficientPoints:
+		// Pembayaran masuk untuk pesanan gagal yang tidak bisa diaktifkan lagi, perlu ditangani manual
+		log.Printf("Warning: Pembayaran pesanan %s diterima tetapi pesanan tidak bisa diaktifkan: %v", order.Number, err)
+		c.JSON(http.StatusConflict, gin.H{"error": "Order cannot be reactivated"})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update order status"})
+		return
 	}
 
-	// 5. Beri Respon HTTP 200 OK ke Duitku
+	// 4. Beri Respon HTTP 200 OK ke Duitku
 	// Ini memberitahu Duitku bahwa Anda telah menerima dan memproses notifikasi
 	c.String(http.StatusOK, "Callback received and processed")
 }
@@ -0,0 +1,580 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"go-be/database"
+	"go-be/models"
+	"go-be/utils"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// errGiftCardUnavailable dikembalikan saat gift card tidak ditemukan, belum aktif, habis, atau kedaluwarsa.
+var errGiftCardUnavailable = errors.New("gift card tidak dapat digunakan")
+
+// errCreditsInsufficient dikembalikan saat saldo gift card atau saldo toko tidak lagi cukup
+// untuk membayar ulang pesanan yang sempat gagal.
+var errCreditsInsufficient = errors.New("saldo gift card atau saldo toko tidak mencukupi")
+
+// errInsufficientStoreCredit dikembalikan saat koreksi admin membuat saldo toko minus.
+var errInsufficientStoreCredit = errors.New("saldo toko tidak mencukupi")
+
+// Struct Input DTO
+
+// PurchaseGiftCardInput adalah data pembelian gift card.
+type PurchaseGiftCardInput struct {
+	Amount         uint   `json:"amount" binding:"required"`
+	RecipientName  string `json:"recipientName" binding:"max=100"`
+	RecipientEmail string `json:"recipientEmail" binding:"omitempty,email"` // kode dikirim ke email ini saat gift card aktif
+	Message        string `json:"message" binding:"max=500"`
+}
+
+// RedeemGiftCardInput adalah kode gift card yang ditukar menjadi saldo toko.
+type RedeemGiftCardInput struct {
+	Code string `json:"code" binding:"required"`
+}
+
+// StoreCreditAdjustmentInput adalah penambahan atau koreksi saldo toko oleh admin.
+type StoreCreditAdjustmentInput struct {
+	Amount int    `json:"amount" binding:"required"` // negatif untuk mengurangi saldo
+	Note   string `json:"note" binding:"required"`
+}
+
+// Helper Functions
+
+// generateGiftCardCode membuat kode gift card acak dengan format GC-XXXX-XXXX-XXXX.
+func generateGiftCardCode() (string, error) {
+	token, err := utils.RandomToken(6)
+	if err != nil {
+		return "", err
+	}
+	token = strings.ToUpper(token)
+	return fmt.Sprintf("GC-%s-%s-%s", token[0:4], token[4:8], token[8:12]), nil
+}
+
+// normalizeGiftCardCode menyeragamkan kode gift card yang diketik pelanggan.
+func normalizeGiftCardCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+// storeCreditBalance menghitung saldo toko user dari buku besar.
+func storeCreditBalance(db *gorm.DB, userID uint) (int, error) {
+	var balance int
+	err := db.Model(&models.StoreCreditEntry{}).
+		Where("user_id = ?", userID).
+		Select("COALESCE(SUM(amount), 0)").
+		Scan(&balance).Error
+	return balance, err
+}
+
+// lockUserBalance mengunci baris user agar mutasi saldo toko atau poin yang bersamaan tidak membuat saldo minus.
+func lockUserBalance(tx *gorm.DB, userID uint) error {
+	var user models.User
+	return tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").First(&user, userID).Error
+}
+
+// addStoreCredit menambah (amount positif) atau mengurangi (amount negatif) saldo toko user.
+func addStoreCredit(tx *gorm.DB, entry models.StoreCreditEntry) error {
+	return tx.Create(&entry).Error
+}
+
+// findUsableGiftCard mengunci dan mengambil gift card aktif yang masih bersaldo.
+func findUsableGiftCard(tx *gorm.DB, code string, now time.Time) (models.GiftCard, error) {
+	var card models.GiftCard
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("code = ?", normalizeGiftCardCode(code)).
+		First(&card).Error
+	if err == gorm.ErrRecordNotFound {
+		return models.GiftCard{}, errGiftCardUnavailable
+	} else if err != nil {
+		return models.GiftCard{}, err
+	}
+	if card.Status != models.GiftCardStatusActive || card.Balance == 0 ||
+		(card.ExpiresAt != nil && !now.Before(*card.ExpiresAt)) {
+		return models.GiftCard{}, errGiftCardUnavailable
+	}
+	return card, nil
+}
+
+// changeGiftCardBalance mengubah saldo gift card dan mencatat mutasinya.
+// Saldo tidak pernah dibuat kurang dari 0.
+func changeGiftCardBalance(tx *gorm.DB, cardID uint, amount int, reason string, orderID *uint, userID *uint) error {
+	if err := tx.Model(&models.GiftCard{}).
+		Where("id = ?", cardID).
+		UpdateColumn("balance", gorm.Expr("GREATEST(balance + ?, 0)", amount)).Error; err != nil {
+		return err
+	}
+	return tx.Create(&models.GiftCardTransaction{
+		GiftCardID: cardID,
+		OrderID:    orderID,
+		UserID:     userID,
+		Amount:     amount,
+		Reason:     reason,
+	}).Error
+}
+
+// applyOrderCredits membayar sebagian atau seluruh pesanan dengan gift card lalu saldo toko.
+// Sisa tagihan (AmountDue) dibayar lewat Duitku.
+func applyOrderCredits(tx *gorm.DB, order *models.Order, giftCardCode string, useStoreCredit bool) error {
+	orderID := order.ID
+	userID := order.UserID
+	remaining := order.TotalPrice
+
+	if giftCardCode != "" && remaining > 0 {
+		card, err := findUsableGiftCard(tx, giftCardCode, time.Now())
+		if err != nil {
+			return err
+		}
+		amount := card.Balance
+		if amount > remaining {
+			amount = remaining
+		}
+		if err := changeGiftCardBalance(tx, card.ID, -int(amount), models.CreditReasonOrderPay, &orderID, &userID); err != nil {
+			return err
+		}
+		cardID := card.ID
+		order.GiftCardID = &cardID
+		order.GiftCardAmount = amount
+		remaining -= amount
+	}
+
+	if useStoreCredit && remaining > 0 {
+		if err := lockUserBalance(tx, userID); err != nil {
+			return err
+		}
+		balance, err := storeCreditBalance(tx, userID)
+		if err != nil {
+			return err
+		}
+		if balance > 0 {
+			amount := uint(balance)
+			if amount > remaining {
+				amount = remaining
+			}
+			if err := addStoreCredit(tx, models.StoreCreditEntry{
+				UserID:  userID,
+				Amount:  -int(amount),
+				Reason:  models.CreditReasonOrderPay,
+				OrderID: &orderID,
+			}); err != nil {
+				return err
+			}
+			order.StoreCreditAmount = amount
+		}
+	}
+
+	return tx.Model(order).
+		Select("GiftCardID", "GiftCardAmount", "StoreCreditAmount").
+		Updates(order).Error
+}
+
+// refundOrderCredits mengembalikan saldo gift card dan saldo toko yang dipakai pesanan.
+func refundOrderCredits(tx *gorm.DB, order models.Order) error {
+	orderID := order.ID
+	userID := order.UserID
+	if order.GiftCardID != nil && order.GiftCardAmount > 0 {
+		if err := changeGiftCardBalance(tx, *order.GiftCardID, int(order.GiftCardAmount), models.CreditReasonOrderRefund, &orderID, &userID); err != nil {
+			return err
+		}
+	}
+	if order.StoreCreditAmount > 0 {
+		return addStoreCredit(tx, models.StoreCreditEntry{
+			UserID:  userID,
+			Amount:  int(order.StoreCreditAmount),
+			Reason:  models.CreditReasonOrderRefund,
+			OrderID: &orderID,
+		})
+	}
+	return nil
+}
+
+// reapplyOrderCredits memotong lagi gift card dan saldo toko saat pesanan yang gagal kembali aktif.
+// Saldo bisa sudah terpakai sejak pesanan gagal, sehingga dikunci dan dicek dulu agar pesanan
+// tidak dibayar dua kali dengan saldo yang sama.
+func reapplyOrderCredits(tx *gorm.DB, order models.Order) error {
+	orderID := order.ID
+	userID := order.UserID
+	if order.GiftCardID != nil && order.GiftCardAmount > 0 {
+		var card models.GiftCard
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&card, *order.GiftCardID).Error; err != nil {
+			return err
+		}
+		if card.Status != models.GiftCardStatusActive || card.Balance < order.GiftCardAmount ||
+			(card.ExpiresAt != nil && !time.Now().Before(*card.ExpiresAt)) {
+			return errCreditsInsufficient
+		}
+		if err := changeGiftCardBalance(tx, card.ID, -int(order.GiftCardAmount), models.CreditReasonOrderPay, &orderID, &userID); err != nil {
+			return err
+		}
+	}
+	if order.StoreCreditAmount > 0 {
+		if err := lockUserBalance(tx, userID); err != nil {
+			return err
+		}
+		balance, err := storeCreditBalance(tx, userID)
+		if err != nil {
+			return err
+		}
+		if balance < int(order.StoreCreditAmount) {
+			return errCreditsInsufficient
+		}
+		return addStoreCredit(tx, models.StoreCreditEntry{
+			UserID:  userID,
+			Amount:  -int(order.StoreCreditAmount),
+			Reason:  models.CreditReasonOrderPay,
+			OrderID: &orderID,
+		})
+	}
+	return nil
+}
+
+// activatePurchasedGiftCards mengaktifkan gift card yang dibeli lewat pesanan setelah dibayar.
+func activatePurchasedGiftCards(tx *gorm.DB, order models.Order) error {
+	var cards []models.GiftCard
+	if err := tx.Where("order_id = ? AND status <> ?", order.ID, models.GiftCardStatusActive).Find(&cards).Error; err != nil {
+		return err
+	}
+	validDays := utils.EnvUint("GIFT_CARD_VALID_DAYS", 365)
+	for _, card := range cards {
+		expiresAt := time.Now().AddDate(0, 0, int(validDays))
+		if err := tx.Model(&card).Updates(map[string]interface{}{
+			"status":     models.GiftCardStatusActive,
+			"balance":    card.InitialAmount,
+			"expires_at": expiresAt,
+		}).Error; err != nil {
+			return err
+		}
+		orderID := order.ID
+		if err := tx.Create(&models.GiftCardTransaction{
+			GiftCardID: card.ID,
+			OrderID:    &orderID,
+			UserID:     card.PurchaserID,
+			Amount:     int(card.InitialAmount),
+			Reason:     models.CreditReasonPurchase,
+		}).Error; err != nil {
+			return err
+		}
+		if card.PurchaserID != nil {
+			message := fmt.Sprintf("Gift card %s senilai Rp%d sudah aktif", card.Code, card.InitialAmount)
+			if err := notifyUser(tx, *card.PurchaserID, "gift_card_active", message, "/gift-card"); err != nil {
+				return err
+			}
+		}
+		// Gagal kirim email tidak membatalkan pembayaran; pembeli tetap bisa meneruskan kode dari notifikasi
+		if card.RecipientEmail != "" {
+			if err := sendGiftCardEmail(card, expiresAt); err != nil {
+				log.Printf("Warning: Gagal mengirim gift card %d ke penerima: %v", card.ID, err)
+			}
+		}
+	}
+	return nil
+}
+
+// sendGiftCardEmail mengirim kode gift card yang sudah aktif ke email penerima hadiah.
+func sendGiftCardEmail(card models.GiftCard, expiresAt time.Time) error {
+	body := fmt.Sprintf("Halo %s,\n\nAnda menerima gift card senilai Rp%d.\n\nKode: %s\nBerlaku sampai: %s\n",
+		card.RecipientName, card.InitialAmount, card.Code, expiresAt.Format("02-01-2006"))
+	if card.Message != "" {
+		body += "\nPesan dari pengirim:\n" + card.Message + "\n"
+	}
+	body += "\nTukarkan kode di " + frontendLink("/gift-card", "") + " atau pakai saat checkout.\n"
+	return utils.SendMail(utils.Mail{
+		To:      card.RecipientEmail,
+		Subject: "Anda menerima gift card",
+		Body:    body,
+	})
+}
+
+// cancelPurchasedGiftCards membatalkan gift card dari pesanan pembelian yang gagal dibayar.
+func cancelPurchasedGiftCards(tx *gorm.DB, order models.Order) error {
+	return tx.Model(&models.GiftCard{}).
+		Where("order_id = ?", order.ID).
+		Updates(map[string]interface{}{"status": models.GiftCardStatusCancelled, "balance": 0}).Error
+}
+
+// Controller Handlers
+
+// PurchaseGiftCard membuat gift card baru beserta pesanan pembayarannya di Duitku.
+// Gift card aktif setelah pembayaran berhasil.
+// Route: POST /gift-card/purchase
+func PurchaseGiftCard(c *gin.Context) {
+	Id, exists := c.Get("userId")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "harus login dulu"})
+		return
+	}
+	userID := utils.InterfaceToUint(Id)
+
+	var input PurchaseGiftCardInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Input tidak valid", "details": err.Error()})
+		return
+	}
+	minAmount := utils.EnvUint("GIFT_CARD_MIN_AMOUNT", 50000)
+	maxAmount := utils.EnvUint("GIFT_CARD_MAX_AMOUNT", 10000000)
+	if input.Amount < minAmount || input.Amount > maxAmount {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Nominal gift card harus antara Rp%d dan Rp%d", minAmount, maxAmount)})
+		return
+	}
+
+	var user models.User
+	if err := database.DB.Preload("Address").First(&user, userID).Error; err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "harus login dulu"})
+		return
+	}
+
+	code, err := generateGiftCardCode()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal membuat kode gift card"})
+		return
+	}
+
+	var order models.Order
+	var card models.GiftCard
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		order = models.Order{
+			UserID:     userID,
+			Subtotal:   input.Amount,
+			TotalPrice: input.Amount,
+			Quantity:   1,
+			Status:     models.OrderStatusPending,
+		}
+		if err := createOrderWithNumber(tx, &order, time.Now()); err != nil {
+			return err
+		}
+		orderID := order.ID
+		card = models.GiftCard{
+			Code:           code,
+			InitialAmount:  input.Amount,
+			Status:         models.GiftCardStatusPending,
+			PurchaserID:    &userID,
+			OrderID:        &orderID,
+			RecipientName:  input.RecipientName,
+			RecipientEmail: utils.NormalizeEmail(input.RecipientEmail),
+			Message:        input.Message,
+		}
+		return tx.Create(&card).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal membuat pesanan gift card"})
+		return
+	}
+
+	// Gift card dikirim ke Duitku sebagai satu baris item
+	pricing := PriceBreakdown{
+		Lines: []PriceLine{{
+			Name:      "Gift Card",
+			UnitPrice: input.Amount,
+			Quantity:  1,
+			Subtotal:  input.Amount,
+			Total:     input.Amount,
+		}},
+		Quantity:   1,
+		Subtotal:   input.Amount,
+		GrandTotal: input.Amount,
+	}
+	duitkuResp, err := createDuitkuInvoice(order, pricing, user.Email, user.Address.PhoneNumber, user)
+	if err != nil {
+		database.DB.Delete(&card)
+		database.DB.Delete(&order)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal membuat invoice pembayaran", "details": err.Error()})
+		return
+	}
+	if err := database.DB.Model(&order).Update("DuitkuReference", duitkuResp.Reference).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal menyimpan referensi Duitku"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":    "Invoice pembayaran gift card berhasil dibuat.",
+		"paymentUrl": duitkuResp.PaymentUrl,
+		"order": gin.H{
+			"id":         order.ID,
+			"totalPrice": order.TotalPrice,
+			"reference":  duitkuResp.Reference,
+		},
+		"giftCard": card,
+	})
+}
+
+// GetMyGiftCards mengambil gift card yang dibeli pengguna.
+// Route: GET /gift-card
+func GetMyGiftCards(c *gin.Context) {
+	Id, exists := c.Get("userId")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "harus login dulu"})
+		return
+	}
+	userID := utils.InterfaceToUint(Id)
+
+	var cards []models.GiftCard
+	if err := database.DB.Where("purchaser_id = ?", userID).Order("created_at DESC").Find(&cards).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal mengambil gift card"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Gift card berhasil diambil", "data": cards})
+}
+
+// CheckGiftCardBalance menampilkan saldo dan masa berlaku gift card berdasarkan kode.
+// Route: GET /gift-card/balance/:code
+func CheckGiftCardBalance(c *gin.Context) {
+	var card models.GiftCard
+	if err := database.DB.Where("code = ?", normalizeGiftCardCode(c.Param("code"))).First(&card).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Gift card tidak ditemukan"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Saldo gift card berhasil diambil",
+		"data": gin.H{
+			"code":      card.Code,
+			"status":    card.Status,
+			"balance":   card.Balance,
+			"expiresAt": card.ExpiresAt,
+		},
+	})
+}
+
+// RedeemGiftCard memindahkan seluruh saldo gift card ke saldo toko pengguna.
+// Route: POST /gift-card/redeem
+func RedeemGiftCard(c *gin.Context) {
+	Id, exists := c.Get("userId")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "harus login dulu"})
+		return
+	}
+	userID := utils.InterfaceToUint(Id)
+
+	var input RedeemGiftCardInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Input tidak valid", "details": err.Error()})
+		return
+	}
+
+	var redeemed uint
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		card, err := findUsableGiftCard(tx, input.Code, time.Now())
+		if err != nil {
+			return err
+		}
+		redeemed = card.Balance
+		if err := changeGiftCardBalance(tx, card.ID, -int(card.Balance), models.CreditReasonRedeem, nil, &userID); err != nil {
+			return err
+		}
+		cardID := card.ID
+		return addStoreCredit(tx, models.StoreCreditEntry{
+			UserID:     userID,
+			Amount:     int(redeemed),
+			Reason:     models.CreditReasonRedeem,
+			GiftCardID: &cardID,
+		})
+	})
+	if err == errGiftCardUnavailable {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Gift card tidak valid, sudah habis, atau kedaluwarsa"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal menukar gift card"})
+		return
+	}
+
+	balance, _ := storeCreditBalance(database.DB, userID)
+	c.JSON(http.StatusOK, gin.H{
+		"message":  "Gift card berhasil ditukar menjadi saldo toko",
+		"redeemed": redeemed,
+		"balance":  balance,
+	})
+}
+
+// GetStoreCredit mengambil saldo toko dan riwayat mutasinya.
+// Route: GET /users/store-credit
+func GetStoreCredit(c *gin.Context) {
+	Id, exists := c.Get("userId")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "harus login dulu"})
+		return
+	}
+	userID := utils.InterfaceToUint(Id)
+
+	balance, err := storeCreditBalance(database.DB, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal menghitung saldo toko"})
+		return
+	}
+	var entries []models.StoreCreditEntry
+	if err := database.DB.Where("user_id = ?", userID).Order("created_at DESC").Find(&entries).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal mengambil riwayat saldo toko"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Saldo toko berhasil diambil", "balance": balance, "data": entries})
+}
+
+// AdjustStoreCredit menambah atau mengoreksi saldo toko user oleh admin.
+// Route: POST /user-admin/store-credit/:id
+func AdjustStoreCredit(c *gin.Context) {
+	Id, _ := c.Get("userId")
+	adminID := utils.InterfaceToUint(Id)
+
+	var user models.User
+	if err := database.DB.First(&user, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+		return
+	}
+
+	var input StoreCreditAdjustmentInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Input tidak valid", "details": err.Error()})
+		return
+	}
+
+	var balance int
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := lockUserBalance(tx, user.ID); err != nil {
+			return err
+		}
+		current, err := storeCreditBalance(tx, user.ID)
+		if err != nil {
+			return err
+		}
+		if current+input.Amount < 0 {
+			return errInsufficientStoreCredit
+		}
+		balance = current + input.Amount
+		return addStoreCredit(tx, models.StoreCreditEntry{
+			UserID:      user.ID,
+			Amount:      input.Amount,
+			Reason:      models.CreditReasonAdjustment,
+			Note:        input.Note,
+			CreatedByID: &adminID,
+		})
+	})
+	if err == errInsufficientStoreCredit {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Saldo toko user tidak mencukupi"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal memperbarui saldo toko"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Saldo toko berhasil diperbarui", "balance": balance})
+}
+
+// GetGiftCards mengambil semua gift card untuk admin.
+// Route: GET /gift-card-admin
+func GetGiftCards(c *gin.Context) {
+	var cards []models.GiftCard
+	if err := database.DB.Order("created_at DESC").Find(&cards).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal mengambil gift card"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Daftar gift card berhasil diambil", "data": cards})
+}
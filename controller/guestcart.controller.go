@@ -0,0 +1,289 @@
+package controller
+
+import (
+	"go-be/database"
+	"go-be/models"
+	"go-be/utils"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// CartTokenHeader adalah header yang membawa token keranjang tamu.
+const CartTokenHeader = "X-Cart-Token"
+
+// Aturan penggabungan kuantitas jika produk yang sama ada di keranjang tamu dan keranjang user.
+// Dipilih lewat env GUEST_CART_MERGE_STRATEGY, default "sum".
+const (
+	MergeStrategySum   = "sum"   // jumlahkan kuantitas
+	MergeStrategyMax   = "max"   // ambil kuantitas terbesar
+	MergeStrategyGuest = "guest" // pakai kuantitas dari keranjang tamu
+	MergeStrategyUser  = "user"  // pertahankan kuantitas keranjang user
+)
+
+// Helper Functions
+
+// guestCartMergeStrategy membaca aturan penggabungan dari environment.
+func guestCartMergeStrategy() string {
+	switch strategy := os.Getenv("GUEST_CART_MERGE_STRATEGY"); strategy {
+	case MergeStrategyMax, MergeStrategyGuest, MergeStrategyUser:
+		return strategy
+	default:
+		return MergeStrategySum
+	}
+}
+
+// mergeQuantity menentukan kuantitas akhir untuk produk duplikat sesuai aturan penggabungan.
+func mergeQuantity(strategy string, userQty uint, guestQty uint) uint {
+	switch strategy {
+	case MergeStrategyMax:
+		if guestQty > userQty {
+			return guestQty
+		}
+		return userQty
+	case MergeStrategyGuest:
+		return guestQty
+	case MergeStrategyUser:
+		return userQty
+	default:
+		return userQty + guestQty
+	}
+}
+
+// findGuestCart mencari keranjang tamu yang masih aktif berdasarkan token.
+func findGuestCart(db *gorm.DB, token string) (models.Cart, error) {
+	cartID, err := utils.ReverseCartToken(token)
+	if err != nil {
+		return models.Cart{}, err
+	}
+	var cart models.Cart
+	err = db.Where("id = ? AND user_id IS NULL AND order_id IS NULL", cartID).First(&cart).Error
+	return cart, err
+}
+
+// getOrCreateGuestCart mencari keranjang tamu dari header, atau membuat keranjang baru
+// dan mengirimkan token barunya lewat header response.
+func getOrCreateGuestCart(c *gin.Context, db *gorm.DB) (models.Cart, string, error) {
+	token := c.GetHeader(CartTokenHeader)
+	if token != "" {
+		cart, err := findGuestCart(db, token)
+		if err == nil {
+			return cart, token, nil
+		}
+	}
+
+	cart := models.Cart{}
+	if err := db.Create(&cart).Error; err != nil {
+		return models.Cart{}, "", err
+	}
+	token, err := utils.GenerateCartToken(cart.ID)
+	if err != nil {
+		return models.Cart{}, "", err
+	}
+	c.Header(CartTokenHeader, token)
+	return cart, token, nil
+}
+
+// mergeGuestCart memindahkan item keranjang tamu ke keranjang aktif user lalu menghapus keranjang tamu.
+// Produk yang sama digabung sesuai aturan GUEST_CART_MERGE_STRATEGY.
+func mergeGuestCart(db *gorm.DB, token string, userID uint) (int, error) {
+	merged := 0
+	err := db.Transaction(func(tx *gorm.DB) error {
+		guestCart, err := findGuestCart(tx, token)
+		if err != nil {
+			return err
+		}
+		var guestItems []models.CartItem
+		if err := tx.Where("cart_id = ?", guestCart.ID).Find(&guestItems).Error; err != nil {
+			return err
+		}
+
+		userCart, err := getOrCreateUserCart(userID, tx)
+		if err != nil {
+			return err
+		}
+
+		strategy := guestCartMergeStrategy()
+		for _, guestItem := range guestItems {
+			var userItem models.CartItem
+			result := tx.Where("cart_id = ? AND product_id = ?", userCart.ID, guestItem.ProductID).First(&userItem)
+			if result.Error == gorm.ErrRecordNotFound {
+				// Produk belum ada di keranjang user, pindahkan item apa adanya
+				if err := tx.Model(&guestItem).Update("cart_id", userCart.ID).Error; err != nil {
+					return err
+				}
+			} else if result.Error != nil {
+				return result.Error
+			} else {
+				quantity := mergeQuantity(strategy, userItem.Quantity, guestItem.Quantity)
+				if err := tx.Model(&userItem).Update("quantity", quantity).Error; err != nil {
+					return err
+				}
+				if err := tx.Delete(&guestItem).Error; err != nil {
+					return err
+				}
+			}
+			merged++
+		}
+
+		return tx.Delete(&guestCart).Error
+	})
+	return merged, err
+}
+
+// mergeGuestCartFromRequest menggabungkan keranjang tamu dari header saat SignIn/SignUp.
+// Kegagalan penggabungan tidak menggagalkan login.
+func mergeGuestCartFromRequest(c *gin.Context, userID uint) int {
+	token := c.GetHeader(CartTokenHeader)
+	if token == "" {
+		return 0
+	}
+	merged, err := mergeGuestCart(database.DB, token, userID)
+	if err != nil {
+		log.Printf("Warning: Gagal menggabungkan keranjang tamu: %v", err)
+		return 0
+	}
+	return merged
+}
+
+// Controller Handlers
+
+// GetGuestCart mengambil isi keranjang tamu berdasarkan header X-Cart-Token.
+// Route: GET /guest-cart
+func GetGuestCart(c *gin.Context) {
+	cart, err := findGuestCart(database.DB, c.GetHeader(CartTokenHeader))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"message": "Keranjang belanja kosong", "data": models.Cart{Items: []models.CartItem{}}})
+		return
+	}
+
+	var cartItem []models.CartItem
+	if err := database.DB.Preload("Product", preloadProductWithDeleted).Where("cart_id = ?", cart.ID).Find(&cartItem).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal mengambil keranjang"})
+		return
+	}
+	issues, err := revalidateCartItems(database.DB, cartItem)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal memeriksa keranjang"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":  "Detail keranjang berhasil diambil",
+		"data":     cart,
+		"dataCart": cartItem,
+		"revalidation": gin.H{
+			"issues": issues,
+		},
+	})
+}
+
+// AddToGuestCart menambahkan produk ke keranjang tamu. Jika belum punya token,
+// keranjang baru dibuat dan tokennya dikirim di body serta header X-Cart-Token.
+// Route: POST /guest-cart/create
+func AddToGuestCart(c *gin.Context) {
+	var input AddToCartInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Input tidak valid", "details": err.Error()})
+		return
+	}
+
+	// Cek produk dengan ProductID benar-benar ada
+	var product models.Product
+	if err := database.DB.First(&product, input.ProductID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Produk tidak ditemukan"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Kesalahan server saat memeriksa produk"})
+		return
+	}
+
+	cart, token, err := getOrCreateGuestCart(c, database.DB)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal mendapatkan/membuat keranjang"})
+		return
+	}
+
+	cartItem, created, err := addProductToCart(database.DB, cart.ID, product, input.Quantity)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal menambah item ke keranjang"})
+		return
+	}
+
+	status := http.StatusOK
+	if created {
+		status = http.StatusCreated
+	}
+	c.JSON(status, gin.H{
+		"message":   "Produk berhasil ditambahkan ke keranjang",
+		"cartToken": token,
+		"data":      cartItem,
+	})
+}
+
+// UpdateGuestCartItem memperbarui kuantitas item keranjang tamu.
+// Route: PUT /guest-cart/update/:id
+func UpdateGuestCartItem(c *gin.Context) {
+	cart, err := findGuestCart(database.DB, c.GetHeader(CartTokenHeader))
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Token keranjang tidak valid"})
+		return
+	}
+	cartItemID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID item keranjang tidak valid"})
+		return
+	}
+
+	var input UpdateCartItemInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Input kuantitas tidak valid", "details": err.Error()})
+		return
+	}
+
+	var cartItem models.CartItem
+	if err := database.DB.Where("id = ? AND cart_id = ?", cartItemID, cart.ID).First(&cartItem).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Item keranjang tidak ditemukan"})
+		return
+	}
+
+	if err := database.DB.Model(&cartItem).Update("quantity", input.Quantity).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal memperbarui kuantitas item"})
+		return
+	}
+
+	database.DB.Preload("Product").First(&cartItem, cartItem.ID)
+	c.JSON(http.StatusOK, gin.H{"message": "Kuantitas item keranjang berhasil diperbarui", "data": cartItem})
+}
+
+// DeleteGuestCartItem menghapus item dari keranjang tamu.
+// Route: DELETE /guest-cart/delete/:id
+func DeleteGuestCartItem(c *gin.Context) {
+	cart, err := findGuestCart(database.DB, c.GetHeader(CartTokenHeader))
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Token keranjang tidak valid"})
+		return
+	}
+	cartItemID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID item keranjang tidak valid"})
+		return
+	}
+
+	result := database.DB.Where("id = ? AND cart_id = ?", cartItemID, cart.ID).Delete(&models.CartItem{})
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal menghapus item dari keranjang"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Item keranjang tidak ditemukan"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Item keranjang berhasil dihapus"})
+}
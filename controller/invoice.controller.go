@@ -0,0 +1,339 @@
+package controller
+
+import (
+	"fmt"
+	"go-be/database"
+	"go-be/models"
+	"go-be/utils"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Helper Functions
+
+// orderIsPaid mengecek apakah pesanan sudah lunas dan boleh diberi faktur.
+func orderIsPaid(order models.Order) bool {
+	switch order.Status {
+	case models.OrderStatusPaid, models.OrderStatusPartiallyShipped, models.OrderStatusShipped, models.OrderStatusDelivered:
+		return true
+	}
+	return false
+}
+
+// formatRupiah menulis nominal dengan pemisah ribuan, contoh Rp1.250.000.
+func formatRupiah(amount int) string {
+	sign := ""
+	if amount < 0 {
+		sign = "-"
+		amount = -amount
+	}
+	digits := fmt.Sprintf("%d", amount)
+	var b strings.Builder
+	for i, d := range digits {
+		if i > 0 && (len(digits)-i)%3 == 0 {
+			b.WriteByte('.')
+		}
+		b.WriteRune(d)
+	}
+	return sign + "Rp" + b.String()
+}
+
+// issueInvoice menerbitkan faktur untuk pesanan jika belum ada.
+// Nomor urut diambil dari InvoiceSequence yang dikunci agar tidak ada nomor ganda atau lompat.
+func issueInvoice(tx *gorm.DB, order models.Order) (models.Invoice, error) {
+	var invoice models.Invoice
+	err := tx.Where("order_id = ?", order.ID).First(&invoice).Error
+	if err == nil {
+		return invoice, nil
+	}
+	if err != gorm.ErrRecordNotFound {
+		return invoice, err
+	}
+
+	now := time.Now()
+	year := now.Year()
+	sequence := models.InvoiceSequence{Year: year}
+	if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&sequence).Error; err != nil {
+		return invoice, err
+	}
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&sequence, "year = ?", year).Error; err != nil {
+		return invoice, err
+	}
+	sequence.LastNumber++
+	if err := tx.Model(&sequence).Update("last_number", sequence.LastNumber).Error; err != nil {
+		return invoice, err
+	}
+
+	var user models.User
+	if err := tx.Unscoped().Select("id", "name", "email").First(&user, order.UserID).Error; err != nil && err != gorm.ErrRecordNotFound {
+		return invoice, err
+	}
+	prefix := os.Getenv("INVOICE_PREFIX")
+	if prefix == "" {
+		prefix = "INV"
+	}
+	invoice = models.Invoice{
+		Number:        fmt.Sprintf("%s/%d/%06d", prefix, year, sequence.LastNumber),
+		Year:          year,
+		Sequence:      sequence.LastNumber,
+		OrderID:       order.ID,
+		IssuedAt:      now,
+		CustomerName:  user.Name,
+		CustomerEmail: user.Email,
+		CustomerTaxID: order.CustomerTaxID,
+		Total:         order.TotalPrice,
+	}
+	err = tx.Create(&invoice).Error
+	return invoice, err
+}
+
+// renderInvoicePDF menyusun faktur PDF: kop perusahaan, data pembeli, rincian barang,
+// PPN per tarif, ongkos kirim dan pembayaran.
+func renderInvoicePDF(invoice models.Invoice, order models.Order, items []models.CartItem, giftCards []models.GiftCard) []byte {
+	const left, right, bottom = 40.0, 555.0, 780.0
+	pdf := utils.NewPDF()
+	y := 60.0
+
+	// Kop perusahaan
+	companyName := os.Getenv("COMPANY_NAME")
+	if companyName == "" {
+		companyName = "Toko Furniture"
+	}
+	pdf.Text(left, y, 16, true, companyName)
+	pdf.TextRight(right, y, 20, true, "INVOICE")
+	headerY := y + 16
+	for _, line := range []string{os.Getenv("COMPANY_ADDRESS"), os.Getenv("COMPANY_PHONE"), os.Getenv("COMPANY_EMAIL")} {
+		if line != "" {
+			pdf.Text(left, headerY, 9, false, line)
+			headerY += 12
+		}
+	}
+	if taxID := os.Getenv("COMPANY_TAX_ID"); taxID != "" {
+		pdf.Text(left, headerY, 9, false, "NPWP: "+taxID)
+		headerY += 12
+	}
+
+	infoY := y + 16
+	for _, line := range []string{
+		"No. Faktur: " + invoice.Number,
+		"Tanggal: " + invoice.IssuedAt.Format("02/01/2006"),
+		"No. Pesanan: " + order.Number,
+		"Status: LUNAS",
+	} {
+		pdf.TextRight(right, infoY, 9, false, line)
+		infoY += 12
+	}
+
+	y = max(headerY, infoY) + 16
+	pdf.Line(left, y, right, y)
+	y += 18
+
+	// Data pembeli
+	pdf.Text(left, y, 10, true, "Ditagihkan kepada:")
+	y += 14
+	pdf.Text(left, y, 10, false, invoice.CustomerName)
+	y += 12
+	if invoice.CustomerEmail != "" {
+		pdf.Text(left, y, 9, false, invoice.CustomerEmail)
+		y += 12
+	}
+	if invoice.CustomerTaxID != "" {
+		pdf.Text(left, y, 9, false, "NPWP: "+invoice.CustomerTaxID)
+		y += 12
+	}
+	y += 14
+
+	// Tabel barang
+	tableHeader := func() {
+		pdf.Text(left, y, 9, true, "Produk")
+		pdf.TextRight(300, y, 9, true, "Qty")
+		pdf.TextRight(375, y, 9, true, "Harga")
+		pdf.TextRight(440, y, 9, true, "Diskon")
+		pdf.TextRight(495, y, 9, true, "PPN")
+		pdf.TextRight(right, y, 9, true, "Jumlah")
+		y += 6
+		pdf.Line(left, y, right, y)
+		y += 14
+	}
+	tableHeader()
+
+	taxes := map[uint]*TaxSummary{}
+	for _, item := range giftCards {
+		// Kode gift card tidak dicetak karena faktur bisa diteruskan ke orang lain
+		pdf.Text(left, y, 9, false, utils.FitText("Gift Card Digital "+item.RecipientName, 9, 210))
+		pdf.TextRight(300, y, 9, false, "1")
+		pdf.TextRight(375, y, 9, false, formatRupiah(int(item.InitialAmount)))
+		pdf.TextRight(440, y, 9, false, "-")
+		pdf.TextRight(495, y, 9, false, "-")
+		pdf.TextRight(right, y, 9, false, formatRupiah(int(item.InitialAmount)))
+		y += 16
+	}
+	for _, item := range items {
+		if y > bottom {
+			pdf.AddPage()
+			y = 60
+			tableHeader()
+		}
+		unitPrice, total := item.UnitPrice, item.LineTotal
+		// Item dari pesanan lama belum menyimpan rincian harga baris
+		if item.UnitPrice == 0 && item.LineTotal == 0 {
+			unitPrice, total = item.PriceAtAdd, item.PriceAtAdd*item.Quantity
+		}
+		taxLabel := "-"
+		if item.TaxRate > 0 {
+			taxLabel = fmt.Sprintf("%d%%", item.TaxRate)
+			summary, ok := taxes[item.TaxRate]
+			if !ok {
+				summary = &TaxSummary{Rate: item.TaxRate}
+				taxes[item.TaxRate] = summary
+			}
+			summary.Base += total - item.TaxAmount
+			summary.Amount += item.TaxAmount
+		}
+		pdf.Text(left, y, 9, false, utils.FitText(item.Product.Name, 9, 210))
+		pdf.TextRight(300, y, 9, false, fmt.Sprintf("%d", item.Quantity))
+		pdf.TextRight(375, y, 9, false, formatRupiah(int(unitPrice)))
+		pdf.TextRight(440, y, 9, false, formatRupiah(-int(item.DiscountAmount)))
+		pdf.TextRight(495, y, 9, false, taxLabel)
+		pdf.TextRight(right, y, 9, false, formatRupiah(int(total)))
+		y += 16
+	}
+	pdf.Line(left, y-8, right, y-8)
+	y += 8
+
+	// Ringkasan
+	if y > bottom-140 {
+		pdf.AddPage()
+		y = 60
+	}
+	summaryLine := func(label string, amount int, bold bool) {
+		pdf.Text(330, y, 9, bold, label)
+		pdf.TextRight(right, y, 9, bold, formatRupiah(amount))
+		y += 14
+	}
+	summaryLine("Subtotal", int(order.Subtotal), false)
+	if order.DiscountTotal > 0 {
+		summaryLine("Diskon", -int(order.DiscountTotal), false)
+	}
+	rates := make([]uint, 0, len(taxes))
+	for rate := range taxes {
+		rates = append(rates, rate)
+	}
+	sort.Slice(rates, func(i, j int) bool { return rates[i] < rates[j] })
+	for _, rate := range rates {
+		label := fmt.Sprintf("PPN %d%% (DPP %s)", rate, formatRupiah(int(taxes[rate].Base)))
+		if order.TaxInclusive {
+			label = fmt.Sprintf("PPN %d%% termasuk (DPP %s)", rate, formatRupiah(int(taxes[rate].Base)))
+		}
+		summaryLine(label, int(taxes[rate].Amount), false)
+	}
+	if len(rates) == 0 && order.TaxTotal > 0 {
+		summaryLine("PPN", int(order.TaxTotal), false)
+	}
+	if order.ShippingFee > 0 {
+		summaryLine("Ongkos Kirim", int(order.ShippingFee), false)
+	}
+	if order.ServiceFee > 0 {
+		summaryLine("Biaya Layanan", int(order.ServiceFee), false)
+	}
+	pdf.Line(330, y-8, right, y-8)
+	y += 2
+	summaryLine("Total", int(order.TotalPrice), true)
+	y += 6
+
+	// Pembayaran
+	if order.GiftCardAmount > 0 {
+		summaryLine("Dibayar dengan Gift Card", int(order.GiftCardAmount), false)
+	}
+	if order.StoreCreditAmount > 0 {
+		summaryLine("Dibayar dengan Saldo Toko", int(order.StoreCreditAmount), false)
+	}
+	if order.AmountDue() > 0 {
+		summaryLine("Dibayar via Duitku", int(order.AmountDue()), false)
+	}
+
+	y += 10
+	if order.Payment != "" {
+		pdf.Text(left, y, 9, false, "Metode pembayaran: "+order.Payment)
+		y += 12
+	}
+	if order.DuitkuReference != "" {
+		pdf.Text(left, y, 9, false, "Referensi pembayaran: "+order.DuitkuReference)
+		y += 12
+	}
+	if order.TaxExempt {
+		pdf.Text(left, y, 9, false, "Pembeli dibebaskan dari PPN.")
+		y += 12
+	} else if order.TaxInclusive {
+		pdf.Text(left, y, 9, false, "Harga sudah termasuk PPN.")
+		y += 12
+	}
+	pdf.Text(left, y+12, 8, false, "Faktur ini dibuat secara elektronik dan sah tanpa tanda tangan.")
+
+	return pdf.Bytes()
+}
+
+// Controller Handlers
+
+// GetOrderInvoice mengunduh faktur PDF pesanan yang sudah dibayar.
+// Faktur pesanan lama yang dibayar sebelum ada fitur faktur diterbitkan saat pertama diunduh.
+// Route: GET /oder/:number/invoice
+func GetOrderInvoice(c *gin.Context) {
+	Id, exists := c.Get("userId")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "harus login dulu"})
+		return
+	}
+	userID := utils.InterfaceToUint(Id)
+
+	var order models.Order
+	if err := database.DB.Scopes(userOrder(userID, c.Param("number"))).First(&order).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Pesanan tidak ditemukan atau bukan milik Anda"})
+		return
+	}
+	if !orderIsPaid(order) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Faktur hanya tersedia untuk pesanan yang sudah dibayar"})
+		return
+	}
+	if order.ReplacementOf != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Pesanan pengganti retur tidak memiliki faktur"})
+		return
+	}
+
+	var invoice models.Invoice
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		invoice, err = issueInvoice(tx, order)
+		return err
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal menerbitkan faktur"})
+		return
+	}
+
+	var items []models.CartItem
+	if err := database.DB.
+		Preload("Product", preloadProductWithDeleted).
+		Joins("JOIN carts ON carts.id = cart_items.cart_id").
+		Where("carts.order_id = ?", order.ID).
+		Find(&items).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal mengambil item pesanan"})
+		return
+	}
+	var giftCards []models.GiftCard
+	if err := database.DB.Where("order_id = ?", order.ID).Find(&giftCards).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal mengambil gift card pesanan"})
+		return
+	}
+
+	filename := strings.ReplaceAll(invoice.Number, "/", "-") + ".pdf"
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s", filename))
+	c.Data(http.StatusOK, "application/pdf", renderInvoicePDF(invoice, order, items, giftCards))
+}
@@ -0,0 +1,454 @@
+package controller
+
+import (
+	"errors"
+	"go-be/database"
+	"go-be/models"
+	"go-be/utils"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// errInsufficientPoints dikembalikan saat poin loyalitas user tidak cukup untuk ditukar.
+var errInsufficientPoints = errors.New("poin loyalitas tidak mencukupi")
+
+// Struct Input DTO
+
+// LoyaltyAdjustmentInput adalah penambahan atau koreksi poin loyalitas oleh admin.
+type LoyaltyAdjustmentInput struct {
+	Points int    `json:"points" binding:"required"` // negatif untuk mengurangi poin
+	Note   string `json:"note" binding:"required"`
+}
+
+// CategoryLoyaltyInput adalah tarif poin khusus kategori. loyaltyRate null berarti kembali ke tarif default.
+type CategoryLoyaltyInput struct {
+	LoyaltyRate *uint `json:"loyaltyRate"`
+}
+
+// Helper Functions
+
+// loyaltyEarnStatus adalah status pesanan yang memberikan poin, diatur lewat
+// LOYALTY_EARN_ON_STATUS ("Paid" atau "Delivered", default "Paid").
+func loyaltyEarnStatus() string {
+	if os.Getenv("LOYALTY_EARN_ON_STATUS") == models.OrderStatusDelivered {
+		return models.OrderStatusDelivered
+	}
+	return models.OrderStatusPaid
+}
+
+// loyaltyExpiry menghitung tanggal kedaluwarsa poin baru dari LOYALTY_POINTS_VALID_DAYS (default 365, 0 = tidak kedaluwarsa).
+func loyaltyExpiry(now time.Time) *time.Time {
+	validDays := utils.EnvUint("LOYALTY_POINTS_VALID_DAYS", 365)
+	if validDays == 0 {
+		return nil
+	}
+	expiresAt := now.AddDate(0, 0, int(validDays))
+	return &expiresAt
+}
+
+// loyaltyBalance menghitung saldo poin loyalitas user yang masih bisa dipakai, yaitu sisa poin masuk
+// yang belum kedaluwarsa. Poin yang sudah lewat masa berlaku tetapi belum dihanguskan tidak ikut dihitung,
+// sehingga saldo yang ditampilkan sama dengan yang bisa dipotong deductLoyaltyPoints.
+func loyaltyBalance(db *gorm.DB, userID uint) (int, error) {
+	_, total, err := usableLoyaltySources(db, userID)
+	return int(total), err
+}
+
+// addLoyaltyPoints mencatat poin masuk yang bisa dipakai dan kedaluwarsa.
+func addLoyaltyPoints(tx *gorm.DB, entry models.LoyaltyEntry) error {
+	entry.Remaining = uint(entry.Points)
+	if entry.ExpiresAt == nil {
+		entry.ExpiresAt = loyaltyExpiry(time.Now())
+	}
+	return tx.Create(&entry).Error
+}
+
+// usableLoyaltySources mengambil poin masuk yang masih tersisa dan belum kedaluwarsa,
+// mulai dari yang paling cepat kedaluwarsa.
+func usableLoyaltySources(tx *gorm.DB, userID uint) ([]models.LoyaltyEntry, uint, error) {
+	var sources []models.LoyaltyEntry
+	if err := tx.
+		Where("user_id = ? AND remaining > 0 AND (expires_at IS NULL OR expires_at > ?)", userID, time.Now()).
+		Order("expires_at ASC NULLS LAST, id ASC").
+		Find(&sources).Error; err != nil {
+		return nil, 0, err
+	}
+	var total uint
+	for _, source := range sources {
+		total += source.Remaining
+	}
+	return sources, total, nil
+}
+
+// usableLoyaltyPoints mengunci saldo user dan menghitung poin yang masih bisa dipakai.
+func usableLoyaltyPoints(tx *gorm.DB, userID uint) (uint, error) {
+	if err := lockUserBalance(tx, userID); err != nil {
+		return 0, err
+	}
+	_, total, err := usableLoyaltySources(tx, userID)
+	return total, err
+}
+
+// deductLoyaltyPoints mencatat poin keluar dan memakai sisa poin masuk mulai dari
+// yang paling cepat kedaluwarsa. Saldo dikunci dan dicek lebih dulu; jika sisa poin
+// kurang, tidak ada yang dicatat dan errInsufficientPoints dikembalikan.
+// ExpiresAt poin keluar diisi masa berlaku paling awal dari poin yang dipakai, agar poin yang
+// dikembalikan (refundRedeemedPoints) tidak mendapat masa berlaku baru.
+func deductLoyaltyPoints(tx *gorm.DB, entry models.LoyaltyEntry, points uint) error {
+	if err := lockUserBalance(tx, entry.UserID); err != nil {
+		return err
+	}
+	sources, total, err := usableLoyaltySources(tx, entry.UserID)
+	if err != nil {
+		return err
+	}
+	if total < points {
+		return errInsufficientPoints
+	}
+
+	used := map[uint]uint{}
+	remaining := points
+	for _, source := range sources {
+		if remaining == 0 {
+			break
+		}
+		used[source.ID] = min(source.Remaining, remaining)
+		remaining -= used[source.ID]
+		// Sumber diurutkan dari yang paling cepat kedaluwarsa, NULL (tanpa kedaluwarsa) di akhir
+		if entry.ExpiresAt == nil {
+			entry.ExpiresAt = source.ExpiresAt
+		}
+	}
+
+	entry.Points = -int(points)
+	if err := tx.Create(&entry).Error; err != nil {
+		return err
+	}
+	for _, source := range sources {
+		if used[source.ID] == 0 {
+			continue
+		}
+		if err := tx.Model(&source).Update("remaining", source.Remaining-used[source.ID]).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// orderLoyaltyPoints menghitung poin pesanan dari nilai baris setelah diskon.
+// Tarif default LOYALTY_EARN_RATE poin per LOYALTY_EARN_UNIT rupiah, bisa diganti per kategori.
+func orderLoyaltyPoints(tx *gorm.DB, order models.Order) (uint, error) {
+	items, err := orderCartItems(tx, order.ID)
+	if err != nil || len(items) == 0 {
+		return 0, err
+	}
+	earnUnit := utils.EnvUint("LOYALTY_EARN_UNIT", 10000)
+	defaultRate := utils.EnvUint("LOYALTY_EARN_RATE", 1)
+	if earnUnit == 0 {
+		return 0, nil
+	}
+
+	productIDs := make([]uint, 0, len(items))
+	for _, item := range items {
+		productIDs = append(productIDs, item.ProductID)
+	}
+	var products []models.Product
+	if err := tx.Unscoped().Select("id", "category_id").Where("id IN ?", productIDs).Find(&products).Error; err != nil {
+		return 0, err
+	}
+	productCategory := map[uint]uint{}
+	categoryIDs := make([]uint, 0, len(products))
+	for _, product := range products {
+		productCategory[product.ID] = product.CategoryID
+		categoryIDs = append(categoryIDs, product.CategoryID)
+	}
+	var categories []models.Category
+	if err := tx.Unscoped().Where("id IN ?", categoryIDs).Find(&categories).Error; err != nil {
+		return 0, err
+	}
+	categoryRate := map[uint]uint{}
+	for _, category := range categories {
+		if category.LoyaltyRate != nil {
+			categoryRate[category.ID] = *category.LoyaltyRate
+		}
+	}
+
+	var points uint
+	for _, item := range items {
+		// Item dari pesanan lama belum menyimpan rincian harga baris
+		net := item.PriceAtAdd * item.Quantity
+		if item.UnitPrice != 0 {
+			net = item.UnitPrice*item.Quantity - item.DiscountAmount
+		}
+		rate, ok := categoryRate[productCategory[item.ProductID]]
+		if !ok {
+			rate = defaultRate
+		}
+		points += net * rate / earnUnit
+	}
+	return points, nil
+}
+
+// awardLoyaltyPoints memberikan poin untuk pesanan yang mencapai status pemberi poin.
+// Pesanan yang sudah mendapat poin dilewati.
+func awardLoyaltyPoints(tx *gorm.DB, order *models.Order) error {
+	if order.LoyaltyPoints > 0 {
+		return nil
+	}
+	points, err := orderLoyaltyPoints(tx, *order)
+	if err != nil || points == 0 {
+		return err
+	}
+	orderID := order.ID
+	if err := addLoyaltyPoints(tx, models.LoyaltyEntry{
+		UserID:  order.UserID,
+		Points:  int(points),
+		Reason:  models.LoyaltyReasonEarn,
+		OrderID: &orderID,
+	}); err != nil {
+		return err
+	}
+	order.LoyaltyPoints = points
+	return tx.Model(order).Update("loyalty_points", points).Error
+}
+
+// clawbackLoyaltyPoints menarik poin pesanan sebanyak yang masih tersisa di saldo user.
+// Poin yang sudah terpakai atau kedaluwarsa tidak bisa ditarik, dan pesanan tetap bisa dibatalkan atau diretur.
+func clawbackLoyaltyPoints(tx *gorm.DB, order *models.Order, points uint) error {
+	available, err := usableLoyaltyPoints(tx, order.UserID)
+	if err != nil {
+		return err
+	}
+	points = min(points, available)
+	if points == 0 {
+		return nil
+	}
+	orderID := order.ID
+	return deductLoyaltyPoints(tx, models.LoyaltyEntry{
+		UserID:  order.UserID,
+		Reason:  models.LoyaltyReasonReverse,
+		OrderID: &orderID,
+	}, points)
+}
+
+// reverseLoyaltyPoints menarik kembali poin yang didapat dari pesanan yang gagal atau dikembalikan.
+func reverseLoyaltyPoints(tx *gorm.DB, order *models.Order) error {
+	if order.LoyaltyPoints == 0 {
+		return nil
+	}
+	if err := clawbackLoyaltyPoints(tx, order, order.LoyaltyPoints); err != nil {
+		return err
+	}
+	order.LoyaltyPoints = 0
+	return tx.Model(order).Update("loyalty_points", 0).Error
+}
+
+// reverseRefundedLoyaltyPoints menarik poin pesanan sebanding dengan nilai yang dikembalikan (retur).
+func reverseRefundedLoyaltyPoints(tx *gorm.DB, order *models.Order, refundAmount uint) error {
+	if order.LoyaltyPoints == 0 || order.TotalPrice == 0 {
+		return nil
+	}
+	points := order.LoyaltyPoints * refundAmount / order.TotalPrice
+	if points > order.LoyaltyPoints {
+		points = order.LoyaltyPoints
+	}
+	if points == 0 {
+		return nil
+	}
+	if err := clawbackLoyaltyPoints(tx, order, points); err != nil {
+		return err
+	}
+	order.LoyaltyPoints -= points
+	return tx.Model(order).Update("loyalty_points", order.LoyaltyPoints).Error
+}
+
+// redeemLoyaltyPoints memotong poin yang ditukar menjadi diskon pesanan.
+// Penukaran gagal dengan errInsufficientPoints saat saldo tidak cukup.
+func redeemLoyaltyPoints(tx *gorm.DB, order models.Order) error {
+	if order.LoyaltyPointsUsed == 0 {
+		return nil
+	}
+	orderID := order.ID
+	return deductLoyaltyPoints(tx, models.LoyaltyEntry{
+		UserID:  order.UserID,
+		Reason:  models.LoyaltyReasonRedeem,
+		OrderID: &orderID,
+	}, order.LoyaltyPointsUsed)
+}
+
+// refundRedeemedPoints mengembalikan poin yang ditukar pada pesanan yang gagal.
+func refundRedeemedPoints(tx *gorm.DB, order models.Order) error {
+	if order.LoyaltyPointsUsed == 0 {
+		return nil
+	}
+	// Poin kembali dengan masa berlaku poin yang ditukar, bukan masa berlaku baru
+	var redeemed models.LoyaltyEntry
+	if err := tx.Where("order_id = ? AND reason = ?", order.ID, models.LoyaltyReasonRedeem).
+		Order("id DESC").
+		First(&redeemed).Error; err != nil && err != gorm.ErrRecordNotFound {
+		return err
+	}
+	orderID := order.ID
+	return addLoyaltyPoints(tx, models.LoyaltyEntry{
+		UserID:    order.UserID,
+		Points:    int(order.LoyaltyPointsUsed),
+		Reason:    models.LoyaltyReasonOrderRefund,
+		OrderID:   &orderID,
+		ExpiresAt: redeemed.ExpiresAt,
+	})
+}
+
+// expireLoyaltyPoints menghanguskan sisa poin yang sudah lewat masa berlakunya.
+func expireLoyaltyPoints(db *gorm.DB, now time.Time) error {
+	var expired []models.LoyaltyEntry
+	if err := db.Where("remaining > 0 AND expires_at <= ?", now).Find(&expired).Error; err != nil {
+		return err
+	}
+	for _, entry := range expired {
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Create(&models.LoyaltyEntry{
+				UserID: entry.UserID,
+				Points: -int(entry.Remaining),
+				Reason: models.LoyaltyReasonExpire,
+			}).Error; err != nil {
+				return err
+			}
+			return tx.Model(&entry).Update("remaining", 0).Error
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RunLoyaltyScheduler menghanguskan poin kedaluwarsa setiap jam. Dijalankan sebagai goroutine dari main.
+func RunLoyaltyScheduler() {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+	for {
+		if err := expireLoyaltyPoints(database.DB, time.Now()); err != nil {
+			log.Printf("Warning: Gagal menghanguskan poin loyalitas: %v", err)
+		}
+		<-ticker.C
+	}
+}
+
+// Controller Handlers
+
+// GetLoyalty mengambil saldo poin loyalitas, poin yang akan kedaluwarsa, dan riwayatnya.
+// Route: GET /users/loyalty
+func GetLoyalty(c *gin.Context) {
+	Id, exists := c.Get("userId")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "harus login dulu"})
+		return
+	}
+	userID := utils.InterfaceToUint(Id)
+
+	balance, err := loyaltyBalance(database.DB, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal menghitung poin loyalitas"})
+		return
+	}
+
+	var expiringSoon uint
+	now := time.Now()
+	database.DB.Model(&models.LoyaltyEntry{}).
+		Where("user_id = ? AND remaining > 0 AND expires_at > ? AND expires_at <= ?", userID, now, now.AddDate(0, 0, 30)).
+		Select("COALESCE(SUM(remaining), 0)").
+		Scan(&expiringSoon)
+
+	var entries []models.LoyaltyEntry
+	if err := database.DB.Where("user_id = ?", userID).Order("created_at DESC").Find(&entries).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal mengambil riwayat poin loyalitas"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":      "Poin loyalitas berhasil diambil",
+		"balance":      balance,
+		"pointValue":   utils.EnvUint("LOYALTY_POINT_VALUE", 100),
+		"expiringSoon": expiringSoon, // poin yang hangus dalam 30 hari
+		"data":         entries,
+	})
+}
+
+// AdjustLoyaltyPoints menambah atau mengoreksi poin loyalitas user oleh admin.
+// Route: POST /user-admin/loyalty/:id
+func AdjustLoyaltyPoints(c *gin.Context) {
+	Id, _ := c.Get("userId")
+	adminID := utils.InterfaceToUint(Id)
+
+	var user models.User
+	if err := database.DB.First(&user, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+		return
+	}
+
+	var input LoyaltyAdjustmentInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Input tidak valid", "details": err.Error()})
+		return
+	}
+
+	var balance int
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		entry := models.LoyaltyEntry{
+			UserID:      user.ID,
+			Points:      input.Points,
+			Reason:      models.LoyaltyReasonAdjustment,
+			Note:        input.Note,
+			CreatedByID: &adminID,
+		}
+		var err error
+		if input.Points > 0 {
+			err = addLoyaltyPoints(tx, entry)
+		} else {
+			err = deductLoyaltyPoints(tx, entry, uint(-input.Points))
+		}
+		if err != nil {
+			return err
+		}
+		balance, err = loyaltyBalance(tx, user.ID)
+		return err
+	})
+	if err == errInsufficientPoints {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Poin loyalitas user tidak mencukupi"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal memperbarui poin loyalitas"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Poin loyalitas berhasil diperbarui", "balance": balance})
+}
+
+// UpdateCategoryLoyaltyRate mengatur tarif poin khusus untuk sebuah kategori.
+// Route: PUT /category-admin/loyalty/:id
+func UpdateCategoryLoyaltyRate(c *gin.Context) {
+	var category models.Category
+	if err := database.DB.First(&category, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "category tidak ditemukan"})
+		return
+	}
+
+	var input CategoryLoyaltyInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Input tidak valid", "details": err.Error()})
+		return
+	}
+
+	if err := database.DB.Model(&category).Update("loyalty_rate", input.LoyaltyRate).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal memperbarui tarif poin kategori"})
+		return
+	}
+	category.LoyaltyRate = input.LoyaltyRate
+
+	c.JSON(http.StatusOK, gin.H{"message": "Tarif poin kategori berhasil diperbarui", "data": category})
+}
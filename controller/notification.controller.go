@@ -0,0 +1,81 @@
+package controller
+
+import (
+	"go-be/database"
+	"go-be/models"
+	"go-be/utils"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Helper Functions
+
+// notifyUser menyimpan notifikasi in-app untuk user tertentu.
+func notifyUser(db *gorm.DB, userID uint, notifType string, message string, link string) error {
+	notification := models.Notification{
+		UserID:  userID,
+		Type:    notifType,
+		Message: message,
+		Link:    link,
+	}
+	return db.Create(&notification).Error
+}
+
+// Controller Handlers
+
+// GetNotifications mengambil notifikasi milik pengguna, yang terbaru lebih dulu.
+// Route: GET /users/notifications
+func GetNotifications(c *gin.Context) {
+	Id, exists := c.Get("userId")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "harus login dulu"})
+		return
+	}
+	userID := utils.InterfaceToUint(Id)
+
+	query := database.DB.Where("user_id = ?", userID)
+	if c.Query("unread") == "true" {
+		query = query.Where("read_at IS NULL")
+	}
+
+	var notifications []models.Notification
+	if err := query.Order("created_at DESC").Limit(100).Find(&notifications).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal mengambil notifikasi"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Daftar notifikasi berhasil diambil",
+		"data":    notifications,
+	})
+}
+
+// MarkNotificationRead menandai satu notifikasi sebagai sudah dibaca.
+// Route: PUT /users/notifications/read/:id
+func MarkNotificationRead(c *gin.Context) {
+	Id, exists := c.Get("userId")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "harus login dulu"})
+		return
+	}
+	userID := utils.InterfaceToUint(Id)
+	notificationID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID notifikasi tidak valid"})
+		return
+	}
+
+	result := database.DB.Model(&models.Notification{}).
+		Where("id = ? AND user_id = ? AND read_at IS NULL", notificationID, userID).
+		Update("read_at", time.Now())
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal memperbarui notifikasi"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Notifikasi ditandai sudah dibaca"})
+}
@@ -0,0 +1,227 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"go-be/database"
+	"go-be/models"
+	"go-be/utils"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// oidcStateTTL adalah batas waktu menyelesaikan login di halaman provider.
+const oidcStateTTL = 10 * time.Minute
+
+// oidcStateCookie menyimpan nilai pengikat state di browser yang memulai login, agar callback
+// dengan state milik orang lain (login CSRF) ditolak.
+const oidcStateCookie = "oidc_state"
+
+// errOIDCEmailRequired dikembalikan saat provider tidak mengirim email yang bisa dipakai untuk akun baru.
+var errOIDCEmailRequired = errors.New("provider tidak mengirim email terverifikasi")
+
+// errOIDCAccountUnverified dikembalikan saat email provider cocok dengan akun lokal yang emailnya belum
+// diverifikasi. Akun seperti itu bisa saja didaftarkan orang lain lebih dulu, sehingga tidak dihubungkan.
+var errOIDCAccountUnverified = errors.New("akun dengan email ini belum diverifikasi")
+
+// Struct Input DTO
+
+// OIDCCallbackInput adalah code dan state yang diterima frontend dari redirect provider.
+type OIDCCallbackInput struct {
+	Code  string `json:"code" binding:"required"`
+	State string `json:"state" binding:"required"`
+}
+
+// oidcLoginState disimpan di Redis selama user login di halaman provider.
+type oidcLoginState struct {
+	Provider     string `json:"provider"`
+	Nonce        string `json:"nonce"`
+	CodeVerifier string `json:"codeVerifier"`
+	BrowserHash  string `json:"browserHash"` // hash nilai cookie oidc_state
+}
+
+// Helper Functions
+
+func oidcStateKey(state string) string {
+	return "oidc:state:" + state
+}
+
+// findOIDCProvider mengambil provider yang dikonfigurasi berdasarkan nama di URL.
+func findOIDCProvider(c *gin.Context) (*utils.OIDCProvider, bool) {
+	provider, ok := utils.OIDCProviders()[strings.ToLower(c.Param("provider"))]
+	return provider, ok
+}
+
+// findOrCreateOIDCUser mencari user yang terhubung dengan identitas provider. Jika belum ada,
+// identitas dihubungkan ke user dengan email yang sama (hanya jika email terverifikasi di provider
+// dan di akun lokal) atau user baru dibuat.
+func findOrCreateOIDCUser(provider string, identity utils.OIDCIdentity) (models.User, error) {
+	var user models.User
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		var link models.UserIdentity
+		err := tx.Where("provider = ? AND subject = ?", provider, identity.Subject).First(&link).Error
+		if err == nil {
+			if err := tx.First(&user, link.UserID).Error; err != nil {
+				return err
+			}
+			return tx.Model(&link).Updates(map[string]interface{}{"email": identity.Email, "last_login_at": time.Now()}).Error
+		}
+		if err != gorm.ErrRecordNotFound {
+			return err
+		}
+
+		// Email yang belum diverifikasi provider tidak boleh dipakai untuk mengambil alih akun yang ada
+		email := utils.NormalizeEmail(identity.Email)
+		if email == "" || !identity.EmailVerified {
+			return errOIDCEmailRequired
+		}
+		err = tx.Where("LOWER(email) = ?", email).First(&user).Error
+		if err == nil && user.EmailVerifiedAt == nil {
+			return errOIDCAccountUnverified
+		}
+		if err == gorm.ErrRecordNotFound {
+			name := identity.Name
+			if name == "" {
+				name = strings.Split(email, "@")[0]
+			}
+			now := time.Now()
+			// Password kosong: akun hanya bisa login lewat provider sampai user membuat password lewat reset password
+			user = models.User{Name: name, Email: email, Role: "user", EmailVerifiedAt: &now}
+			err = tx.Create(&user).Error
+		}
+		if err != nil {
+			return err
+		}
+
+		return tx.Create(&models.UserIdentity{
+			UserID:      user.ID,
+			Provider:    provider,
+			Subject:     identity.Subject,
+			Email:       email,
+			LastLoginAt: time.Now(),
+		}).Error
+	})
+	return user, err
+}
+
+// Controller Handlers
+
+// GetOIDCProviders menampilkan nama provider login yang tersedia untuk ditampilkan sebagai tombol login.
+// Route: GET /auth/oidc
+func GetOIDCProviders(c *gin.Context) {
+	names := []string{}
+	for name := range utils.OIDCProviders() {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	c.JSON(http.StatusOK, gin.H{"message": "Daftar provider login berhasil diambil", "data": names})
+}
+
+// StartOIDCLogin memulai authorization code flow dengan PKCE. Frontend mengarahkan user ke
+// authorizationUrl, lalu provider mengembalikan user ke OIDC_<NAMA>_REDIRECT_URL dengan code dan state.
+// State diikat ke browser lewat cookie oidc_state yang harus ikut terkirim saat callback.
+// Route: GET /auth/oidc/:provider/login
+func StartOIDCLogin(c *gin.Context) {
+	provider, ok := findOIDCProvider(c)
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Provider login tidak ditemukan"})
+		return
+	}
+
+	state, errState := utils.RandomToken(16)
+	nonce, errNonce := utils.RandomToken(16)
+	verifier, errVerifier := utils.RandomToken(32)
+	browser, errBrowser := utils.RandomToken(16)
+	if errState != nil || errNonce != nil || errVerifier != nil || errBrowser != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal memulai login"})
+		return
+	}
+
+	authURL, err := provider.AuthorizationURL(state, nonce, verifier)
+	if err != nil {
+		log.Printf("Warning: Gagal mengambil konfigurasi provider %s: %v", provider.Name, err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Provider login tidak dapat dihubungi"})
+		return
+	}
+
+	payload, _ := json.Marshal(oidcLoginState{
+		Provider:     provider.Name,
+		Nonce:        nonce,
+		CodeVerifier: verifier,
+		BrowserHash:  utils.HashToken(browser),
+	})
+	if err := utils.RedisClient.Set(context.Background(), oidcStateKey(state), payload, oidcStateTTL).Err(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal memulai login"})
+		return
+	}
+	// Frontend harus mengirim cookie ini (credentials: "include") saat memanggil callback
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(oidcStateCookie, browser, int(oidcStateTTL.Seconds()), "/auth/oidc", "",
+		utils.EnvBool("OIDC_COOKIE_SECURE", c.Request.TLS != nil), true)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Arahkan user ke authorizationUrl",
+		"data": gin.H{
+			"authorizationUrl": authURL,
+			"state":            state,
+		},
+	})
+}
+
+// OIDCCallback menyelesaikan login provider: menukar code (dengan code_verifier PKCE), memverifikasi
+// ID token, menghubungkan atau membuat user lalu mengirim token seperti /sign-in.
+// Route: POST /auth/oidc/:provider/callback
+func OIDCCallback(c *gin.Context) {
+	provider, ok := findOIDCProvider(c)
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Provider login tidak ditemukan"})
+		return
+	}
+
+	var input OIDCCallbackInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Input tidak valid", "details": err.Error()})
+		return
+	}
+
+	// State hanya bisa dipakai sekali
+	payload, err := utils.RedisClient.GetDel(context.Background(), oidcStateKey(input.State)).Bytes()
+	var state oidcLoginState
+	browser, _ := c.Cookie(oidcStateCookie)
+	if err != nil || json.Unmarshal(payload, &state) != nil || state.Provider != provider.Name ||
+		browser == "" || utils.HashToken(browser) != state.BrowserHash {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Sesi login tidak valid atau sudah kedaluwarsa, silakan ulangi"})
+		return
+	}
+	c.SetCookie(oidcStateCookie, "", -1, "/auth/oidc", "", utils.EnvBool("OIDC_COOKIE_SECURE", c.Request.TLS != nil), true)
+
+	identity, err := provider.Exchange(input.Code, state.CodeVerifier, state.Nonce)
+	if err != nil {
+		log.Printf("Warning: Login %s gagal: %v", provider.Name, err)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Login dengan provider gagal"})
+		return
+	}
+
+	user, err := findOrCreateOIDCUser(provider.Name, identity)
+	if err == errOIDCEmailRequired {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Akun provider harus memiliki email terverifikasi"})
+		return
+	}
+	if err == errOIDCAccountUnverified {
+		c.JSON(http.StatusConflict, gin.H{"error": "Email sudah terdaftar tetapi belum diverifikasi. Verifikasi email atau reset password terlebih dahulu, lalu login kembali dengan provider"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal menyimpan akun"})
+		return
+	}
+
+	beginSignIn(c, user)
+}
@@ -1,16 +1,253 @@
 package controller
 
 import (
+	"errors"
+	"fmt"
 	"go-be/database"
 	"go-be/models"
 	"go-be/utils"
+	"io"
+	"log"
 	"net/http"
-	"strconv"
+	"os"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
+// errOutOfStock dikembalikan saat stok produk habis ketika checkout berlangsung.
+var errOutOfStock = errors.New("stok produk tidak mencukupi")
+
+// errCartCheckedOut dikembalikan saat keranjang yang sama sudah menjadi pesanan oleh checkout lain.
+var errCartCheckedOut = errors.New("keranjang sudah di-checkout")
+
+// Helper Functions
+
+// generateOrderNumber membuat nomor pesanan berformat PREFIX-YYYYMMDD-XXXX.
+// Bagian acak membuat nomor tidak berurutan sehingga jumlah pesanan tidak terbaca dari luar.
+// Keunikan dijamin unique index; lihat createOrderWithNumber.
+func generateOrderNumber(date time.Time) (string, error) {
+	prefix := os.Getenv("ORDER_NUMBER_PREFIX")
+	if prefix == "" {
+		prefix = "FS"
+	}
+	code, err := utils.RandomCode(4)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s-%s-%s", prefix, date.Format("20060102"), code), nil
+}
+
+// createOrderWithNumber menyimpan pesanan baru dengan nomor pesanan acak. Jika nomor bentrok dengan
+// pesanan lain (termasuk yang dibuat bersamaan), insert dibatalkan ke savepoint dan dicoba dengan nomor baru.
+func createOrderWithNumber(tx *gorm.DB, order *models.Order, date time.Time) error {
+	for attempt := 0; attempt < 5; attempt++ {
+		number, err := generateOrderNumber(date)
+		if err != nil {
+			return err
+		}
+		order.Number = number
+		if err := tx.SavePoint("create_order").Error; err != nil {
+			return err
+		}
+		err = tx.Create(order).Error
+		if err == nil {
+			return nil
+		}
+		if !utils.IsUniqueViolation(err) {
+			return err
+		}
+		if err := tx.RollbackTo("create_order").Error; err != nil {
+			return err
+		}
+		order.ID = 0
+	}
+	return errors.New("gagal membuat nomor pesanan unik")
+}
+
+// userOrder membatasi query ke pesanan milik user berdasarkan nomor pesanan di URL,
+// sehingga ID pesanan yang berurutan tidak dipakai di route pelanggan.
+func userOrder(userID uint, number string) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where("user_id = ? AND number = ?", userID, number)
+	}
+}
+
+// orderNumber mengambil nomor pesanan untuk ditampilkan di notifikasi.
+func orderNumber(db *gorm.DB, orderID uint) string {
+	var number string
+	db.Unscoped().Model(&models.Order{}).Select("number").Where("id = ?", orderID).Scan(&number)
+	if number == "" {
+		return fmt.Sprintf("#%d", orderID)
+	}
+	return number
+}
+
+// BackfillOrderNumbers memberi nomor pesanan pada pesanan lama yang dibuat sebelum ada nomor pesanan.
+// Dipanggil sekali saat aplikasi mulai, setelah migrasi.
+func BackfillOrderNumbers() error {
+	var orders []models.Order
+	if err := database.DB.Unscoped().Select("id", "created_at").
+		Where("number IS NULL OR number = ''").
+		Find(&orders).Error; err != nil {
+		return err
+	}
+	for _, order := range orders {
+		var err error
+		for attempt := 0; attempt < 5; attempt++ {
+			var number string
+			if number, err = generateOrderNumber(order.CreatedAt); err != nil {
+				return err
+			}
+			err = database.DB.Unscoped().Model(&order).UpdateColumn("number", number).Error
+			if !utils.IsUniqueViolation(err) {
+				break
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// orderCartItems mengambil semua item keranjang yang terikat pada sebuah pesanan.
+func orderCartItems(db *gorm.DB, orderID uint) ([]models.CartItem, error) {
+	var items []models.CartItem
+	err := db.
+		Joins("JOIN carts ON carts.id = cart_items.cart_id").
+		Where("carts.order_id = ?", orderID).
+		Find(&items).Error
+	return items, err
+}
+
+// reserveStock mengurangi stok produk yang dilacak untuk item pesanan.
+// Pengurangan gagal dengan errOutOfStock saat stok tidak cukup, termasuk saat pesanan
+// yang gagal diaktifkan kembali, agar stok tidak pernah terjual melebihi persediaan.
+func reserveStock(tx *gorm.DB, items []models.CartItem) error {
+	for _, item := range items {
+		var product models.Product
+		if err := tx.Select("id", "stock").First(&product, item.ProductID).Error; err != nil {
+			return err
+		}
+		if product.Stock == nil {
+			continue
+		}
+		// Update bersyarat agar dua checkout bersamaan tidak membuat stok minus
+		result := tx.Model(&models.Product{}).
+			Where("id = ? AND stock >= ?", item.ProductID, item.Quantity).
+			UpdateColumn("stock", gorm.Expr("stock - ?", item.Quantity))
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errOutOfStock
+		}
+	}
+	return nil
+}
+
+// releaseStock mengembalikan stok produk yang dilacak untuk item pesanan.
+func releaseStock(tx *gorm.DB, items []models.CartItem) error {
+	for _, item := range items {
+		if err := tx.Model(&models.Product{}).
+			Where("id = ? AND stock IS NOT NULL", item.ProductID).
+			UpdateColumn("stock", gorm.Expr("stock + ?", item.Quantity)).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// updateOrderStatus mengubah status pesanan dan menjalankan efek sampingnya,
+// misalnya mengembalikan stok saat pembayaran gagal.
+func updateOrderStatus(tx *gorm.DB, order *models.Order, newStatus string) error {
+	oldStatus := order.Status
+	if oldStatus == newStatus {
+		return nil
+	}
+	if err := tx.Model(order).Update("status", newStatus).Error; err != nil {
+		return err
+	}
+	if newStatus == models.OrderStatusDelivered && order.DeliveredAt == nil {
+		now := time.Now()
+		order.DeliveredAt = &now
+		if err := tx.Model(order).Update("delivered_at", now).Error; err != nil {
+			return err
+		}
+	}
+
+	items, err := orderCartItems(tx, order.ID)
+	if err != nil {
+		return err
+	}
+	if newStatus == models.OrderStatusFailed {
+		// Lepas kuota kupon/promo agar bisa dipakai lagi
+		if err := tx.Where("order_id = ?", order.ID).Delete(&models.Redemption{}).Error; err != nil {
+			return err
+		}
+		if err := releaseStock(tx, items); err != nil {
+			return err
+		}
+		// Kembalikan saldo gift card/saldo toko dan batalkan gift card yang dibeli
+		if err := refundOrderCredits(tx, *order); err != nil {
+			return err
+		}
+		if err := cancelPurchasedGiftCards(tx, *order); err != nil {
+			return err
+		}
+		// Tarik poin yang didapat dan kembalikan poin yang ditukar
+		if err := reverseLoyaltyPoints(tx, order); err != nil {
+			return err
+		}
+		return refundRedeemedPoints(tx, *order)
+	}
+	if oldStatus == models.OrderStatusFailed {
+		// Pesanan yang sempat gagal kembali aktif, ambil lagi stok, kupon/promo dan saldonya
+		if err := tx.Unscoped().Model(&models.Redemption{}).
+			Where("order_id = ?", order.ID).
+			Update("deleted_at", nil).Error; err != nil {
+			return err
+		}
+		if err := reserveStock(tx, items); err != nil {
+			return err
+		}
+		if err := reapplyOrderCredits(tx, *order); err != nil {
+			return err
+		}
+		if err := redeemLoyaltyPoints(tx, *order); err != nil {
+			return err
+		}
+	}
+	if newStatus == models.OrderStatusPaid {
+		if err := activatePurchasedGiftCards(tx, *order); err != nil {
+			return err
+		}
+		// Faktur resmi diterbitkan begitu pesanan lunas
+		if _, err := issueInvoice(tx, *order); err != nil {
+			return err
+		}
+	}
+	if newStatus == loyaltyEarnStatus() {
+		return awardLoyaltyPoints(tx, order)
+	}
+	return nil
+}
+
+// Struct Input DTO
+
+// CheckoutPaymentInput adalah pilihan pembayaran opsional saat checkout.
+// Poin loyalitas ditukar menjadi diskon; sisa tagihan setelah gift card dan saldo toko dibayar lewat Duitku.
+type CheckoutPaymentInput struct {
+	GiftCardCode   string `json:"giftCardCode"`
+	UseStoreCredit bool   `json:"useStoreCredit"`
+	LoyaltyPoints  uint   `json:"loyaltyPoints"`
+}
+
+// Controller Handlers
+
 func Checkout(c *gin.Context) {
 	Id, exists := c.Get("userId")
 	if !exists {
@@ -19,6 +256,13 @@ func Checkout(c *gin.Context) {
 	}
 	userID := utils.InterfaceToUint(Id)
 
+	// Body boleh kosong jika tidak memakai gift card atau saldo toko
+	var payment CheckoutPaymentInput
+	if err := c.ShouldBindJSON(&payment); err != nil && err != io.EOF {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Input tidak valid", "details": err.Error()})
+		return
+	}
+
 	var user models.User
 
 	if err := database.DB.Preload("Address").First(&user, userID).Error; err != nil {
@@ -28,7 +272,7 @@ func Checkout(c *gin.Context) {
 	var activeCart models.Cart
 	// Cari Cart Aktif (order_id IS NULL)
 	err := database.DB.
-		Preload("Items.Product").
+		Preload("Items.Product", preloadProductWithDeleted).
 		Where("user_id = ? AND order_id IS NULL", userID).
 		First(&activeCart).Error
 
@@ -48,54 +292,198 @@ func Checkout(c *gin.Context) {
 		return
 	}
 
-	// Hitung Total Harga dan Total Kuantitas
-	var totalPrice uint = 0
-	var totalQuantity uint = 0
-	for _, item := range activeCart.Items {
-		totalPrice += item.Product.Price * item.Quantity
-		totalQuantity += item.Quantity
+	// Harga, stok, atau produk berubah sejak ditambahkan: pengguna harus konfirmasi dulu
+	issues, err := revalidateCartItems(database.DB, activeCart.Items)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal memeriksa keranjang"})
+		return
+	}
+	if len(issues) > 0 {
+		c.JSON(http.StatusConflict, gin.H{
+			"error":      "Keranjang berubah sejak terakhir dilihat, konfirmasi perubahan terlebih dahulu",
+			"issues":     issues,
+			"issuesHash": cartIssuesHash(issues),
+		})
+		return
+	}
+
+	if payment.LoyaltyPoints > 0 {
+		balance, err := loyaltyBalance(database.DB, userID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal menghitung poin loyalitas"})
+			return
+		}
+		if balance < int(payment.LoyaltyPoints) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Poin loyalitas tidak mencukupi", "balance": balance})
+			return
+		}
+	}
+
+	// Hitung rincian harga dengan mesin harga yang sama dengan keranjang
+	pricing, err := calculateCartPricing(database.DB, pricingRequest{
+		UserID:        userID,
+		Items:         activeCart.Items,
+		CouponCode:    activeCart.CouponCode,
+		LoyaltyPoints: payment.LoyaltyPoints,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal menghitung total pesanan"})
+		return
+	}
+	if pricing.CouponError != "" {
+		c.JSON(http.StatusConflict, gin.H{"error": pricing.CouponError, "pricing": pricing})
+		return
 	}
 
 	var newOrder models.Order
 	// Mulai Transaksi GORM
 	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		//  Kunci keranjang agar dua checkout bersamaan tidak memproses keranjang yang sama
+		var lockedCart models.Cart
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id = ? AND order_id IS NULL", activeCart.ID).
+			First(&lockedCart).Error; err == gorm.ErrRecordNotFound {
+			return errCartCheckedOut
+		} else if err != nil {
+			return err
+		}
+
 		//  Buat Order Baru (Status default harus "Pending")
 		newOrder = models.Order{
-			UserID:     userID,
-			TotalPrice: totalPrice,
-			Quantity:   totalQuantity,
-			Status:     "Pending", // Set status awal
+			UserID:            userID,
+			Subtotal:          pricing.Subtotal,
+			DiscountTotal:     pricing.Discount + pricing.ShippingDiscount,
+			CouponCode:        activeCart.CouponCode,
+			TaxTotal:          pricing.Tax,
+			TaxInclusive:      pricing.TaxInclusive,
+			TaxExempt:         pricing.TaxExempt,
+			CustomerTaxID:     user.TaxID,
+			ShippingFee:       pricing.Shipping,
+			ServiceFee:        pricing.Services,
+			TotalPrice:        pricing.GrandTotal,
+			LoyaltyPointsUsed: pricing.LoyaltyPoints,
+			LoyaltyDiscount:   pricing.LoyaltyDiscount,
+			Quantity:          pricing.Quantity,
+			Status:            models.OrderStatusPending, // Set status awal
 		}
-		if err := tx.Create(&newOrder).Error; err != nil {
+		if err := createOrderWithNumber(tx, &newOrder, time.Now()); err != nil {
 			return err
 		}
 
-		//  Kaitkan Cart Aktif dengan Order Baru
-		if err := tx.Model(&activeCart).
-			Select("OrderID").
-			Updates(models.Cart{OrderID: &newOrder.ID}).Error; err != nil {
+		//  Simpan rincian harga dan PPN per baris
+		if err := saveOrderLines(tx, pricing); err != nil {
+			return err
+		}
+
+		//  Kurangi stok produk yang dilacak
+		if err := reserveStock(tx, activeCart.Items); err != nil {
+			return err
+		}
+
+		//  Catat pemakaian kupon dan promo
+		if err := recordRedemptions(tx, newOrder, pricing); err != nil {
+			return err
+		}
+
+		//  Potong poin loyalitas yang ditukar
+		if err := redeemLoyaltyPoints(tx, newOrder); err != nil {
 			return err
 		}
 
+		//  Bayar sebagian/seluruhnya dengan gift card dan saldo toko
+		if err := applyOrderCredits(tx, &newOrder, payment.GiftCardCode, payment.UseStoreCredit); err != nil {
+			return err
+		}
+
+		//  Kaitkan Cart Aktif dengan Order Baru
+		result := tx.Model(&models.Cart{}).
+			Where("id = ? AND order_id IS NULL", activeCart.ID).
+			Update("order_id", newOrder.ID)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected != 1 {
+			return errCartCheckedOut
+		}
+
+		//  Tidak ada sisa tagihan, pesanan langsung lunas tanpa Duitku
+		if newOrder.AmountDue() == 0 {
+			return updateOrderStatus(tx, &newOrder, models.OrderStatusPaid)
+		}
 		return nil
 	})
 
-	if err != nil {
+	if err == errOutOfStock {
+		c.JSON(http.StatusConflict, gin.H{"error": "Stok produk habis saat checkout, silakan periksa keranjang kembali"})
+		return
+	} else if err == errCartCheckedOut {
+		c.JSON(http.StatusConflict, gin.H{"error": "Keranjang sudah diproses oleh checkout lain"})
+		return
+	} else if err == errCouponUnavailable {
+		c.JSON(http.StatusConflict, gin.H{"error": "Kupon tidak lagi dapat digunakan, silakan periksa keranjang kembali"})
+		return
+	} else if err == errInsufficientPoints {
+		c.JSON(http.StatusConflict, gin.H{"error": "Poin loyalitas tidak mencukupi"})
+		return
+	} else if err == errGiftCardUnavailable {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Gift card tidak valid, sudah habis, atau kedaluwarsa"})
+		return
+	} else if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Transaksi checkout gagal", "details": err.Error()})
 		return
 	}
 
+	if newOrder.AmountDue() == 0 {
+		c.JSON(http.StatusOK, gin.H{
+			"message": "Pesanan lunas dibayar dengan gift card/saldo toko.",
+			"order": gin.H{
+				"number":            newOrder.Number,
+				"totalPrice":        pricing.GrandTotal,
+				"giftCardAmount":    newOrder.GiftCardAmount,
+				"storeCreditAmount": newOrder.StoreCreditAmount,
+				"amountDue":         0,
+				"pricing":           pricing,
+				"status":            newOrder.Status,
+			},
+		})
+		return
+	}
+
 	//  Panggil API Duitku Create Invoice
 	// Ambil detail user untuk mengisi email dan phone Duitku
 	customerEmail := user.Email
 	customerPhone := user.Address.PhoneNumber
 
-	duitkuResp, err := createDuitkuInvoice(newOrder, activeCart, customerEmail, customerPhone, user)
+	duitkuResp, err := createDuitkuInvoice(newOrder, pricing, customerEmail, customerPhone, user)
 
 	if err != nil {
-		// Jika Duitku gagal, rollback order (Opsional, tapi disarankan)
-		database.DB.Delete(&newOrder)
-		database.DB.Model(&activeCart).Update("OrderID", nil) // Lepas keterkaitan cart
+		// Jika Duitku gagal, rollback order beserta stok, saldo, poin dan kupon yang sudah dipotong
+		rollbackErr := database.DB.Transaction(func(tx *gorm.DB) error {
+			if err := releaseStock(tx, activeCart.Items); err != nil {
+				return err
+			}
+			if err := refundOrderCredits(tx, newOrder); err != nil {
+				return err
+			}
+			if err := refundRedeemedPoints(tx, newOrder); err != nil {
+				return err
+			}
+			if err := tx.Where("order_id = ?", newOrder.ID).Delete(&models.Redemption{}).Error; err != nil {
+				return err
+			}
+			if err := tx.Delete(&newOrder).Error; err != nil {
+				return err
+			}
+			// Lepas keterkaitan cart, hanya jika masih terkait dengan pesanan ini
+			return tx.Model(&models.Cart{}).
+				Where("id = ? AND order_id = ?", activeCart.ID, newOrder.ID).
+				Update("order_id", nil).Error
+		})
+		if rollbackErr != nil {
+			log.Printf("Warning: Gagal membatalkan pesanan %d setelah invoice Duitku gagal: %v", newOrder.ID, rollbackErr)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal membuat invoice pembayaran dan membatalkan pesanan", "details": rollbackErr.Error()})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal membuat invoice pembayaran", "details": err.Error()})
 		return
 	}
@@ -111,9 +499,13 @@ func Checkout(c *gin.Context) {
 		"message":    "Invoice pembayaran berhasil dibuat.",
 		"paymentUrl": duitkuResp.PaymentUrl, // URL untuk diarahkan/pop-up
 		"order": gin.H{
-			"id":         newOrder.ID,
-			"totalPrice": totalPrice,
-			"reference":  duitkuResp.Reference,
+			"number":            newOrder.Number,
+			"totalPrice":        pricing.GrandTotal,
+			"giftCardAmount":    newOrder.GiftCardAmount,
+			"storeCreditAmount": newOrder.StoreCreditAmount,
+			"amountDue":         newOrder.AmountDue(),
+			"pricing":           pricing,
+			"reference":         duitkuResp.Reference,
 		},
 	})
 }
@@ -228,26 +620,20 @@ func GetUserOrders(c *gin.Context) {
 	})
 }
 
-// GetOrderByID mengambil detail spesifik dari satu pesanan.
-// Route: GET /api/v1/orders/:id
+// GetOrderByID mengambil detail spesifik dari satu pesanan berdasarkan nomor pesanan.
+// Route: GET /oder/:number
 func GetOrderByID(c *gin.Context) {
 	Id, exists := c.Get("userId")
 	if !exists {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "harus login dulu"})
 	}
 	userID := utils.InterfaceToUint(Id)
-	orderIDStr := c.Param("id")
-	orderID, err := strconv.ParseUint(orderIDStr, 10, 64)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "ID pesanan tidak valid"})
-		return
-	}
 
 	var order models.Order
-	// Cari Order berdasarkan ID dan pastikan ia milik pengguna yang benar.
+	// Cari Order berdasarkan nomor pesanan dan pastikan ia milik pengguna yang benar.
 	if err := database.DB.
 		Preload("Cart.Items.Product").
-		Where("id = ? AND user_id = ?", orderID, userID).
+		Scopes(userOrder(userID, c.Param("number"))).
 		First(&order).Error; err != nil {
 
 		if err == gorm.ErrRecordNotFound {
@@ -0,0 +1,375 @@
+package controller
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"go-be/database"
+	"go-be/middleware"
+	"go-be/models"
+	"go-be/utils"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// errInvalidOrderTransition dikembalikan saat admin mengubah status pesanan ke status yang tidak diizinkan.
+var errInvalidOrderTransition = errors.New("status pesanan tidak dapat diubah")
+
+// errFinanceOnlyTransition dikembalikan saat staf tanpa PermFinanceManage menandai pesanan lunas secara manual.
+var errFinanceOnlyTransition = errors.New("hanya staf keuangan yang bisa menandai pesanan lunas")
+
+// allowedOrderTransitions adalah perubahan status pesanan yang boleh dilakukan admin secara manual.
+// Status pengiriman biasanya diisi otomatis dari paket; transisi manual ke Shipped/Delivered
+// dipakai untuk pesanan yang dikirim tanpa data paket. Pending -> Paid menerbitkan faktur dan poin,
+// sehingga hanya boleh dilakukan staf keuangan (lihat UpdateAdminOrderStatus).
+var allowedOrderTransitions = map[string][]string{
+	models.OrderStatusPending:          {models.OrderStatusPaid, models.OrderStatusFailed},
+	models.OrderStatusFailed:           {models.OrderStatusPending},
+	models.OrderStatusPaid:             {models.OrderStatusShipped, models.OrderStatusDelivered},
+	models.OrderStatusPartiallyShipped: {models.OrderStatusShipped, models.OrderStatusDelivered},
+	models.OrderStatusShipped:          {models.OrderStatusDelivered},
+}
+
+// Struct Input DTO
+
+// OrderStatusInput adalah perubahan status pesanan oleh admin.
+type OrderStatusInput struct {
+	Status string `json:"status" binding:"required"`
+	Note   string `json:"note"`
+}
+
+// OrderNoteInput adalah catatan internal admin pada pesanan.
+type OrderNoteInput struct {
+	Note string `json:"note" binding:"required"`
+}
+
+// Helper Functions
+
+// csvCell mencegah formula injection saat CSV dibuka di spreadsheet: nilai yang diawali
+// karakter formula diberi awalan tanda kutip agar dibaca sebagai teks.
+func csvCell(value string) string {
+	if value != "" && strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
+
+// orderExportMaxRows adalah batas baris ekspor CSV pesanan (ORDER_EXPORT_MAX_ROWS, default 10000).
+func orderExportMaxRows() int64 {
+	return int64(utils.EnvUint("ORDER_EXPORT_MAX_ROWS", 10000))
+}
+
+// adminOrderQuery menyusun query pesanan dari filter query string:
+// status, from/to (YYYY-MM-DD, tanggal pesanan dibuat), userId, customer (nama atau email),
+// number (nomor pesanan) dan reference (referensi pembayaran Duitku).
+func adminOrderQuery(c *gin.Context) (*gorm.DB, error) {
+	query := database.DB.Model(&models.Order{})
+	if status := c.Query("status"); status != "" {
+		query = query.Where("orders.status = ?", status)
+	}
+	if from := c.Query("from"); from != "" {
+		date, err := time.ParseInLocation("2006-01-02", from, time.Local)
+		if err != nil {
+			return nil, err
+		}
+		query = query.Where("orders.created_at >= ?", date)
+	}
+	if to := c.Query("to"); to != "" {
+		date, err := time.ParseInLocation("2006-01-02", to, time.Local)
+		if err != nil {
+			return nil, err
+		}
+		query = query.Where("orders.created_at < ?", date.AddDate(0, 0, 1))
+	}
+	if userID := c.Query("userId"); userID != "" {
+		query = query.Where("orders.user_id = ?", utils.StringToUint(userID))
+	}
+	if customer := c.Query("customer"); customer != "" {
+		pattern := "%" + customer + "%"
+		query = query.Joins("JOIN users ON users.id = orders.user_id").
+			Where("users.name ILIKE ? OR users.email ILIKE ?", pattern, pattern)
+	}
+	if number := c.Query("number"); number != "" {
+		query = query.Where("orders.number ILIKE ?", "%"+strings.TrimSpace(number)+"%")
+	}
+	if reference := c.Query("reference"); reference != "" {
+		query = query.Where("orders.duitku_reference ILIKE ?", "%"+reference+"%")
+	}
+	// Session agar query bisa dipakai ulang untuk Count dan Find
+	return query.Session(&gorm.Session{}), nil
+}
+
+// changeOrderStatus mengubah status pesanan lewat transisi yang diizinkan dan mencatatnya sebagai catatan internal.
+func changeOrderStatus(tx *gorm.DB, order *models.Order, newStatus string, note string, adminID uint) error {
+	allowed := false
+	for _, status := range allowedOrderTransitions[order.Status] {
+		if status == newStatus {
+			allowed = true
+			break
+		}
+	}
+	if !allowed {
+		return errInvalidOrderTransition
+	}
+
+	oldStatus := order.Status
+	if err := updateOrderStatus(tx, order, newStatus); err != nil {
+		return err
+	}
+	order.Status = newStatus
+	if err := tx.Create(&models.OrderNote{
+		OrderID:    order.ID,
+		AuthorID:   adminID,
+		Note:       note,
+		FromStatus: oldStatus,
+		ToStatus:   newStatus,
+	}).Error; err != nil {
+		return err
+	}
+	message := fmt.Sprintf("Status pesanan %s diubah menjadi %s", order.Number, newStatus)
+	return notifyUser(tx, order.UserID, "order_status", message, "/oder/"+order.Number)
+}
+
+// Controller Handlers
+
+// GetAdminOrders menampilkan semua pesanan dengan filter dan pagination (?page=&limit=).
+// Route: GET /order-admin
+func GetAdminOrders(c *gin.Context) {
+	query, err := adminOrderQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Format tanggal harus YYYY-MM-DD"})
+		return
+	}
+
+	page := utils.StringToUint(c.DefaultQuery("page", "1"))
+	if page == 0 {
+		page = 1
+	}
+	limit := utils.StringToUint(c.DefaultQuery("limit", "20"))
+	if limit == 0 || limit > 100 {
+		limit = 20
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal mengambil daftar pesanan"})
+		return
+	}
+	var orders []models.Order
+	if err := query.
+		Order("orders.created_at DESC").
+		Offset(int((page - 1) * limit)).
+		Limit(int(limit)).
+		Find(&orders).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal mengambil daftar pesanan"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Daftar pesanan berhasil diambil",
+		"data":    orders,
+		"meta": gin.H{
+			"page":  page,
+			"limit": limit,
+			"total": total,
+		},
+	})
+}
+
+// ExportAdminOrders mengunduh semua pesanan yang cocok dengan filter sebagai CSV.
+// Route: GET /order-admin/export
+func ExportAdminOrders(c *gin.Context) {
+	query, err := adminOrderQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Format tanggal harus YYYY-MM-DD"})
+		return
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal mengambil daftar pesanan"})
+		return
+	}
+	if maxRows := orderExportMaxRows(); total > maxRows {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": fmt.Sprintf("Ekspor maksimal %d pesanan, persempit filter tanggal atau status", maxRows),
+			"total": total,
+		})
+		return
+	}
+
+	var orders []models.Order
+	if err := query.Order("orders.created_at DESC").Find(&orders).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal mengambil daftar pesanan"})
+		return
+	}
+	userIDs := make([]uint, 0, len(orders))
+	for _, order := range orders {
+		userIDs = append(userIDs, order.UserID)
+	}
+	var users []models.User
+	if err := database.DB.Select("id", "name", "email").Where("id IN ?", userIDs).Find(&users).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal mengambil data pelanggan"})
+		return
+	}
+	usersByID := map[uint]models.User{}
+	for _, user := range users {
+		usersByID[user.ID] = user
+	}
+
+	c.Header("Content-Type", "text/csv")
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=orders-%s.csv", time.Now().Format("20060102-150405")))
+	writer := csv.NewWriter(c.Writer)
+	writer.Write([]string{
+		"id", "number", "created_at", "status", "customer_name", "customer_email", "quantity",
+		"subtotal", "discount_total", "tax_total", "shipping_fee", "service_fee", "total_price",
+		"gift_card_amount", "store_credit_amount", "amount_due", "payment", "duitku_reference",
+	})
+	for _, order := range orders {
+		user := usersByID[order.UserID]
+		writer.Write([]string{
+			utils.UintToString(order.ID),
+			csvCell(order.Number),
+			order.CreatedAt.Format(time.RFC3339),
+			csvCell(order.Status),
+			csvCell(user.Name),
+			csvCell(user.Email),
+			utils.UintToString(order.Quantity),
+			utils.UintToString(order.Subtotal),
+			utils.UintToString(order.DiscountTotal),
+			utils.UintToString(order.TaxTotal),
+			utils.UintToString(order.ShippingFee),
+			utils.UintToString(order.ServiceFee),
+			utils.UintToString(order.TotalPrice),
+			utils.UintToString(order.GiftCardAmount),
+			utils.UintToString(order.StoreCreditAmount),
+			utils.UintToString(order.AmountDue()),
+			csvCell(order.Payment),
+			csvCell(order.DuitkuReference),
+		})
+	}
+	writer.Flush()
+}
+
+// GetAdminOrderByID menampilkan detail lengkap pesanan: item, pelanggan, paket, retur dan catatan internal.
+// Route: GET /order-admin/:id
+func GetAdminOrderByID(c *gin.Context) {
+	var order models.Order
+	if err := database.DB.
+		Preload("Cart.Items.Product", preloadProductWithDeleted).
+		Preload("Shipments.Items").
+		Preload("Shipments.Events", func(db *gorm.DB) *gorm.DB { return db.Order("occurred_at ASC") }).
+		Preload("Notes", func(db *gorm.DB) *gorm.DB { return db.Order("created_at ASC") }).
+		First(&order, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Pesanan tidak ditemukan"})
+		return
+	}
+
+	var user models.User
+	if err := database.DB.Unscoped().First(&user, order.UserID).Error; err != nil && err != gorm.ErrRecordNotFound {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal mengambil data pelanggan"})
+		return
+	}
+	var returns []models.ReturnRequest
+	if err := database.DB.Where("order_id = ?", order.ID).Order("created_at ASC").Find(&returns).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal mengambil data retur"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Detail pesanan berhasil diambil",
+		"data":    order,
+		"customer": gin.H{
+			"id":    user.ID,
+			"name":  user.Name,
+			"email": user.Email,
+			"taxId": user.TaxID,
+		},
+		"returns":            returns,
+		"allowedTransitions": allowedOrderTransitions[order.Status],
+	})
+}
+
+// UpdateAdminOrderStatus mengubah status pesanan melalui transisi yang diizinkan.
+// Route: PUT /order-admin/status/:id
+func UpdateAdminOrderStatus(c *gin.Context) {
+	Id, _ := c.Get("userId")
+	adminID := utils.InterfaceToUint(Id)
+
+	var input OrderStatusInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Input tidak valid", "details": err.Error()})
+		return
+	}
+
+	var order models.Order
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&order, c.Param("id")).Error; err != nil {
+			return err
+		}
+		if order.Status == models.OrderStatusPending && input.Status == models.OrderStatusPaid &&
+			!middleware.HasPermission(c, models.PermFinanceManage) {
+			return errFinanceOnlyTransition
+		}
+		return changeOrderStatus(tx, &order, input.Status, input.Note, adminID)
+	})
+	switch {
+	case err == gorm.ErrRecordNotFound:
+		c.JSON(http.StatusNotFound, gin.H{"error": "Pesanan tidak ditemukan"})
+		return
+	case err == errInvalidOrderTransition:
+		c.JSON(http.StatusConflict, gin.H{
+			"error":              fmt.Sprintf("Status pesanan tidak dapat diubah dari %s ke %s", order.Status, input.Status),
+			"allowedTransitions": allowedOrderTransitions[order.Status],
+		})
+		return
+	case err == errFinanceOnlyTransition:
+		c.JSON(http.StatusForbidden, gin.H{"error": "Hanya staf keuangan yang bisa menandai pesanan lunas secara manual"})
+		return
+	case err == errCreditsInsufficient:
+		c.JSON(http.StatusConflict, gin.H{"error": "Saldo gift card atau saldo toko pelanggan tidak lagi cukup untuk mengaktifkan pesanan"})
+		return
+	case err == errOutOfStock:
+		c.JSON(http.StatusConflict, gin.H{"error": "Stok produk tidak lagi cukup untuk mengaktifkan pesanan"})
+		return
+	case err == errInsufficientPoints:
+		c.JSON(http.StatusConflict, gin.H{"error": "Poin loyalitas pelanggan tidak lagi cukup untuk mengaktifkan pesanan"})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal memperbarui status pesanan"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Status pesanan berhasil diperbarui", "data": order})
+}
+
+// AddOrderNote menambahkan catatan internal pada pesanan. Catatan tidak terlihat oleh pelanggan.
+// Route: POST /order-admin/note/:id
+func AddOrderNote(c *gin.Context) {
+	Id, _ := c.Get("userId")
+	adminID := utils.InterfaceToUint(Id)
+
+	var order models.Order
+	if err := database.DB.Select("id").First(&order, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Pesanan tidak ditemukan"})
+		return
+	}
+	var input OrderNoteInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Input tidak valid", "details": err.Error()})
+		return
+	}
+
+	note := models.OrderNote{OrderID: order.ID, AuthorID: adminID, Note: input.Note}
+	if err := database.DB.Create(&note).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal menambahkan catatan pesanan"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"message": "Catatan pesanan berhasil ditambahkan", "data": note})
+}
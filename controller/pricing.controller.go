@@ -0,0 +1,642 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"go-be/database"
+	"go-be/models"
+	"go-be/utils"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// PriceLine adalah rincian harga satu item keranjang.
+type PriceLine struct {
+	CartItemID uint   `json:"cartItemId"`
+	ProductID  uint   `json:"productId"`
+	CategoryID uint   `json:"categoryId"`
+	Name       string `json:"name"`
+	UnitPrice  uint   `json:"unitPrice"`      // harga aktif, termasuk harga diskon terjadwal
+	CompareAt  *uint  `json:"compareAtPrice"` // harga normal jika sedang diskon terjadwal
+	Quantity   uint   `json:"quantity"`
+	Subtotal   uint   `json:"subtotal"` // UnitPrice x Quantity
+	Discount   uint   `json:"discount"`
+	TaxRate    uint   `json:"taxRate"` // persen PPN baris, 0 untuk pelanggan bebas PPN
+	Tax        uint   `json:"tax"`     // PPN yang ditambahkan, atau yang sudah termasuk jika harga termasuk PPN
+	Total      uint   `json:"total"`   // jumlah yang dibayar untuk baris ini
+}
+
+// TaxSummary adalah total PPN per tarif, untuk invoice dan item detail Duitku.
+type TaxSummary struct {
+	Rate   uint `json:"rate"`
+	Base   uint `json:"base"` // dasar pengenaan pajak
+	Amount uint `json:"amount"`
+}
+
+// AppliedPromotion adalah promo otomatis yang berlaku pada keranjang.
+type AppliedPromotion struct {
+	PromotionID uint   `json:"promotionId"`
+	Name        string `json:"name"`
+	Amount      uint   `json:"amount"`
+}
+
+// AppliedCoupon adalah kupon yang berhasil dipakai pada keranjang.
+type AppliedCoupon struct {
+	CouponID uint   `json:"couponId"`
+	Code     string `json:"code"`
+	Type     string `json:"type"`
+	Amount   uint   `json:"amount"` // termasuk potongan ongkir untuk kupon free_shipping
+}
+
+// PriceBreakdown adalah hasil mesin harga yang dipakai keranjang dan Checkout,
+// sehingga angka yang dilihat pelanggan selalu sama dengan yang dikirim ke Duitku.
+type PriceBreakdown struct {
+	Lines            []PriceLine        `json:"lines"`
+	Quantity         uint               `json:"quantity"`
+	Subtotal         uint               `json:"subtotal"`
+	Discount         uint               `json:"discount"`     // total diskon per item (promo + kupon + poin)
+	TaxRate          uint               `json:"taxRate"`      // persen PPN default
+	TaxInclusive     bool               `json:"taxInclusive"` // harga katalog sudah termasuk PPN
+	TaxExempt        bool               `json:"taxExempt"`
+	Tax              uint               `json:"tax"`
+	TaxExempted      uint               `json:"taxExempted"` // PPN yang dikeluarkan dari harga termasuk PPN untuk pelanggan bebas PPN
+	Taxes            []TaxSummary       `json:"taxes"`
+	Shipping         uint               `json:"shipping"`
+	ShippingDiscount uint               `json:"shippingDiscount"`
+	Services         uint               `json:"services"`
+	GrandTotal       uint               `json:"grandTotal"`
+	Promotions       []AppliedPromotion `json:"promotions"`
+	Coupon           *AppliedCoupon     `json:"coupon"`
+	CouponError      string             `json:"couponError,omitempty"`
+	LoyaltyPoints    uint               `json:"loyaltyPoints"`   // poin yang ditukar
+	LoyaltyDiscount  uint               `json:"loyaltyDiscount"` // diskon dari penukaran poin
+}
+
+// pricingRequest adalah masukan mesin harga.
+type pricingRequest struct {
+	UserID     uint // 0 untuk keranjang tamu
+	Items      []models.CartItem
+	CouponCode string
+	// LoyaltyPoints adalah poin yang ingin ditukar; saldo poin dicek oleh pemanggil
+	LoyaltyPoints uint
+}
+
+// Helper Functions
+
+// subtractOrZero mengurangi b dari a dengan batas bawah 0 agar nilai uint tidak berputar menjadi sangat besar.
+func subtractOrZero(a, b uint) uint {
+	if b > a {
+		return 0
+	}
+	return a - b
+}
+
+// includedTax menghitung PPN yang sudah termasuk di dalam amount (harga termasuk PPN).
+func includedTax(amount uint, rate uint) uint {
+	return amount - (amount*100+(100+rate)/2)/(100+rate)
+}
+
+// lineTaxRates mengambil tarif PPN per kategori untuk baris harga.
+// Kategori tanpa tarif khusus memakai tarif default.
+func lineTaxRates(db *gorm.DB, lines []PriceLine, defaultRate uint) (map[uint]uint, error) {
+	categoryIDs := make([]uint, 0, len(lines))
+	for _, line := range lines {
+		categoryIDs = append(categoryIDs, line.CategoryID)
+	}
+	var categories []models.Category
+	if err := db.Where("id IN ?", categoryIDs).Find(&categories).Error; err != nil {
+		return nil, err
+	}
+	rates := map[uint]uint{}
+	for _, line := range lines {
+		rates[line.CategoryID] = defaultRate
+	}
+	for _, category := range categories {
+		if category.TaxRate != nil {
+			rates[category.ID] = *category.TaxRate
+		}
+	}
+	return rates, nil
+}
+
+// applyTaxes menghitung PPN per baris. Untuk harga belum termasuk PPN, PPN ditambahkan ke total baris.
+// Untuk harga termasuk PPN, PPN hanya dirinci; pelanggan bebas PPN membayar harga tanpa PPN.
+func applyTaxes(db *gorm.DB, breakdown *PriceBreakdown) error {
+	if len(breakdown.Lines) == 0 {
+		return nil
+	}
+	rates, err := lineTaxRates(db, breakdown.Lines, breakdown.TaxRate)
+	if err != nil {
+		return err
+	}
+
+	summaries := map[uint]*TaxSummary{}
+	for i := range breakdown.Lines {
+		line := &breakdown.Lines[i]
+		net := subtractOrZero(line.Subtotal, line.Discount)
+		rate := rates[line.CategoryID]
+		line.Total = net
+
+		if breakdown.TaxExempt {
+			line.TaxRate = 0
+			if breakdown.TaxInclusive {
+				exempted := includedTax(net, rate)
+				line.Total = net - exempted
+				breakdown.TaxExempted += exempted
+			}
+			continue
+		}
+
+		line.TaxRate = rate
+		if breakdown.TaxInclusive {
+			line.Tax = includedTax(net, rate)
+		} else {
+			line.Tax = percentOf(net, rate)
+			line.Total = net + line.Tax
+		}
+		if line.Tax == 0 {
+			continue
+		}
+		summary, ok := summaries[rate]
+		if !ok {
+			summary = &TaxSummary{Rate: rate}
+			summaries[rate] = summary
+		}
+		summary.Base += line.Total - line.Tax
+		summary.Amount += line.Tax
+	}
+
+	for _, summary := range summaries {
+		breakdown.Taxes = append(breakdown.Taxes, *summary)
+	}
+	sort.Slice(breakdown.Taxes, func(i, j int) bool { return breakdown.Taxes[i].Rate < breakdown.Taxes[j].Rate })
+	return nil
+}
+
+// percentOf menghitung amount x rate% dengan pembulatan ke rupiah terdekat.
+func percentOf(amount uint, rate uint) uint {
+	return (amount*rate + 50) / 100
+}
+
+// withinWindow mengecek apakah waktu sekarang berada di antara startsAt dan endsAt (jika diisi).
+func withinWindow(now time.Time, startsAt *time.Time, endsAt *time.Time) bool {
+	if startsAt != nil && now.Before(*startsAt) {
+		return false
+	}
+	if endsAt != nil && !now.Before(*endsAt) {
+		return false
+	}
+	return true
+}
+
+// lineMatches mengecek apakah baris harga cocok dengan filter produk/kategori.
+// Filter kosong berarti semua produk cocok.
+func lineMatches(line PriceLine, productID *uint, categoryID *uint) bool {
+	if productID != nil && line.ProductID != *productID {
+		return false
+	}
+	if categoryID != nil && line.CategoryID != *categoryID {
+		return false
+	}
+	return true
+}
+
+// distributeDiscount membagi diskon secara proporsional ke baris yang memenuhi syarat
+// agar PPN per baris dihitung dari harga setelah diskon.
+func distributeDiscount(lines []PriceLine, eligible []int, amount uint) {
+	var base uint
+	for _, i := range eligible {
+		base += subtractOrZero(lines[i].Subtotal, lines[i].Discount)
+	}
+	if base == 0 {
+		return
+	}
+	remaining := amount
+	for n, i := range eligible {
+		lineBase := subtractOrZero(lines[i].Subtotal, lines[i].Discount)
+		share := amount * lineBase / base
+		if n == len(eligible)-1 {
+			// Sisa pembulatan masuk ke baris terakhir
+			share = remaining
+		}
+		if share > lineBase {
+			share = lineBase
+		}
+		lines[i].Discount += share
+		remaining -= share
+	}
+}
+
+// applyPromotions menerapkan promo otomatis aktif ke baris harga.
+func applyPromotions(db *gorm.DB, breakdown *PriceBreakdown, now time.Time) error {
+	var promotions []models.Promotion
+	if err := db.Where("active = ?", true).Find(&promotions).Error; err != nil {
+		return err
+	}
+
+	for _, promo := range promotions {
+		if !withinWindow(now, promo.StartsAt, promo.EndsAt) || promo.DiscountPercent == 0 {
+			continue
+		}
+		buyQuantity := promo.BuyQuantity
+		if buyQuantity == 0 {
+			buyQuantity = 1
+		}
+
+		// Hitung unit per kelompok: hanya syarat beli, hanya yang didiskon, atau keduanya
+		// (promo "beli 2 sofa, sofa ketiga diskon 50%")
+		var buyOnly, getOnly, overlap uint
+		for _, line := range breakdown.Lines {
+			buys := lineMatches(line, promo.BuyProductID, promo.BuyCategoryID)
+			gets := lineMatches(line, promo.GetProductID, promo.GetCategoryID)
+			switch {
+			case buys && gets:
+				overlap += line.Quantity
+			case buys:
+				buyOnly += line.Quantity
+			case gets:
+				getOnly += line.Quantity
+			}
+		}
+		// Unit yang didiskon tidak ikut memenuhi syarat beli. Unit yang hanya didiskon dipakai lebih dulu,
+		// sisanya diambil dari unit yang sama-sama memenuhi syarat: setiap buyQuantity+1 unit mendapat satu diskon.
+		condition := buyOnly + overlap
+		getOnlyRewards := min(getOnly, condition/buyQuantity)
+		overlapRewards := min(overlap, (condition-getOnlyRewards*buyQuantity)/(buyQuantity+1))
+		if getOnlyRewards+overlapRewards == 0 {
+			continue
+		}
+
+		var amount uint
+		for i := range breakdown.Lines {
+			line := &breakdown.Lines[i]
+			if !lineMatches(*line, promo.GetProductID, promo.GetCategoryID) {
+				continue
+			}
+			rewardUnits := &getOnlyRewards
+			if lineMatches(*line, promo.BuyProductID, promo.BuyCategoryID) {
+				rewardUnits = &overlapRewards
+			}
+			units := min(line.Quantity, *rewardUnits)
+			if units == 0 {
+				continue
+			}
+			discount := percentOf(line.UnitPrice*units, promo.DiscountPercent)
+			discount = min(discount, subtractOrZero(line.Subtotal, line.Discount))
+			line.Discount += discount
+			amount += discount
+			*rewardUnits -= units
+		}
+		if amount > 0 {
+			breakdown.Promotions = append(breakdown.Promotions, AppliedPromotion{
+				PromotionID: promo.ID,
+				Name:        promo.Name,
+				Amount:      amount,
+			})
+		}
+	}
+	return nil
+}
+
+// couponIneligibleReason mengecek masa berlaku, batas pemakaian dan syarat pesanan pertama.
+// Mengembalikan alasan kupon tidak bisa dipakai, atau string kosong jika kupon valid.
+// excludeOrderID diisi saat checkout agar pesanan yang sedang dibuat tidak ikut terhitung.
+func couponIneligibleReason(db *gorm.DB, coupon models.Coupon, userID uint, excludeOrderID uint, now time.Time) (string, error) {
+	if !coupon.Active || !withinWindow(now, coupon.StartsAt, coupon.EndsAt) {
+		return "Kupon tidak aktif atau sudah kedaluwarsa", nil
+	}
+	if coupon.UsageLimit > 0 {
+		var used int64
+		if err := db.Model(&models.Redemption{}).Where("coupon_id = ?", coupon.ID).Count(&used).Error; err != nil {
+			return "", err
+		}
+		if uint(used) >= coupon.UsageLimit {
+			return "Kupon sudah mencapai batas pemakaian", nil
+		}
+	}
+	if (coupon.PerUserLimit > 0 || coupon.FirstOrderOnly) && userID == 0 {
+		return "Silakan login untuk memakai kupon ini", nil
+	}
+	if coupon.PerUserLimit > 0 {
+		var used int64
+		if err := db.Model(&models.Redemption{}).Where("coupon_id = ? AND user_id = ?", coupon.ID, userID).Count(&used).Error; err != nil {
+			return "", err
+		}
+		if uint(used) >= coupon.PerUserLimit {
+			return "Anda sudah mencapai batas pemakaian kupon ini", nil
+		}
+	}
+	if coupon.FirstOrderOnly {
+		var orders int64
+		if err := db.Model(&models.Order{}).
+			Where("user_id = ? AND status <> ? AND id <> ?", userID, models.OrderStatusFailed, excludeOrderID).
+			Count(&orders).Error; err != nil {
+			return "", err
+		}
+		if orders > 0 {
+			return "Kupon hanya berlaku untuk pesanan pertama", nil
+		}
+	}
+	return "", nil
+}
+
+// applyCoupon menerapkan kupon ke keranjang. Jika kupon tidak bisa dipakai,
+// alasannya disimpan di CouponError dan harga dihitung tanpa kupon.
+func applyCoupon(db *gorm.DB, breakdown *PriceBreakdown, req pricingRequest, now time.Time) error {
+	code := strings.ToUpper(strings.TrimSpace(req.CouponCode))
+	if code == "" {
+		return nil
+	}
+
+	var coupon models.Coupon
+	if err := db.Where("code = ?", code).First(&coupon).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			breakdown.CouponError = "Kupon tidak ditemukan"
+			return nil
+		}
+		return err
+	}
+
+	reason, err := couponIneligibleReason(db, coupon, req.UserID, 0, now)
+	if err != nil {
+		return err
+	}
+	if reason != "" {
+		breakdown.CouponError = reason
+		return nil
+	}
+
+	var eligible []int
+	var eligibleSubtotal uint
+	for i, line := range breakdown.Lines {
+		if lineMatches(line, coupon.ProductID, coupon.CategoryID) {
+			eligible = append(eligible, i)
+			eligibleSubtotal += subtractOrZero(line.Subtotal, line.Discount)
+		}
+	}
+	if len(eligible) == 0 {
+		breakdown.CouponError = "Tidak ada produk di keranjang yang memenuhi syarat kupon"
+		return nil
+	}
+	if eligibleSubtotal < coupon.MinSpend {
+		breakdown.CouponError = fmt.Sprintf("Minimal belanja Rp%d untuk memakai kupon ini", coupon.MinSpend)
+		return nil
+	}
+
+	applied := &AppliedCoupon{CouponID: coupon.ID, Code: coupon.Code, Type: coupon.Type}
+	switch coupon.Type {
+	case models.CouponTypePercentage:
+		amount := percentOf(eligibleSubtotal, coupon.Value)
+		if coupon.MaxDiscount > 0 && amount > coupon.MaxDiscount {
+			amount = coupon.MaxDiscount
+		}
+		distributeDiscount(breakdown.Lines, eligible, amount)
+		applied.Amount = amount
+	case models.CouponTypeFixed:
+		amount := coupon.Value
+		if amount > eligibleSubtotal {
+			amount = eligibleSubtotal
+		}
+		distributeDiscount(breakdown.Lines, eligible, amount)
+		applied.Amount = amount
+	case models.CouponTypeFreeShipping:
+		// Potongan ongkir dihitung setelah ongkir diketahui
+	default:
+		breakdown.CouponError = "Jenis kupon tidak dikenal"
+		return nil
+	}
+	breakdown.Coupon = applied
+	return nil
+}
+
+// applyLoyaltyDiscount menukar poin loyalitas menjadi diskon yang dibagi ke semua baris.
+// Nilai poin diatur lewat LOYALTY_POINT_VALUE (rupiah per poin) dan diskon dibatasi
+// LOYALTY_MAX_REDEEM_PERCENT dari harga setelah promo dan kupon.
+func applyLoyaltyDiscount(breakdown *PriceBreakdown, points uint) {
+	pointValue := utils.EnvUint("LOYALTY_POINT_VALUE", 100)
+	if points == 0 || pointValue == 0 {
+		return
+	}
+
+	var eligible []int
+	var base uint
+	for i, line := range breakdown.Lines {
+		eligible = append(eligible, i)
+		base += subtractOrZero(line.Subtotal, line.Discount)
+	}
+	maxDiscount := base * utils.EnvUint("LOYALTY_MAX_REDEEM_PERCENT", 100) / 100
+	if maxPoints := maxDiscount / pointValue; points > maxPoints {
+		points = maxPoints
+	}
+	if points == 0 {
+		return
+	}
+
+	discount := points * pointValue
+	distributeDiscount(breakdown.Lines, eligible, discount)
+	breakdown.LoyaltyPoints = points
+	breakdown.LoyaltyDiscount = discount
+}
+
+// calculateCartPricing menghitung subtotal, diskon per item (promo otomatis, kupon, lalu poin loyalitas),
+// PPN, ongkir, biaya layanan dan grand total. Item harus sudah memuat Product;
+// harga satuan memakai harga aktif dari jadwal diskon.
+// Konfigurasi lewat env: PPN_RATE (default 11), PRICES_INCLUDE_TAX, SHIPPING_FLAT_FEE,
+// FREE_SHIPPING_MIN_SUBTOTAL (0 = nonaktif) dan SERVICE_FEE.
+func calculateCartPricing(db *gorm.DB, req pricingRequest) (PriceBreakdown, error) {
+	now := time.Now()
+	breakdown := PriceBreakdown{
+		Lines:        []PriceLine{},
+		Promotions:   []AppliedPromotion{},
+		Taxes:        []TaxSummary{},
+		TaxRate:      utils.EnvUint("PPN_RATE", 11),
+		TaxInclusive: utils.EnvBool("PRICES_INCLUDE_TAX", false),
+	}
+	if req.UserID != 0 {
+		var user models.User
+		if err := db.Select("id", "tax_exempt").First(&user, req.UserID).Error; err != nil {
+			return PriceBreakdown{}, err
+		}
+		breakdown.TaxExempt = user.TaxExempt
+	}
+	if err := applyCartItemPrices(db, req.Items); err != nil {
+		return PriceBreakdown{}, err
+	}
+
+	for _, item := range req.Items {
+		// Produk yang sudah dihapus tidak ikut dihitung
+		if item.Product.ID == 0 || item.Product.DeletedAt.Valid {
+			continue
+		}
+		line := PriceLine{
+			CartItemID: item.ID,
+			ProductID:  item.ProductID,
+			CategoryID: item.Product.CategoryID,
+			Name:       item.Product.Name,
+			UnitPrice:  item.Product.ActivePrice,
+			CompareAt:  item.Product.CompareAtPrice,
+			Quantity:   item.Quantity,
+		}
+		line.Subtotal = line.UnitPrice * line.Quantity
+		breakdown.Lines = append(breakdown.Lines, line)
+	}
+
+	if len(breakdown.Lines) > 0 {
+		if err := applyPromotions(db, &breakdown, now); err != nil {
+			return PriceBreakdown{}, err
+		}
+		if err := applyCoupon(db, &breakdown, req, now); err != nil {
+			return PriceBreakdown{}, err
+		}
+		applyLoyaltyDiscount(&breakdown, req.LoyaltyPoints)
+	}
+
+	if err := applyTaxes(db, &breakdown); err != nil {
+		return PriceBreakdown{}, err
+	}
+
+	var linesTotal uint
+	for _, line := range breakdown.Lines {
+		breakdown.Quantity += line.Quantity
+		breakdown.Subtotal += line.Subtotal
+		breakdown.Discount += line.Discount
+		breakdown.Tax += line.Tax
+		linesTotal += line.Total
+	}
+
+	if len(breakdown.Lines) > 0 {
+		breakdown.Shipping = utils.EnvUint("SHIPPING_FLAT_FEE", 0)
+		freeShippingMin := utils.EnvUint("FREE_SHIPPING_MIN_SUBTOTAL", 0)
+		if freeShippingMin > 0 && subtractOrZero(breakdown.Subtotal, breakdown.Discount) >= freeShippingMin {
+			breakdown.Shipping = 0
+		}
+		if breakdown.Coupon != nil && breakdown.Coupon.Type == models.CouponTypeFreeShipping {
+			breakdown.ShippingDiscount = breakdown.Shipping
+			breakdown.Coupon.Amount = breakdown.Shipping
+		}
+		breakdown.Services = utils.EnvUint("SERVICE_FEE", 0)
+	}
+
+	breakdown.GrandTotal = linesTotal + subtractOrZero(breakdown.Shipping, breakdown.ShippingDiscount) + breakdown.Services
+	return breakdown, nil
+}
+
+// recordRedemptions menyimpan pemakaian kupon dan promo untuk pesanan baru.
+// Batas pemakaian kupon dicek ulang dengan mengunci baris kupon agar tidak terlampaui
+// oleh checkout yang berjalan bersamaan.
+func recordRedemptions(tx *gorm.DB, order models.Order, pricing PriceBreakdown) error {
+	if pricing.Coupon != nil {
+		var coupon models.Coupon
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&coupon, pricing.Coupon.CouponID).Error; err != nil {
+			return err
+		}
+		reason, err := couponIneligibleReason(tx, coupon, order.UserID, order.ID, time.Now())
+		if err != nil {
+			return err
+		}
+		if reason != "" {
+			return errCouponUnavailable
+		}
+		couponID := coupon.ID
+		if err := tx.Create(&models.Redemption{
+			OrderID:  order.ID,
+			UserID:   order.UserID,
+			CouponID: &couponID,
+			Amount:   pricing.Coupon.Amount,
+		}).Error; err != nil {
+			return err
+		}
+	}
+	for _, promo := range pricing.Promotions {
+		promotionID := promo.PromotionID
+		if err := tx.Create(&models.Redemption{
+			OrderID:     order.ID,
+			UserID:      order.UserID,
+			PromotionID: &promotionID,
+			Amount:      promo.Amount,
+		}).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// saveOrderLines menyimpan rincian harga, diskon dan PPN setiap baris ke CartItem
+// pesanan, sehingga invoice tidak berubah walaupun harga atau tarif PPN berubah.
+func saveOrderLines(tx *gorm.DB, pricing PriceBreakdown) error {
+	for _, line := range pricing.Lines {
+		if err := tx.Model(&models.CartItem{}).
+			Where("id = ?", line.CartItemID).
+			Updates(map[string]interface{}{
+				"unit_price":      line.UnitPrice,
+				"discount_amount": line.Discount,
+				"tax_rate":        line.TaxRate,
+				"tax_amount":      line.Tax,
+				"line_total":      line.Total,
+			}).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// errCouponUnavailable dikembalikan saat kupon tidak lagi bisa dipakai ketika checkout.
+var errCouponUnavailable = errors.New("kupon tidak lagi dapat digunakan")
+
+// Controller Handlers
+
+// GetCartTotals menghitung total keranjang aktif di sisi server.
+// Query opsional ?loyaltyPoints= untuk melihat diskon penukaran poin.
+// Route: GET /cart/totals
+func GetCartTotals(c *gin.Context) {
+	Id, exists := c.Get("userId")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "harus login dulu"})
+		return
+	}
+	userID := utils.InterfaceToUint(Id)
+
+	var cart models.Cart
+	if err := database.DB.
+		Preload("Items.Product").
+		Where("user_id = ? AND order_id IS NULL", userID).
+		First(&cart).Error; err != nil && err != gorm.ErrRecordNotFound {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal mengambil keranjang"})
+		return
+	}
+
+	loyaltyPoints := utils.StringToUint(c.Query("loyaltyPoints"))
+	if loyaltyPoints > 0 {
+		balance, err := loyaltyBalance(database.DB, userID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal menghitung poin loyalitas"})
+			return
+		}
+		if balance < int(loyaltyPoints) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Poin loyalitas tidak mencukupi", "balance": balance})
+			return
+		}
+	}
+
+	pricing, err := calculateCartPricing(database.DB, pricingRequest{
+		UserID:        userID,
+		Items:         cart.Items,
+		CouponCode:    cart.CouponCode,
+		LoyaltyPoints: loyaltyPoints,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal menghitung total keranjang"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Total keranjang berhasil dihitung",
+		"data":    pricing,
+	})
+}
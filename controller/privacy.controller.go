@@ -0,0 +1,369 @@
+package controller
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go-be/database"
+	"go-be/models"
+	"go-be/utils"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+var (
+	errDeleteConfirmation = errors.New("konfirmasi penghapusan akun salah")
+	errActiveOrders       = errors.New("masih ada pesanan yang sedang diproses")
+	errOpenReturns        = errors.New("masih ada retur yang sedang diproses")
+)
+
+// Struct Input DTO
+
+// DeleteAccountInput adalah konfirmasi penghapusan akun. Password wajib untuk akun yang punya password
+// dan kode 2FA wajib jika 2FA aktif.
+type DeleteAccountInput struct {
+	Confirm  string `json:"confirm" binding:"required,eq=DELETE"`
+	Password string `json:"password"`
+	Code     string `json:"code"`
+}
+
+// exportSection adalah satu bagian data pribadi, disimpan sebagai <name>.json di arsip ZIP.
+type exportSection struct {
+	name string
+	data interface{}
+}
+
+// Helper Functions
+
+// collectPersonalData mengumpulkan semua data pribadi user untuk diekspor.
+func collectPersonalData(db *gorm.DB, userID uint) ([]exportSection, error) {
+	var user models.User
+	if err := db.Preload("Roles").First(&user, userID).Error; err != nil {
+		return nil, err
+	}
+
+	var (
+		addresses     []models.Address
+		orders        []models.Order
+		invoices      []models.Invoice
+		returns       []models.ReturnRequest
+		questions     []models.ProductQuestion
+		answers       []models.ProductAnswer
+		wishlists     []models.Wishlist
+		loyalty       []models.LoyaltyEntry
+		storeCredit   []models.StoreCreditEntry
+		sessions      []models.Session
+		identities    []models.UserIdentity
+		notifications []models.Notification
+	)
+	queries := []*gorm.DB{
+		db.Where("user_id = ?", userID).Find(&addresses),
+		db.Preload("Cart.Items.Product", preloadProductWithDeleted).
+			Preload("Shipments.Events").
+			Where("user_id = ?", userID).
+			Order("created_at").
+			Find(&orders),
+		db.Where("order_id IN (?)", db.Model(&models.Order{}).Select("id").Where("user_id = ?", userID)).
+			Order("issued_at").
+			Find(&invoices),
+		db.Preload("Items").Preload("Photos").Preload("Events").Where("user_id = ?", userID).Find(&returns),
+		db.Where("user_id = ?", userID).Find(&questions),
+		db.Where("user_id = ?", userID).Find(&answers),
+		db.Preload("Items").Where("user_id = ?", userID).Find(&wishlists),
+		db.Where("user_id = ?", userID).Order("created_at").Find(&loyalty),
+		db.Where("user_id = ?", userID).Order("created_at").Find(&storeCredit),
+		db.Where("user_id = ?", userID).Order("created_at").Find(&sessions),
+		db.Where("user_id = ?", userID).Find(&identities),
+		db.Where("user_id = ?", userID).Order("created_at").Find(&notifications),
+	}
+	for _, query := range queries {
+		if query.Error != nil {
+			return nil, query.Error
+		}
+	}
+
+	// Ulasan pelanggan di toko ini berupa pertanyaan dan jawaban produk
+	return []exportSection{
+		{"profile", user},
+		{"addresses", addresses},
+		{"orders", orders},
+		{"invoices", invoices},
+		{"returns", returns},
+		{"product_questions", questions},
+		{"product_answers", answers},
+		{"wishlists", wishlists},
+		{"loyalty_points", loyalty},
+		{"store_credit", storeCredit},
+		{"sessions", sessions},
+		{"login_providers", identities},
+		{"notifications", notifications},
+	}, nil
+}
+
+// writeExportZip menulis setiap bagian data sebagai file JSON terpisah di dalam arsip ZIP.
+func writeExportZip(sections []exportSection, exportedAt time.Time) ([]byte, error) {
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+	for _, section := range sections {
+		file, err := archive.CreateHeader(&zip.FileHeader{
+			Name:     section.name + ".json",
+			Method:   zip.Deflate,
+			Modified: exportedAt,
+		})
+		if err != nil {
+			return nil, err
+		}
+		encoder := json.NewEncoder(file)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(section.data); err != nil {
+			return nil, err
+		}
+	}
+	if err := archive.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// anonymizeUser menghapus data pribadi akun dan semua data turunannya. Pesanan, retur dan mutasi
+// saldo/poin tetap disimpan untuk keperluan akuntansi tanpa nama, email, alamat atau NPWP.
+// Pengecualian: faktur yang sudah terbit tetap menyimpan nama dan NPWP pembeli karena wajib ada
+// di dokumen pajak selama masa retensi; email di faktur tetap dihapus.
+func anonymizeUser(tx *gorm.DB, user *models.User) error {
+	now := time.Now()
+	if err := tx.Model(user).Updates(map[string]interface{}{
+		"name":                      "Deleted User",
+		"email":                     fmt.Sprintf("deleted-%d@deleted.invalid", user.ID),
+		"password":                  "",
+		"email_verified_at":         nil,
+		"two_factor_secret":         "",
+		"two_factor_pending_secret": "",
+		"two_factor_last_step":      0,
+		"two_factor_enabled_at":     nil,
+		"disabled_at":               now,
+		"disabled_reason":           "account deleted",
+		"password_reset_required":   false,
+		"tax_exempt":                false,
+		"tax_id":                    "",
+		"address_id":                nil,
+	}).Error; err != nil {
+		return err
+	}
+
+	// Data yang hanya berguna selama akun aktif dihapus permanen
+	for _, model := range []interface{}{
+		&models.Address{},
+		&models.RecoveryCode{},
+		&models.UserIdentity{},
+		&models.Notification{},
+		&models.Wishlist{},
+		&models.AnswerVote{},
+	} {
+		if err := tx.Unscoped().Where("user_id = ?", user.ID).Delete(model).Error; err != nil {
+			return err
+		}
+	}
+	// Keranjang yang sudah menjadi pesanan adalah baris pesanan, hanya keranjang aktif yang dihapus
+	if err := tx.Unscoped().Where("user_id = ? AND order_id IS NULL", user.ID).Delete(&models.Cart{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Model(&models.ReturnRequest{}).Where("user_id = ?", user.ID).Update("pickup_address", "").Error; err != nil {
+		return err
+	}
+	// NPWP di pesanan hanya salinan untuk faktur berikutnya, faktur yang sudah terbit menyimpan salinannya sendiri
+	if err := tx.Unscoped().Model(&models.Order{}).Where("user_id = ?", user.ID).Update("customer_tax_id", "").Error; err != nil {
+		return err
+	}
+	if err := tx.Model(&models.Invoice{}).
+		Where("order_id IN (?)", tx.Unscoped().Model(&models.Order{}).Select("id").Where("user_id = ?", user.ID)).
+		Update("customer_email", "").Error; err != nil {
+		return err
+	}
+	if err := revokeUserSessions(tx, user.ID); err != nil {
+		return err
+	}
+	if err := tx.Unscoped().Where("user_id = ?", user.ID).Delete(&models.Session{}).Error; err != nil {
+		return err
+	}
+
+	// Soft delete: baris user tetap ada agar pesanan yang disimpan tidak ikut terhapus
+	return tx.Delete(user).Error
+}
+
+// Controller Handlers
+
+// ExportPersonalData mengunduh semua data pribadi user yang login (profil, alamat, pesanan, faktur,
+// retur, pertanyaan/jawaban produk, wishlist, poin, saldo, sesi, dll). Default berupa satu file JSON,
+// ?format=zip menghasilkan arsip ZIP berisi satu file JSON per bagian.
+// Route: GET /users/export
+func ExportPersonalData(c *gin.Context) {
+	Id, _ := c.Get("userId")
+	userID := utils.InterfaceToUint(Id)
+
+	format := c.DefaultQuery("format", "json")
+	if format != "json" && format != "zip" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format harus json atau zip"})
+		return
+	}
+	allowed, retryAfter, err := utils.AllowRequest(fmt.Sprintf("data-export:user:%d", userID), utils.EnvUint("DATA_EXPORT_LIMIT_PER_HOUR", 3), time.Hour)
+	if err != nil {
+		log.Printf("Warning: Rate limit ekspor data tidak aktif, Redis error: %v", err)
+	}
+	if !allowed {
+		c.Header("Retry-After", fmt.Sprintf("%d", int(retryAfter.Seconds())))
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "Terlalu banyak permintaan. Mohon coba lagi nanti."})
+		return
+	}
+
+	sections, err := collectPersonalData(database.DB, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal mengumpulkan data pribadi"})
+		return
+	}
+	exportedAt := time.Now()
+	recordAudit(c, "user.export_data", "user", userID, gin.H{"format": format})
+
+	filename := fmt.Sprintf("data-pribadi-%d-%s", userID, exportedAt.Format("20060102"))
+	if format == "zip" {
+		archive, err := writeExportZip(sections, exportedAt)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal membuat arsip data pribadi"})
+			return
+		}
+		c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.zip"`, filename))
+		c.Data(http.StatusOK, "application/zip", archive)
+		return
+	}
+
+	data := gin.H{"exportedAt": exportedAt}
+	for _, section := range sections {
+		data[section.name] = section.data
+	}
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.json"`, filename))
+	c.JSON(http.StatusOK, data)
+}
+
+// DeleteUser menghapus akun user yang login. Data pribadi dianonimkan dan semua sesi diakhiri,
+// sedangkan catatan pesanan tetap disimpan untuk akuntansi. Pesanan yang belum dibayar dibatalkan;
+// penghapusan ditolak selama masih ada pesanan yang dikirim atau retur yang diproses.
+// Saldo toko dan poin loyalitas yang tersisa hangus.
+// Route: DELETE /users/delete
+func DeleteUser(c *gin.Context) {
+	Id, _ := c.Get("userId")
+	userID := utils.InterfaceToUint(Id)
+
+	var input DeleteAccountInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Input tidak valid, ketik DELETE pada confirm", "details": err.Error()})
+		return
+	}
+
+	// Akun staf harus dicabut hak aksesnya oleh admin dulu agar tidak menghapus admin terakhir
+	_, permissions, _, err := models.LoadUserAccess(database.DB, userID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	if len(permissions) > 0 {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Akun staf tidak bisa dihapus sendiri, hubungi admin"})
+		return
+	}
+
+	var original models.User
+	err = withLockedUser(userID, func(tx *gorm.DB, user *models.User) error {
+		if user.Password != "" && utils.ReverseHash(input.Password, user.Password) != nil {
+			return errDeleteConfirmation
+		}
+		if user.TwoFactorEnabledAt != nil {
+			if err := verifySecondFactor(tx, user, input.Code); err != nil {
+				return err
+			}
+		}
+
+		var count int64
+		if err := tx.Model(&models.Order{}).
+			Where("user_id = ? AND status IN ?", user.ID, []string{
+				models.OrderStatusPaid, models.OrderStatusPartiallyShipped, models.OrderStatusShipped,
+			}).
+			Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			return errActiveOrders
+		}
+		if err := tx.Model(&models.ReturnRequest{}).
+			Where("user_id = ? AND status NOT IN ?", user.ID, []string{
+				models.ReturnStatusRejected, models.ReturnStatusCancelled, models.ReturnStatusInspectionFailed,
+				models.ReturnStatusRefunded, models.ReturnStatusReplaced,
+			}).
+			Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			return errOpenReturns
+		}
+
+		var pending []models.Order
+		if err := tx.Where("user_id = ? AND status = ?", user.ID, models.OrderStatusPending).Find(&pending).Error; err != nil {
+			return err
+		}
+		for i := range pending {
+			if err := updateOrderStatus(tx, &pending[i], models.OrderStatusFailed); err != nil {
+				return err
+			}
+		}
+
+		original = *user
+		return anonymizeUser(tx, user)
+	})
+	switch {
+	case err == errDeleteConfirmation || err == errInvalidSecondFactor:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Password atau kode 2FA salah"})
+		return
+	case err == errActiveOrders:
+		c.JSON(http.StatusConflict, gin.H{"error": "Akun belum bisa dihapus karena masih ada pesanan yang sedang diproses atau dikirim"})
+		return
+	case err == errOpenReturns:
+		c.JSON(http.StatusConflict, gin.H{"error": "Akun belum bisa dihapus karena masih ada retur yang sedang diproses"})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete user"})
+		return
+	}
+
+	if err := utils.ClearLoginFailures(original.Email); err != nil {
+		log.Printf("Warning: Gagal menghapus data percobaan login user %d: %v", userID, err)
+	}
+	recordAudit(c, "user.delete", "user", userID, nil)
+	if err := utils.SendMail(utils.Mail{
+		To:      original.Email,
+		Subject: "Akun Anda telah dihapus",
+		Body: fmt.Sprintf("Halo %s,\n\nAkun Anda beserta data pribadinya telah dihapus. Catatan transaksi tetap kami simpan tanpa data pribadi sesuai kewajiban akuntansi dan perpajakan.\n\nTerima kasih telah berbelanja bersama kami.\n",
+			original.Name),
+	}); err != nil {
+		log.Printf("Warning: Gagal mengirim email penghapusan akun ke user %d: %v", userID, err)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "User deleted"})
+}
+
+// MigrateOrderRetention mengganti foreign key pesanan ke user yang lama (ON DELETE CASCADE)
+// agar penghapusan user tidak pernah ikut menghapus catatan pesanan.
+func MigrateOrderRetention() error {
+	var deleteType string
+	err := database.DB.Raw("SELECT confdeltype FROM pg_constraint WHERE conname = ?", "fk_users_orders").Scan(&deleteType).Error
+	if err != nil || deleteType != "c" {
+		return err
+	}
+	migrator := database.DB.Migrator()
+	if err := migrator.DropConstraint(&models.User{}, "Orders"); err != nil {
+		return err
+	}
+	return migrator.CreateConstraint(&models.User{}, "Orders")
+}
@@ -22,6 +22,7 @@ func CreateProduct(c *gin.Context) {
 	var input struct {
 		Name        string `form:"name" json:"name"`
 		Price       uint   `form:"price" json:"price"`
+		Stock       *uint  `form:"stock" json:"stock"`
 		Description string `form:"description" json:"description"`
 		CategoryID  uint   `form:"categoryId" json:"categoryId"`
 	}
@@ -35,6 +36,7 @@ func CreateProduct(c *gin.Context) {
 	product := models.Product{
 		Name:        input.Name,
 		Price:       input.Price,
+		Stock:       input.Stock,
 		Description: input.Description,
 		CategoryID:  input.CategoryID,
 	}
@@ -88,6 +90,10 @@ func GetProduct(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "server error"})
 		return
 	}
+	if err := applyProductListPrices(database.DB, product); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "server error"})
+		return
+	}
 	productJson, _ := json.Marshal(product)
 	utils.RedisClient.Set(ctx, chaceKey, productJson, 5*time.Minute)
 
@@ -101,14 +107,18 @@ func GetProductByID(c *gin.Context) {
 
 	chacheData, err := utils.RedisClient.Get(ctx, cacheKey).Result()
 	if err == nil {
-		log.Printf("INFO: Cache Hit untuk kunci: %s", chacheData)
-		c.JSON(http.StatusOK, chacheData)
+		log.Printf("INFO: Cache Hit untuk kunci: %s", cacheKey)
+		c.JSON(http.StatusOK, json.RawMessage(chacheData))
 		return
 	}
 	if err := database.DB.Preload("Category").First(&product, id).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "server internal error"})
 		return
 	}
+	if err := applyActivePrices(database.DB, []*models.Product{&product}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "server internal error"})
+		return
+	}
 	productJson, _ := json.Marshal(product)
 	utils.RedisClient.Set(ctx, cacheKey, productJson, 5*time.Minute)
 	c.JSON(http.StatusOK, product)
@@ -117,12 +127,15 @@ func GetProductByID(c *gin.Context) {
 func UpdateProduct(c *gin.Context) {
 	id := c.Param("id")
 	var product models.Product
-	cacheKey := fmt.Sprintf("product:%s", id)
 	//  Cari produk berdasarkan ID
 	if err := database.DB.First(&product, id).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "product not found"})
 		return
 	}
+	if err := applyActivePrices(database.DB, []*models.Product{&product}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "server internal error"})
+		return
+	}
 
 	//  Ambil form field
 	name := c.PostForm("name")
@@ -133,10 +146,24 @@ func UpdateProduct(c *gin.Context) {
 	//  Ambil file upload
 	file, _ := c.FormFile("image")
 
+	// Simpan harga dan stok lama untuk notifikasi wishlist
+	oldPrice := product.Price
+	oldActivePrice := product.ActivePrice
+	oldStock := product.Stock
+
 	product.Name = name
 	product.Price = utils.StringToUint(price)
 	product.Description = description
 	product.CategoryID = utils.StringToUint(category)
+	// stock kosong berarti stok tidak dilacak, field yang tidak dikirim tidak diubah
+	if stock, ok := c.GetPostForm("stock"); ok {
+		if stock == "" {
+			product.Stock = nil
+		} else {
+			stockValue := utils.StringToUint(stock)
+			product.Stock = &stockValue
+		}
+	}
 	fmt.Printf("Received Form Data: Name=%s, Price=%s, Description=%s, CategoryID=%s, ImageFileExists=%t\n",
 		name, price, description, category, file != nil)
 	//  Jika ada file image baru
@@ -165,10 +192,20 @@ func UpdateProduct(c *gin.Context) {
 	// Update data ke database
 	database.DB.Save(&product)
 	database.DB.First(&product, id)
-	_, redisErr := utils.RedisClient.Del(ctx, cacheKey).Result()
-	if redisErr != nil {
-		log.Printf("Warning: Gagal menghapus cache saat update: %v", redisErr)
+	if product.Price != oldPrice {
+		Id, _ := c.Get("userId")
+		adminID := utils.InterfaceToUint(Id)
+		if err := recordPriceHistory(database.DB, product.ID, oldPrice, product.Price, models.PriceSourceManual, nil, &adminID); err != nil {
+			log.Printf("Warning: Gagal mencatat riwayat harga: %v", err)
+		}
+	}
+	if err := applyActivePrices(database.DB, []*models.Product{&product}); err != nil {
+		log.Printf("Warning: Gagal menghitung harga aktif: %v", err)
+	}
+	if err := notifyWishlistWatchers(database.DB, product, oldActivePrice, oldStock); err != nil {
+		log.Printf("Warning: Gagal mengirim notifikasi wishlist: %v", err)
 	}
+	invalidateProductCache(product.ID)
 	c.JSON(http.StatusOK, gin.H{
 		"message": "product updated successfully",
 		"data":    product,
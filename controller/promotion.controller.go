@@ -0,0 +1,147 @@
+package controller
+
+import (
+	"go-be/database"
+	"go-be/models"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Struct Input DTO
+
+// PromotionInput adalah isian promo otomatis dari admin. Field gorm.Model (ID, CreatedAt, DeletedAt) tidak bisa diisi dari request.
+type PromotionInput struct {
+	Name            string     `json:"name" binding:"required"`
+	BuyProductID    *uint      `json:"buyProductId"`
+	BuyCategoryID   *uint      `json:"buyCategoryId"`
+	BuyQuantity     uint       `json:"buyQuantity"`
+	GetProductID    *uint      `json:"getProductId"`
+	GetCategoryID   *uint      `json:"getCategoryId"`
+	DiscountPercent uint       `json:"discountPercent"`
+	StartsAt        *time.Time `json:"startsAt"`
+	EndsAt          *time.Time `json:"endsAt"`
+	Active          bool       `json:"active"`
+}
+
+// Helper Functions
+
+// applyPromotionInput menyalin isian admin ke promo.
+func applyPromotionInput(promo *models.Promotion, input PromotionInput) {
+	promo.Name = input.Name
+	promo.BuyProductID = input.BuyProductID
+	promo.BuyCategoryID = input.BuyCategoryID
+	promo.BuyQuantity = input.BuyQuantity
+	promo.GetProductID = input.GetProductID
+	promo.GetCategoryID = input.GetCategoryID
+	promo.DiscountPercent = input.DiscountPercent
+	promo.StartsAt = input.StartsAt
+	promo.EndsAt = input.EndsAt
+	promo.Active = input.Active
+}
+
+// validatePromotion mengecek isian promo otomatis dari admin.
+func validatePromotion(promo *models.Promotion) string {
+	if promo.Name == "" {
+		return "Nama promo wajib diisi"
+	}
+	if promo.BuyProductID == nil && promo.BuyCategoryID == nil {
+		return "Produk atau kategori syarat beli wajib diisi"
+	}
+	if promo.GetProductID == nil && promo.GetCategoryID == nil {
+		return "Produk atau kategori yang didiskon wajib diisi"
+	}
+	if promo.DiscountPercent == 0 || promo.DiscountPercent > 100 {
+		return "Diskon promo harus 1-100 persen"
+	}
+	if promo.BuyQuantity == 0 {
+		promo.BuyQuantity = 1
+	}
+	if promo.StartsAt != nil && promo.EndsAt != nil && !promo.EndsAt.After(*promo.StartsAt) {
+		return "Waktu berakhir harus setelah waktu mulai"
+	}
+	return ""
+}
+
+// Controller Handlers
+
+// GetPromotions mengambil semua promo otomatis untuk admin.
+// Route: GET /promotion-admin
+func GetPromotions(c *gin.Context) {
+	var promotions []models.Promotion
+	if err := database.DB.Order("created_at DESC").Find(&promotions).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal mengambil promo"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Daftar promo berhasil diambil", "data": promotions})
+}
+
+// CreatePromotion membuat promo otomatis baru, misalnya beli sofa dapat meja samping diskon 50%.
+// Route: POST /promotion-admin/create
+func CreatePromotion(c *gin.Context) {
+	var input PromotionInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Input tidak valid", "details": err.Error()})
+		return
+	}
+	var promo models.Promotion
+	applyPromotionInput(&promo, input)
+	if msg := validatePromotion(&promo); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+
+	if err := database.DB.Create(&promo).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal membuat promo"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"message": "Promo berhasil dibuat", "data": promo})
+}
+
+// UpdatePromotion memperbarui promo otomatis.
+// Route: PUT /promotion-admin/update/:id
+func UpdatePromotion(c *gin.Context) {
+	var promo models.Promotion
+	if err := database.DB.First(&promo, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Promo tidak ditemukan"})
+		return
+	}
+
+	var input PromotionInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Input tidak valid", "details": err.Error()})
+		return
+	}
+	applyPromotionInput(&promo, input)
+	if msg := validatePromotion(&promo); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+
+	if err := database.DB.Save(&promo).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal memperbarui promo"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Promo berhasil diperbarui", "data": promo})
+}
+
+// DeletePromotion menghapus promo otomatis. Riwayat pemakaian tetap disimpan.
+// Route: DELETE /promotion-admin/delete/:id
+func DeletePromotion(c *gin.Context) {
+	var promo models.Promotion
+	if err := database.DB.First(&promo, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Promo tidak ditemukan"})
+		return
+	}
+
+	if err := database.DB.Delete(&promo).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal menghapus promo"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Promo berhasil dihapus"})
+}
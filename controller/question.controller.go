@@ -0,0 +1,305 @@
+package controller
+
+import (
+	"fmt"
+	"go-be/database"
+	"go-be/middleware"
+	"go-be/models"
+	"go-be/utils"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Struct Input DTO
+
+// AskQuestionInput adalah pertanyaan yang diajukan pengguna untuk sebuah produk.
+type AskQuestionInput struct {
+	Question string `json:"question" binding:"required,min=5,max=1000"`
+}
+
+// AnswerQuestionInput adalah jawaban dari admin atau pembeli terverifikasi.
+type AnswerQuestionInput struct {
+	Answer string `json:"answer" binding:"required,min=2,max=2000"`
+}
+
+// Helper Functions
+
+// selectPublicUser hanya memuat kolom user yang aman ditampilkan di halaman produk.
+func selectPublicUser(db *gorm.DB) *gorm.DB {
+	return db.Select("id", "name")
+}
+
+// isVerifiedBuyer mengecek apakah user pernah membayar pesanan yang berisi produk tersebut,
+// termasuk pesanan yang sudah dikirim atau diterima.
+func isVerifiedBuyer(db *gorm.DB, userID uint, productID uint) (bool, error) {
+	var count int64
+	err := db.Table("cart_items").
+		Joins("JOIN carts ON carts.id = cart_items.cart_id").
+		Joins("JOIN orders ON orders.id = carts.order_id").
+		Where("carts.user_id = ? AND cart_items.product_id = ?", userID, productID).
+		Where("orders.status IN ? AND orders.deleted_at IS NULL", models.PaidOrderStatuses).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// Controller Handlers
+
+// GetProductQuestions mengambil semua pertanyaan sebuah produk beserta jawabannya.
+// Jawaban diurutkan berdasarkan jumlah upvote terbanyak.
+// Route: GET /product/:id/questions
+func GetProductQuestions(c *gin.Context) {
+	productID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID produk tidak valid"})
+		return
+	}
+
+	var questions []models.ProductQuestion
+	if err := database.DB.
+		Preload("User", selectPublicUser).
+		Preload("Answers", func(db *gorm.DB) *gorm.DB {
+			return db.Order("upvotes DESC, created_at ASC")
+		}).
+		Preload("Answers.User", selectPublicUser).
+		Where("product_id = ?", productID).
+		Order("created_at DESC").
+		Find(&questions).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal mengambil pertanyaan produk"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Daftar pertanyaan berhasil diambil",
+		"data":    questions,
+	})
+}
+
+// AskQuestion membuat pertanyaan baru untuk sebuah produk.
+// Route: POST /question/create/:productId
+func AskQuestion(c *gin.Context) {
+	Id, exists := c.Get("userId")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "harus login dulu"})
+		return
+	}
+	userID := utils.InterfaceToUint(Id)
+	productID, err := strconv.ParseUint(c.Param("productId"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID produk tidak valid"})
+		return
+	}
+
+	var input AskQuestionInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Input tidak valid", "details": err.Error()})
+		return
+	}
+
+	var product models.Product
+	if err := database.DB.First(&product, productID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Produk tidak ditemukan"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Kesalahan server saat memeriksa produk"})
+		return
+	}
+
+	question := models.ProductQuestion{
+		ProductID: product.ID,
+		UserID:    userID,
+		Question:  input.Question,
+	}
+	if err := database.DB.Create(&question).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal menyimpan pertanyaan"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"message": "Pertanyaan berhasil dikirim", "data": question})
+}
+
+// AnswerQuestion menjawab pertanyaan produk.
+// Hanya admin atau pembeli terverifikasi produk tersebut yang boleh menjawab,
+// dan penanya akan mendapat notifikasi.
+// Route: POST /question/answer/:id
+func AnswerQuestion(c *gin.Context) {
+	Id, exists := c.Get("userId")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "harus login dulu"})
+		return
+	}
+	userID := utils.InterfaceToUint(Id)
+	questionID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID pertanyaan tidak valid"})
+		return
+	}
+
+	var input AnswerQuestionInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Input tidak valid", "details": err.Error()})
+		return
+	}
+
+	var question models.ProductQuestion
+	if err := database.DB.Preload("Product").First(&question, questionID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Pertanyaan tidak ditemukan"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal mengambil pertanyaan"})
+		return
+	}
+
+	var user models.User
+	if err := database.DB.First(&user, userID).Error; err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "harus login dulu"})
+		return
+	}
+
+	isAdmin := middleware.HasPermission(c, models.PermQuestionManage)
+	verifiedBuyer, err := isVerifiedBuyer(database.DB, userID, question.ProductID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal memeriksa riwayat pembelian"})
+		return
+	}
+	if !isAdmin && !verifiedBuyer {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Hanya admin atau pembeli produk ini yang dapat menjawab"})
+		return
+	}
+
+	answer := models.ProductAnswer{
+		QuestionID:      question.ID,
+		UserID:          userID,
+		Answer:          input.Answer,
+		IsAdmin:         isAdmin,
+		IsVerifiedBuyer: verifiedBuyer,
+	}
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&answer).Error; err != nil {
+			return err
+		}
+		if question.AnsweredAt == nil {
+			if err := tx.Model(&question).Update("answered_at", time.Now()).Error; err != nil {
+				return err
+			}
+		}
+		if question.UserID == userID {
+			return nil
+		}
+		message := "Pertanyaan Anda tentang produk telah dijawab"
+		if question.Product != nil {
+			message = fmt.Sprintf("Pertanyaan Anda tentang %s telah dijawab", question.Product.Name)
+		}
+		link := fmt.Sprintf("/product/%d", question.ProductID)
+		return notifyUser(tx, question.UserID, "question_answered", message, link)
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal menyimpan jawaban"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"message": "Jawaban berhasil dikirim", "data": answer})
+}
+
+// UpvoteAnswer memberi atau membatalkan upvote pada sebuah jawaban.
+// Route: POST /question/upvote/:id
+func UpvoteAnswer(c *gin.Context) {
+	Id, exists := c.Get("userId")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "harus login dulu"})
+		return
+	}
+	userID := utils.InterfaceToUint(Id)
+	answerID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID jawaban tidak valid"})
+		return
+	}
+
+	var answer models.ProductAnswer
+	if err := database.DB.First(&answer, answerID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Jawaban tidak ditemukan"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal mengambil jawaban"})
+		return
+	}
+
+	upvoted := false
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		var vote models.AnswerVote
+		result := tx.Where("answer_id = ? AND user_id = ?", answer.ID, userID).First(&vote)
+		if result.Error == gorm.ErrRecordNotFound {
+			// Belum pernah vote, tambahkan vote
+			if err := tx.Create(&models.AnswerVote{AnswerID: answer.ID, UserID: userID}).Error; err != nil {
+				return err
+			}
+			upvoted = true
+			return tx.Model(&answer).UpdateColumn("upvotes", gorm.Expr("upvotes + 1")).Error
+		} else if result.Error != nil {
+			return result.Error
+		}
+
+		// Sudah pernah vote, batalkan vote (hard delete agar unique index tetap bisa dipakai)
+		if err := tx.Unscoped().Delete(&vote).Error; err != nil {
+			return err
+		}
+		return tx.Model(&answer).UpdateColumn("upvotes", gorm.Expr("upvotes - 1")).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal memproses upvote"})
+		return
+	}
+
+	database.DB.First(&answer, answer.ID)
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Upvote berhasil diproses",
+		"upvoted": upvoted,
+		"data":    answer,
+	})
+}
+
+// GetUnansweredQuestions mengambil antrean pertanyaan yang belum dijawab untuk admin.
+// Pertanyaan terlama ditampilkan lebih dulu.
+// Route: GET /question-admin/unanswered
+func GetUnansweredQuestions(c *gin.Context) {
+	var questions []models.ProductQuestion
+	if err := database.DB.
+		Preload("User", selectPublicUser).
+		Preload("Product").
+		Where("answered_at IS NULL").
+		Order("created_at ASC").
+		Find(&questions).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal mengambil antrean pertanyaan"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Antrean pertanyaan berhasil diambil",
+		"total":   len(questions),
+		"data":    questions,
+	})
+}
+
+// DeleteQuestion menghapus pertanyaan yang tidak pantas (moderasi admin).
+// Route: DELETE /question-admin/delete/:id
+func DeleteQuestion(c *gin.Context) {
+	var question models.ProductQuestion
+	if err := database.DB.First(&question, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Pertanyaan tidak ditemukan"})
+		return
+	}
+
+	if err := database.DB.Delete(&question).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal menghapus pertanyaan"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Pertanyaan berhasil dihapus"})
+}
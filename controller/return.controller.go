@@ -0,0 +1,769 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"go-be/database"
+	"go-be/models"
+	"go-be/utils"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// errInvalidReturnTransition dikembalikan saat status retur tidak bisa diubah dari status sekarang.
+var errInvalidReturnTransition = errors.New("status retur tidak dapat diubah")
+
+// errRefundExceedsOrder dikembalikan saat total pengembalian dana melebihi total pesanan.
+var errRefundExceedsOrder = errors.New("pengembalian dana melebihi total pesanan")
+
+// errInvalidReturnItems dikembalikan saat item retur tidak valid; pesan detailnya dikirim terpisah.
+var errInvalidReturnItems = errors.New("item retur tidak valid")
+
+// Struct Input DTO
+
+// ReturnItemInput adalah baris pesanan yang ingin diretur.
+type ReturnItemInput struct {
+	CartItemID uint `json:"cartItemId" binding:"required"`
+	Quantity   uint `json:"quantity" binding:"required,min=1"`
+}
+
+// CreateReturnInput adalah permintaan retur dari pelanggan.
+type CreateReturnInput struct {
+	Items       []ReturnItemInput `json:"items" binding:"required,min=1,dive"`
+	Reason      string            `json:"reason" binding:"required"`
+	Description string            `json:"description"`
+	Resolution  string            `json:"resolution" binding:"required"` // refund atau replacement
+}
+
+// ReturnNoteInput adalah catatan admin saat menyetujui atau menolak retur.
+type ReturnNoteInput struct {
+	Note string `json:"note"`
+}
+
+// SchedulePickupInput adalah jadwal penjemputan barang retur.
+type SchedulePickupInput struct {
+	PickupAt      time.Time `json:"pickupAt" binding:"required"`
+	PickupAddress string    `json:"pickupAddress"`
+	Note          string    `json:"note"`
+}
+
+// InspectReturnInput adalah hasil pemeriksaan barang retur di gudang.
+type InspectReturnInput struct {
+	Passed  *bool  `json:"passed" binding:"required"`
+	Restock bool   `json:"restock"` // kembalikan barang ke stok jika masih layak jual
+	Note    string `json:"note"`
+}
+
+// ResolveReturnInput adalah penyelesaian retur yang lolos pemeriksaan.
+type ResolveReturnInput struct {
+	Resolution   string `json:"resolution"`   // kosong = sesuai permintaan pelanggan
+	RefundAmount *uint  `json:"refundAmount"` // kosong = nilai barang yang diretur
+	// OverrideReason wajib diisi jika refundAmount melebihi nilai barang yang diretur (misalnya ongkir ikut dikembalikan)
+	OverrideReason string `json:"overrideReason"`
+}
+
+// Helper Functions
+
+// validReturnReason mengecek alasan retur yang didukung.
+func validReturnReason(reason string) bool {
+	switch reason {
+	case models.ReturnReasonDamaged, models.ReturnReasonWrongItem, models.ReturnReasonWrongColour,
+		models.ReturnReasonNotAsDescribed, models.ReturnReasonChangedMind, models.ReturnReasonOther:
+		return true
+	}
+	return false
+}
+
+// returnLineAmount menghitung nilai yang dibayar pelanggan untuk sejumlah unit dari baris pesanan.
+func returnLineAmount(item models.CartItem, quantity uint) uint {
+	if item.Quantity == 0 {
+		return 0
+	}
+	// Item dari pesanan lama belum menyimpan rincian harga baris
+	if item.LineTotal == 0 && item.UnitPrice == 0 {
+		return item.PriceAtAdd * quantity
+	}
+	return item.LineTotal * quantity / item.Quantity
+}
+
+// returnedQuantities menghitung jumlah unit per baris pesanan yang sudah diretur
+// lewat permintaan retur yang masih berjalan atau selesai.
+func returnedQuantities(db *gorm.DB, orderID uint) (map[uint]uint, error) {
+	var rows []struct {
+		CartItemID uint
+		Quantity   uint
+	}
+	err := db.Table("return_items").
+		Select("return_items.cart_item_id, SUM(return_items.quantity) AS quantity").
+		Joins("JOIN return_requests ON return_requests.id = return_items.return_request_id AND return_requests.deleted_at IS NULL").
+		Where("return_requests.order_id = ? AND return_requests.status NOT IN ?", orderID,
+			[]string{models.ReturnStatusRejected, models.ReturnStatusCancelled, models.ReturnStatusInspectionFailed}).
+		Where("return_items.deleted_at IS NULL").
+		Group("return_items.cart_item_id").
+		Scan(&rows).Error
+	returned := map[uint]uint{}
+	for _, row := range rows {
+		returned[row.CartItemID] = row.Quantity
+	}
+	return returned, err
+}
+
+// transitionReturn mengubah status retur jika status sekarang termasuk allowedFrom,
+// mencatat riwayatnya, dan memberi tahu pelanggan.
+func transitionReturn(tx *gorm.DB, ret *models.ReturnRequest, allowedFrom []string, newStatus string, note string, actorID *uint) error {
+	allowed := false
+	for _, status := range allowedFrom {
+		if ret.Status == status {
+			allowed = true
+			break
+		}
+	}
+	if !allowed {
+		return errInvalidReturnTransition
+	}
+
+	// Update bersyarat: jika request lain sudah mengubah status lebih dulu, transisi ini gagal
+	// dan seluruh transaksi (termasuk refund/pesanan pengganti) dibatalkan
+	result := tx.Model(&models.ReturnRequest{}).
+		Where("id = ? AND status = ?", ret.ID, ret.Status).
+		Update("status", newStatus)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errInvalidReturnTransition
+	}
+	ret.Status = newStatus
+	if err := tx.Create(&models.ReturnEvent{
+		ReturnRequestID: ret.ID,
+		Status:          newStatus,
+		Note:            note,
+		ActorID:         actorID,
+	}).Error; err != nil {
+		return err
+	}
+	message := fmt.Sprintf("Status retur #%d untuk pesanan %s: %s", ret.ID, orderNumber(tx, ret.OrderID), newStatus)
+	return notifyUser(tx, ret.UserID, "return_status", message, fmt.Sprintf("/return/%d", ret.ID))
+}
+
+// createReplacementOrder membuat pesanan pengganti tanpa biaya untuk barang yang diretur.
+func createReplacementOrder(tx *gorm.DB, ret models.ReturnRequest) (models.Order, error) {
+	originalID := ret.OrderID
+	order := models.Order{
+		UserID:        ret.UserID,
+		Status:        models.OrderStatusPaid,
+		ReplacementOf: &originalID,
+	}
+	for _, item := range ret.Items {
+		order.Quantity += item.Quantity
+	}
+	if err := createOrderWithNumber(tx, &order, time.Now()); err != nil {
+		return models.Order{}, err
+	}
+
+	userID := ret.UserID
+	cart := models.Cart{UserID: &userID, OrderID: &order.ID}
+	if err := tx.Create(&cart).Error; err != nil {
+		return models.Order{}, err
+	}
+	items := make([]models.CartItem, 0, len(ret.Items))
+	for _, returned := range ret.Items {
+		items = append(items, models.CartItem{
+			CartID:         cart.ID,
+			ProductID:      returned.ProductID,
+			Quantity:       returned.Quantity,
+			PriceAtAdd:     returned.CartItem.PriceAtAdd,
+			UnitPrice:      returned.CartItem.UnitPrice,
+			DiscountAmount: returned.CartItem.UnitPrice * returned.Quantity, // pengganti tidak ditagih
+		})
+	}
+	if err := tx.Create(&items).Error; err != nil {
+		return models.Order{}, err
+	}
+	if err := reserveStock(tx, items); err != nil {
+		return models.Order{}, err
+	}
+	return order, nil
+}
+
+// lockReturnAndOrder mengunci permintaan retur dan pesanannya lalu memuat ulang status terbaru,
+// agar penyelesaian retur yang bersamaan tidak memberi refund atau pengganti dua kali.
+func lockReturnAndOrder(tx *gorm.DB, ret *models.ReturnRequest, order *models.Order) error {
+	locking := clause.Locking{Strength: "UPDATE"}
+	if err := tx.Clauses(locking).First(order, ret.OrderID).Error; err != nil {
+		return err
+	}
+	var current models.ReturnRequest
+	if err := tx.Clauses(locking).Select("id", "status").First(&current, ret.ID).Error; err != nil {
+		return err
+	}
+	ret.Status = current.Status
+	return nil
+}
+
+// refundedAmount menjumlahkan dana yang sudah dikembalikan untuk pesanan lewat retur lain.
+func refundedAmount(tx *gorm.DB, orderID uint, exceptReturnID uint) (uint, error) {
+	var total uint
+	err := tx.Model(&models.ReturnRequest{}).
+		Where("order_id = ? AND id <> ? AND status = ?", orderID, exceptReturnID, models.ReturnStatusRefunded).
+		Select("COALESCE(SUM(refund_amount), 0)").
+		Scan(&total).Error
+	return total, err
+}
+
+// findReturnForAdmin mengambil permintaan retur beserta itemnya.
+func findReturnForAdmin(db *gorm.DB, id string) (models.ReturnRequest, error) {
+	var ret models.ReturnRequest
+	err := db.Preload("Items.CartItem").First(&ret, id).Error
+	return ret, err
+}
+
+// respondReturnError mengubah error alur retur menjadi respons HTTP.
+func respondReturnError(c *gin.Context, err error, message string) {
+	switch err {
+	case errInvalidReturnTransition:
+		c.JSON(http.StatusConflict, gin.H{"error": "Status retur tidak dapat diubah dari status sekarang"})
+	case errOutOfStock:
+		c.JSON(http.StatusConflict, gin.H{"error": "Stok produk pengganti tidak mencukupi"})
+	case errRefundExceedsOrder:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Total pengembalian dana melebihi total pesanan"})
+	case gorm.ErrRecordNotFound:
+		c.JSON(http.StatusNotFound, gin.H{"error": "Pesanan tidak ditemukan"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": message})
+	}
+}
+
+// Controller Handlers
+
+// CreateReturnRequest membuat permintaan retur untuk pesanan yang sudah diterima.
+// Route: POST /return/create/:number
+func CreateReturnRequest(c *gin.Context) {
+	Id, exists := c.Get("userId")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "harus login dulu"})
+		return
+	}
+	userID := utils.InterfaceToUint(Id)
+
+	var order models.Order
+	if err := database.DB.Scopes(userOrder(userID, c.Param("number"))).First(&order).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Pesanan tidak ditemukan"})
+		return
+	}
+	if order.Status != models.OrderStatusDelivered {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Retur hanya bisa diajukan untuk pesanan yang sudah diterima"})
+		return
+	}
+	deliveredAt := order.UpdatedAt
+	if order.DeliveredAt != nil {
+		deliveredAt = *order.DeliveredAt
+	}
+	windowDays := utils.EnvUint("RETURN_WINDOW_DAYS", 14)
+	if time.Now().After(deliveredAt.AddDate(0, 0, int(windowDays))) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Batas pengajuan retur adalah %d hari setelah pesanan diterima", windowDays)})
+		return
+	}
+
+	var input CreateReturnInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Input tidak valid", "details": err.Error()})
+		return
+	}
+	if !validReturnReason(input.Reason) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Alasan retur tidak valid"})
+		return
+	}
+	if input.Resolution != models.ReturnResolutionRefund && input.Resolution != models.ReturnResolutionReplacement {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Penyelesaian retur harus refund atau replacement"})
+		return
+	}
+
+	ret := models.ReturnRequest{
+		OrderID:     order.ID,
+		UserID:      userID,
+		Status:      models.ReturnStatusRequested,
+		Reason:      input.Reason,
+		Description: input.Description,
+		Resolution:  input.Resolution,
+	}
+	var itemsError string
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		// Kunci pesanan agar dua pengajuan retur bersamaan tidak melebihi jumlah yang dibeli
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").First(&models.Order{}, order.ID).Error; err != nil {
+			return err
+		}
+		orderItems, err := orderCartItems(tx, order.ID)
+		if err != nil {
+			return err
+		}
+		itemsByID := map[uint]models.CartItem{}
+		for _, item := range orderItems {
+			itemsByID[item.ID] = item
+		}
+		returned, err := returnedQuantities(tx, order.ID)
+		if err != nil {
+			return err
+		}
+
+		for _, itemInput := range input.Items {
+			item, ok := itemsByID[itemInput.CartItemID]
+			if !ok {
+				itemsError = fmt.Sprintf("Item %d bukan bagian dari pesanan ini", itemInput.CartItemID)
+				return errInvalidReturnItems
+			}
+			if returned[item.ID]+itemInput.Quantity > item.Quantity {
+				itemsError = fmt.Sprintf("Jumlah retur item %d melebihi jumlah yang dibeli", itemInput.CartItemID)
+				return errInvalidReturnItems
+			}
+			returned[item.ID] += itemInput.Quantity
+			ret.Items = append(ret.Items, models.ReturnItem{
+				CartItemID: item.ID,
+				ProductID:  item.ProductID,
+				Quantity:   itemInput.Quantity,
+				Amount:     returnLineAmount(item, itemInput.Quantity),
+			})
+		}
+
+		if err := tx.Create(&ret).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.ReturnEvent{
+			ReturnRequestID: ret.ID,
+			Status:          models.ReturnStatusRequested,
+			Note:            input.Description,
+			ActorID:         &userID,
+		}).Error
+	})
+	if err == errInvalidReturnItems {
+		c.JSON(http.StatusBadRequest, gin.H{"error": itemsError})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal membuat permintaan retur"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"message": "Permintaan retur berhasil dibuat", "data": ret})
+}
+
+// UploadReturnPhotos mengunggah foto bukti retur (field form "photos", bisa lebih dari satu).
+// Route: POST /return/photo/:id
+func UploadReturnPhotos(c *gin.Context) {
+	Id, exists := c.Get("userId")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "harus login dulu"})
+		return
+	}
+	userID := utils.InterfaceToUint(Id)
+
+	var ret models.ReturnRequest
+	if err := database.DB.Where("id = ? AND user_id = ?", c.Param("id"), userID).First(&ret).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Permintaan retur tidak ditemukan"})
+		return
+	}
+	if ret.Status != models.ReturnStatusRequested && ret.Status != models.ReturnStatusApproved {
+		c.JSON(http.StatusConflict, gin.H{"error": "Foto tidak bisa ditambahkan pada status retur ini"})
+		return
+	}
+
+	form, err := c.MultipartForm()
+	if err != nil || len(form.File["photos"]) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "please input image"})
+		return
+	}
+
+	photos := []models.ReturnPhoto{}
+	for _, file := range form.File["photos"] {
+		tempPath := "./tempImage/" + file.Filename
+		if err := c.SaveUploadedFile(file, tempPath); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to save file"})
+			return
+		}
+		url, publicID, err := utils.UploadImage(tempPath, "returns")
+		os.Remove(tempPath)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		photo := models.ReturnPhoto{ReturnRequestID: ret.ID, Image: url, PublicID: publicID}
+		if err := database.DB.Create(&photo).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal menyimpan foto retur"})
+			return
+		}
+		photos = append(photos, photo)
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"message": "Foto retur berhasil diunggah", "data": photos})
+}
+
+// GetUserReturns mengambil semua permintaan retur milik pengguna.
+// Route: GET /return
+func GetUserReturns(c *gin.Context) {
+	Id, exists := c.Get("userId")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "harus login dulu"})
+		return
+	}
+	userID := utils.InterfaceToUint(Id)
+
+	var returns []models.ReturnRequest
+	if err := database.DB.
+		Preload("Items.Product", preloadProductWithDeleted).
+		Where("user_id = ?", userID).
+		Order("created_at DESC").
+		Find(&returns).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal mengambil daftar retur"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Daftar retur berhasil diambil", "data": returns})
+}
+
+// GetUserReturnByID mengambil detail retur beserta foto dan riwayat statusnya.
+// Route: GET /return/:id
+func GetUserReturnByID(c *gin.Context) {
+	Id, exists := c.Get("userId")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "harus login dulu"})
+		return
+	}
+	userID := utils.InterfaceToUint(Id)
+
+	var ret models.ReturnRequest
+	if err := database.DB.
+		Preload("Items.Product", preloadProductWithDeleted).
+		Preload("Photos").
+		Preload("Events", func(db *gorm.DB) *gorm.DB { return db.Order("created_at ASC") }).
+		Where("id = ? AND user_id = ?", c.Param("id"), userID).
+		First(&ret).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Permintaan retur tidak ditemukan"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Detail retur berhasil diambil", "data": ret})
+}
+
+// CancelReturnRequest membatalkan permintaan retur yang belum diproses admin.
+// Route: DELETE /return/cancel/:id
+func CancelReturnRequest(c *gin.Context) {
+	Id, exists := c.Get("userId")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "harus login dulu"})
+		return
+	}
+	userID := utils.InterfaceToUint(Id)
+
+	var ret models.ReturnRequest
+	if err := database.DB.Where("id = ? AND user_id = ?", c.Param("id"), userID).First(&ret).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Permintaan retur tidak ditemukan"})
+		return
+	}
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		return transitionReturn(tx, &ret, []string{models.ReturnStatusRequested}, models.ReturnStatusCancelled, "Dibatalkan pelanggan", &userID)
+	})
+	if err != nil {
+		respondReturnError(c, err, "Gagal membatalkan retur")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Permintaan retur berhasil dibatalkan", "data": ret})
+}
+
+// GetReturns mengambil permintaan retur untuk admin, bisa difilter dengan ?status=.
+// Route: GET /return-admin
+func GetReturns(c *gin.Context) {
+	query := database.DB.Preload("Items").Order("created_at DESC")
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	var returns []models.ReturnRequest
+	if err := query.Find(&returns).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal mengambil daftar retur"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Daftar retur berhasil diambil", "data": returns})
+}
+
+// GetReturnByID mengambil detail retur lengkap untuk admin.
+// Route: GET /return-admin/:id
+func GetReturnByID(c *gin.Context) {
+	var ret models.ReturnRequest
+	if err := database.DB.
+		Preload("Order").
+		Preload("Items.Product", preloadProductWithDeleted).
+		Preload("Photos").
+		Preload("Events", func(db *gorm.DB) *gorm.DB { return db.Order("created_at ASC") }).
+		First(&ret, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Permintaan retur tidak ditemukan"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Detail retur berhasil diambil", "data": ret})
+}
+
+// ApproveReturn menyetujui permintaan retur.
+// Route: PUT /return-admin/approve/:id
+func ApproveReturn(c *gin.Context) {
+	updateReturnWithNote(c, []string{models.ReturnStatusRequested}, models.ReturnStatusApproved, "Retur berhasil disetujui")
+}
+
+// RejectReturn menolak permintaan retur.
+// Route: PUT /return-admin/reject/:id
+func RejectReturn(c *gin.Context) {
+	updateReturnWithNote(c, []string{models.ReturnStatusRequested}, models.ReturnStatusRejected, "Retur berhasil ditolak")
+}
+
+// MarkReturnReceived menandai barang retur sudah diambil dan diterima gudang.
+// Route: PUT /return-admin/received/:id
+func MarkReturnReceived(c *gin.Context) {
+	updateReturnWithNote(c, []string{models.ReturnStatusApproved, models.ReturnStatusPickupScheduled}, models.ReturnStatusReceived, "Barang retur berhasil ditandai diterima")
+}
+
+// updateReturnWithNote menjalankan perubahan status retur sederhana dengan catatan admin.
+func updateReturnWithNote(c *gin.Context, allowedFrom []string, newStatus string, successMessage string) {
+	Id, _ := c.Get("userId")
+	adminID := utils.InterfaceToUint(Id)
+
+	ret, err := findReturnForAdmin(database.DB, c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Permintaan retur tidak ditemukan"})
+		return
+	}
+	var input ReturnNoteInput
+	if err := c.ShouldBindJSON(&input); err != nil && err != io.EOF {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Input tidak valid", "details": err.Error()})
+		return
+	}
+
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if input.Note != "" {
+			if err := tx.Model(&ret).Update("admin_note", input.Note).Error; err != nil {
+				return err
+			}
+		}
+		return transitionReturn(tx, &ret, allowedFrom, newStatus, input.Note, &adminID)
+	})
+	if err != nil {
+		respondReturnError(c, err, "Gagal memperbarui status retur")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": successMessage, "data": ret})
+}
+
+// ScheduleReturnPickup menjadwalkan penjemputan barang retur.
+// Route: PUT /return-admin/schedule-pickup/:id
+func ScheduleReturnPickup(c *gin.Context) {
+	Id, _ := c.Get("userId")
+	adminID := utils.InterfaceToUint(Id)
+
+	ret, err := findReturnForAdmin(database.DB, c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Permintaan retur tidak ditemukan"})
+		return
+	}
+	var input SchedulePickupInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Input tidak valid", "details": err.Error()})
+		return
+	}
+
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&ret).Updates(map[string]interface{}{
+			"pickup_at":      input.PickupAt,
+			"pickup_address": input.PickupAddress,
+		}).Error; err != nil {
+			return err
+		}
+		note := fmt.Sprintf("Penjemputan dijadwalkan %s. %s", input.PickupAt.Format("02 Jan 2006 15:04"), input.Note)
+		return transitionReturn(tx, &ret,
+			[]string{models.ReturnStatusApproved, models.ReturnStatusPickupScheduled},
+			models.ReturnStatusPickupScheduled, note, &adminID)
+	})
+	if err != nil {
+		respondReturnError(c, err, "Gagal menjadwalkan penjemputan")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Penjemputan retur berhasil dijadwalkan", "data": ret})
+}
+
+// InspectReturn mencatat hasil pemeriksaan barang retur dan mengembalikannya ke stok jika diminta.
+// Route: PUT /return-admin/inspect/:id
+func InspectReturn(c *gin.Context) {
+	Id, _ := c.Get("userId")
+	adminID := utils.InterfaceToUint(Id)
+
+	ret, err := findReturnForAdmin(database.DB, c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Permintaan retur tidak ditemukan"})
+		return
+	}
+	var input InspectReturnInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Input tidak valid", "details": err.Error()})
+		return
+	}
+
+	// Barang yang tidak lolos pemeriksaan (misalnya rusak) tidak boleh kembali ke stok yang dijual
+	if input.Restock && !*input.Passed {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Barang yang tidak lolos pemeriksaan tidak bisa dikembalikan ke stok"})
+		return
+	}
+
+	newStatus := models.ReturnStatusInspectionFailed
+	if *input.Passed {
+		newStatus = models.ReturnStatusInspectionPassed
+	}
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&ret).Update("inspection_note", input.Note).Error; err != nil {
+			return err
+		}
+		if err := transitionReturn(tx, &ret, []string{models.ReturnStatusReceived}, newStatus, input.Note, &adminID); err != nil {
+			return err
+		}
+		if !input.Restock {
+			return nil
+		}
+		restock := make([]models.CartItem, 0, len(ret.Items))
+		for _, item := range ret.Items {
+			restock = append(restock, models.CartItem{ProductID: item.ProductID, Quantity: item.Quantity})
+		}
+		return releaseStock(tx, restock)
+	})
+	if err != nil {
+		respondReturnError(c, err, "Gagal menyimpan hasil pemeriksaan")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Hasil pemeriksaan retur berhasil disimpan", "data": ret})
+}
+
+// ResolveReturn menyelesaikan retur yang lolos pemeriksaan dengan pengembalian dana
+// sebagai saldo toko atau pesanan pengganti.
+// Route: PUT /return-admin/resolve/:id
+func ResolveReturn(c *gin.Context) {
+	Id, _ := c.Get("userId")
+	adminID := utils.InterfaceToUint(Id)
+
+	ret, err := findReturnForAdmin(database.DB, c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Permintaan retur tidak ditemukan"})
+		return
+	}
+	var input ResolveReturnInput
+	if err := c.ShouldBindJSON(&input); err != nil && err != io.EOF {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Input tidak valid", "details": err.Error()})
+		return
+	}
+	resolution := input.Resolution
+	if resolution == "" {
+		resolution = ret.Resolution
+	}
+	if resolution != models.ReturnResolutionRefund && resolution != models.ReturnResolutionReplacement {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Penyelesaian retur harus refund atau replacement"})
+		return
+	}
+
+	var itemsAmount uint
+	for _, item := range ret.Items {
+		itemsAmount += item.Amount
+	}
+	refundAmount := itemsAmount
+	if input.RefundAmount != nil {
+		refundAmount = *input.RefundAmount
+	}
+	// Refund di atas nilai barang yang diretur harus disertai alasan dan dicatat di audit log
+	overridden := refundAmount > itemsAmount
+	if overridden && strings.TrimSpace(input.OverrideReason) == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Refund melebihi nilai barang yang diretur (Rp%d), isi overrideReason", itemsAmount)})
+		return
+	}
+
+	var order models.Order
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := lockReturnAndOrder(tx, &ret, &order); err != nil {
+			return err
+		}
+		if ret.Status != models.ReturnStatusInspectionPassed {
+			return errInvalidReturnTransition
+		}
+
+		if resolution == models.ReturnResolutionReplacement {
+			replacement, err := createReplacementOrder(tx, ret)
+			if err != nil {
+				return err
+			}
+			if err := tx.Model(&ret).Updates(map[string]interface{}{
+				"resolution":           resolution,
+				"replacement_order_id": replacement.ID,
+			}).Error; err != nil {
+				return err
+			}
+			note := fmt.Sprintf("Pesanan pengganti %s dibuat", replacement.Number)
+			return transitionReturn(tx, &ret, []string{models.ReturnStatusInspectionPassed}, models.ReturnStatusReplaced, note, &adminID)
+		}
+
+		// Total refund semua retur pada pesanan tidak boleh melebihi total pesanan
+		refunded, err := refundedAmount(tx, order.ID, ret.ID)
+		if err != nil {
+			return err
+		}
+		if refunded+refundAmount > order.TotalPrice {
+			return errRefundExceedsOrder
+		}
+
+		// Duitku tidak menyediakan API refund, dana dikembalikan sebagai saldo toko
+		orderID := order.ID
+		returnID := strconv.FormatUint(uint64(ret.ID), 10)
+		if err := addStoreCredit(tx, models.StoreCreditEntry{
+			UserID:      ret.UserID,
+			Amount:      int(refundAmount),
+			Reason:      models.CreditReasonReturn,
+			OrderID:     &orderID,
+			Note:        "Retur #" + returnID,
+			CreatedByID: &adminID,
+		}); err != nil {
+			return err
+		}
+		if err := reverseRefundedLoyaltyPoints(tx, &order, refundAmount); err != nil {
+			return err
+		}
+		if err := tx.Model(&ret).Updates(map[string]interface{}{
+			"resolution":    resolution,
+			"refund_amount": refundAmount,
+		}).Error; err != nil {
+			return err
+		}
+		note := fmt.Sprintf("Rp%d dikembalikan sebagai saldo toko", refundAmount)
+		if overridden {
+			note += " (" + input.OverrideReason + ")"
+		}
+		return transitionReturn(tx, &ret, []string{models.ReturnStatusInspectionPassed}, models.ReturnStatusRefunded, note, &adminID)
+	})
+	if err != nil {
+		respondReturnError(c, err, "Gagal menyelesaikan retur")
+		return
+	}
+	if overridden && resolution == models.ReturnResolutionRefund {
+		recordAudit(c, "return.refund_override", "return", ret.ID, gin.H{
+			"itemsAmount":  itemsAmount,
+			"refundAmount": refundAmount,
+			"reason":       input.OverrideReason,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Retur berhasil diselesaikan", "data": ret})
+}
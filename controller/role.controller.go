@@ -0,0 +1,472 @@
+package controller
+
+import (
+	"errors"
+	"go-be/database"
+	"go-be/middleware"
+	"go-be/models"
+	"go-be/utils"
+	"log"
+	"net/http"
+	"regexp"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// errLastAdmin dikembalikan saat perubahan role akan menghapus admin terakhir.
+var errLastAdmin = errors.New("harus ada minimal satu admin")
+
+// errPermissionEscalation dikembalikan saat staf memberi atau mencabut permission yang tidak ia miliki.
+var errPermissionEscalation = errors.New("tidak boleh mengubah permission yang tidak dimiliki")
+
+// roleNamePattern membatasi nama role agar aman dipakai di claim token.
+var roleNamePattern = regexp.MustCompile(`^[a-z][a-z0-9_]{2,49}$`)
+
+// Struct Input DTO
+
+// RoleInput adalah data role baru atau perubahan role.
+type RoleInput struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Permissions []string `json:"permissions" binding:"required"`
+}
+
+// AssignRolesInput adalah daftar nama role yang dimiliki user. Daftar kosong mencabut semua role.
+type AssignRolesInput struct {
+	Roles []string `json:"roles" binding:"required"`
+}
+
+// Helper Functions
+
+// tokenAccess mengambil role dan permission user untuk dimasukkan ke token akses.
+func tokenAccess(db *gorm.DB, userID uint) (utils.TokenAccess, error) {
+	roles, permissions, version, err := models.LoadUserAccess(db, userID)
+	if err != nil {
+		return utils.TokenAccess{}, err
+	}
+	return utils.TokenAccess{Roles: roles, Permissions: permissions, Version: version}, nil
+}
+
+// validPermissions mengecek semua permission dikenal. PermAll hanya untuk role admin.
+func validPermissions(permissions []string) bool {
+	for _, permission := range permissions {
+		if _, ok := models.AllPermissions[permission]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// canDelegate mengecek apakah user yang login memiliki semua permission yang ingin diberikan atau dicabut.
+// Hanya pemegang PermAll yang bisa memberi role admin atau permission di luar miliknya sendiri.
+func canDelegate(c *gin.Context, permissions []string) bool {
+	for _, permission := range permissions {
+		if !middleware.HasPermission(c, permission) {
+			return false
+		}
+	}
+	return true
+}
+
+// changedRolePermissions mengumpulkan permission dari role yang ditambahkan atau dicabut dari user.
+// Role "admin" lama yang ikut dicabut dihitung sebagai PermAll.
+func changedRolePermissions(tx *gorm.DB, user models.User, newRoles []models.Role) ([]string, error) {
+	var current []models.Role
+	if err := tx.Model(&user).Association("Roles").Find(&current); err != nil {
+		return nil, err
+	}
+	counts := map[uint]int{}
+	for _, role := range current {
+		counts[role.ID]++
+	}
+	for _, role := range newRoles {
+		counts[role.ID]--
+	}
+	changed := []uint{}
+	for id, count := range counts {
+		if count != 0 {
+			changed = append(changed, id)
+		}
+	}
+
+	permissions := []string{}
+	if len(changed) > 0 {
+		if err := tx.Model(&models.RolePermission{}).Where("role_id IN ?", changed).Pluck("permission", &permissions).Error; err != nil {
+			return nil, err
+		}
+	}
+	if user.Role == models.RoleAdmin {
+		granted := false
+		for _, role := range newRoles {
+			granted = granted || role.Name == models.RoleAdmin
+		}
+		if !granted {
+			permissions = append(permissions, models.PermAll)
+		}
+	}
+	return permissions, nil
+}
+
+// rolePermissionRows menyusun baris RolePermission tanpa duplikat.
+func rolePermissionRows(roleID uint, permissions []string) []models.RolePermission {
+	rows := []models.RolePermission{}
+	seen := map[string]bool{}
+	for _, permission := range permissions {
+		if !seen[permission] {
+			seen[permission] = true
+			rows = append(rows, models.RolePermission{RoleID: roleID, Permission: permission})
+		}
+	}
+	return rows
+}
+
+// bumpRoleVersions menaikkan versi role user agar token lama dengan role/permission usang ditolak.
+// Mengembalikan versi baru per user untuk dicatat ke Redis setelah transaksi selesai.
+func bumpRoleVersions(tx *gorm.DB, userIDs []uint) (map[uint]uint, error) {
+	versions := map[uint]uint{}
+	if len(userIDs) == 0 {
+		return versions, nil
+	}
+	if err := tx.Model(&models.User{}).
+		Where("id IN ?", userIDs).
+		UpdateColumn("role_version", gorm.Expr("role_version + 1")).Error; err != nil {
+		return nil, err
+	}
+	var users []models.User
+	if err := tx.Select("id", "role_version").Where("id IN ?", userIDs).Find(&users).Error; err != nil {
+		return nil, err
+	}
+	for _, user := range users {
+		versions[user.ID] = user.RoleVersion
+	}
+	return versions, nil
+}
+
+// publishRoleVersions mencatat versi role terbaru ke Redis untuk dicek AuthMiddleware.
+func publishRoleVersions(versions map[uint]uint) {
+	for userID, version := range versions {
+		if err := utils.SetRoleVersion(userID, version); err != nil {
+			log.Printf("Warning: Gagal mencatat versi role user %d di Redis: %v", userID, err)
+		}
+	}
+}
+
+// roleUserIDs mengambil ID user yang memiliki role.
+func roleUserIDs(db *gorm.DB, roleID uint) ([]uint, error) {
+	var ids []uint
+	err := db.Table("user_roles").Where("role_id = ?", roleID).Pluck("user_id", &ids).Error
+	return ids, err
+}
+
+// countAdmins menghitung user yang memegang role admin atau Role "admin" lama.
+func countAdmins(db *gorm.DB) (int64, error) {
+	var count int64
+	err := db.Model(&models.User{}).
+		Where("role = ? OR id IN (?)", models.RoleAdmin,
+			db.Table("user_roles").
+				Select("user_roles.user_id").
+				Joins("JOIN roles ON roles.id = user_roles.role_id").
+				Where("roles.name = ?", models.RoleAdmin)).
+		Count(&count).Error
+	return count, err
+}
+
+// SeedRoles membuat role bawaan yang belum ada dan memberi role admin ke user dengan Role "admin" lama.
+// Dipanggil sekali saat aplikasi mulai, setelah migrasi.
+func SeedRoles() error {
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		for name, permissions := range models.DefaultRolePermissions {
+			role := models.Role{Name: name, BuiltIn: true}
+			result := tx.Where("name = ?", name).FirstOrCreate(&role)
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 0 {
+				continue
+			}
+			if err := tx.Create(rolePermissionRows(role.ID, permissions)).Error; err != nil {
+				return err
+			}
+		}
+
+		var admin models.Role
+		if err := tx.Where("name = ?", models.RoleAdmin).First(&admin).Error; err != nil {
+			return err
+		}
+		return tx.Exec(`INSERT INTO user_roles (user_id, role_id)
+			SELECT id, ? FROM users WHERE role = ? AND deleted_at IS NULL
+			ON CONFLICT DO NOTHING`, admin.ID, models.RoleAdmin).Error
+	})
+}
+
+// Controller Handlers
+
+// GetRoles menampilkan semua role beserta permission-nya.
+// Route: GET /role-admin
+func GetRoles(c *gin.Context) {
+	var roles []models.Role
+	if err := database.DB.Preload("Permissions").Order("name ASC").Find(&roles).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal mengambil daftar role"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Daftar role berhasil diambil", "data": roles})
+}
+
+// GetPermissions menampilkan semua permission yang bisa diberikan ke role.
+// Route: GET /role-admin/permissions
+func GetPermissions(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"message": "Daftar permission berhasil diambil", "data": models.AllPermissions})
+}
+
+// CreateRole membuat role baru untuk staf.
+// Route: POST /role-admin/create
+func CreateRole(c *gin.Context) {
+	var input RoleInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Input tidak valid", "details": err.Error()})
+		return
+	}
+	if !roleNamePattern.MatchString(input.Name) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Nama role hanya boleh huruf kecil, angka dan garis bawah (3-50 karakter)"})
+		return
+	}
+	if !validPermissions(input.Permissions) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Permission tidak dikenal"})
+		return
+	}
+	if !canDelegate(c, input.Permissions) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Tidak bisa memberi permission yang tidak Anda miliki"})
+		return
+	}
+
+	role := models.Role{Name: input.Name, Description: input.Description}
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&role).Error; err != nil {
+			return err
+		}
+		role.Permissions = rolePermissionRows(role.ID, input.Permissions)
+		if len(role.Permissions) == 0 {
+			return nil
+		}
+		return tx.Create(&role.Permissions).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "Gagal membuat role, nama mungkin sudah dipakai"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"message": "Role berhasil dibuat", "data": role})
+}
+
+// UpdateRole mengubah deskripsi dan permission role. Role admin tidak bisa diubah.
+// Route: PUT /role-admin/update/:id
+func UpdateRole(c *gin.Context) {
+	var role models.Role
+	if err := database.DB.First(&role, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Role tidak ditemukan"})
+		return
+	}
+	if role.Name == models.RoleAdmin {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Role admin tidak bisa diubah"})
+		return
+	}
+
+	var input RoleInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Input tidak valid", "details": err.Error()})
+		return
+	}
+	if !validPermissions(input.Permissions) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Permission tidak dikenal"})
+		return
+	}
+
+	var versions map[uint]uint
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		// Permission lama dan baru sama-sama harus dimiliki pengubah role
+		var current []string
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&role, role.ID).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&models.RolePermission{}).Where("role_id = ?", role.ID).Pluck("permission", &current).Error; err != nil {
+			return err
+		}
+		if !canDelegate(c, append(current, input.Permissions...)) {
+			return errPermissionEscalation
+		}
+		if input.Description != "" {
+			if err := tx.Model(&role).Update("description", input.Description).Error; err != nil {
+				return err
+			}
+		}
+		if err := tx.Where("role_id = ?", role.ID).Delete(&models.RolePermission{}).Error; err != nil {
+			return err
+		}
+		role.Permissions = rolePermissionRows(role.ID, input.Permissions)
+		if len(role.Permissions) > 0 {
+			if err := tx.Create(&role.Permissions).Error; err != nil {
+				return err
+			}
+		}
+		userIDs, err := roleUserIDs(tx, role.ID)
+		if err != nil {
+			return err
+		}
+		versions, err = bumpRoleVersions(tx, userIDs)
+		return err
+	})
+	if err == errPermissionEscalation {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Tidak bisa mengubah permission yang tidak Anda miliki"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal memperbarui role"})
+		return
+	}
+	publishRoleVersions(versions)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Role berhasil diperbarui", "data": role})
+}
+
+// DeleteRole menghapus role buatan admin. Role bawaan tidak bisa dihapus.
+// Route: DELETE /role-admin/delete/:id
+func DeleteRole(c *gin.Context) {
+	var role models.Role
+	if err := database.DB.First(&role, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Role tidak ditemukan"})
+		return
+	}
+	if role.BuiltIn {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Role bawaan tidak bisa dihapus"})
+		return
+	}
+	var permissions []string
+	if err := database.DB.Model(&models.RolePermission{}).Where("role_id = ?", role.ID).Pluck("permission", &permissions).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal menghapus role"})
+		return
+	}
+	if !canDelegate(c, permissions) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Tidak bisa menghapus role dengan permission yang tidak Anda miliki"})
+		return
+	}
+
+	var versions map[uint]uint
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		userIDs, err := roleUserIDs(tx, role.ID)
+		if err != nil {
+			return err
+		}
+		if err := tx.Exec("DELETE FROM user_roles WHERE role_id = ?", role.ID).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("role_id = ?", role.ID).Delete(&models.RolePermission{}).Error; err != nil {
+			return err
+		}
+		// Hapus permanen agar nama role bisa dipakai lagi
+		if err := tx.Unscoped().Delete(&role).Error; err != nil {
+			return err
+		}
+		versions, err = bumpRoleVersions(tx, userIDs)
+		return err
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal menghapus role"})
+		return
+	}
+	publishRoleVersions(versions)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Role berhasil dihapus"})
+}
+
+// AssignUserRoles mengganti daftar role milik user. Perubahan langsung berlaku
+// karena token lama user ditolak sampai diperbarui.
+// Route: PUT /role-admin/assign/:userId
+func AssignUserRoles(c *gin.Context) {
+	var input AssignRolesInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Input tidak valid", "details": err.Error()})
+		return
+	}
+
+	var user models.User
+	var versions map[uint]uint
+	var unknownRole bool
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&user, c.Param("userId")).Error; err != nil {
+			return err
+		}
+		roles := []models.Role{}
+		if len(input.Roles) > 0 {
+			if err := tx.Where("name IN ?", input.Roles).Find(&roles).Error; err != nil {
+				return err
+			}
+		}
+		names := map[string]bool{}
+		for _, name := range input.Roles {
+			names[name] = true
+		}
+		if len(roles) != len(names) {
+			unknownRole = true
+			return nil
+		}
+		changed, err := changedRolePermissions(tx, user, roles)
+		if err != nil {
+			return err
+		}
+		if !canDelegate(c, changed) {
+			return errPermissionEscalation
+		}
+
+		if err := tx.Model(&user).Association("Roles").Replace(roles); err != nil {
+			return err
+		}
+		// Role "admin" lama ikut dicabut jika role admin tidak diberikan lagi
+		if user.Role == models.RoleAdmin && !names[models.RoleAdmin] {
+			if err := tx.Model(&user).Update("role", "user").Error; err != nil {
+				return err
+			}
+		}
+		admins, err := countAdmins(tx)
+		if err != nil {
+			return err
+		}
+		if admins == 0 {
+			return errLastAdmin
+		}
+
+		user.Roles = roles
+		versions, err = bumpRoleVersions(tx, []uint{user.ID})
+		return err
+	})
+	switch {
+	case err == gorm.ErrRecordNotFound:
+		c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+		return
+	case err == errLastAdmin:
+		c.JSON(http.StatusConflict, gin.H{"error": "Tidak bisa mencabut role admin dari admin terakhir"})
+		return
+	case err == errPermissionEscalation:
+		c.JSON(http.StatusForbidden, gin.H{"error": "Hanya admin yang bisa memberi atau mencabut role dengan permission yang tidak Anda miliki"})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal memperbarui role user"})
+		return
+	case unknownRole:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Role tidak dikenal"})
+		return
+	}
+	publishRoleVersions(versions)
+	recordAudit(c, "user.assign_roles", "user", user.ID, gin.H{"roles": input.Roles})
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Role user berhasil diperbarui",
+		"user": gin.H{
+			"id":    user.ID,
+			"name":  user.Name,
+			"email": user.Email,
+			"roles": input.Roles,
+		},
+	})
+}
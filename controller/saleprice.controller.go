@@ -0,0 +1,306 @@
+package controller
+
+import (
+	"fmt"
+	"go-be/database"
+	"go-be/models"
+	"go-be/utils"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// productListCacheKey adalah kunci cache Redis untuk daftar produk di GetProduct.
+const productListCacheKey = "product:list:10"
+
+// Struct Input DTO
+
+// PriceScheduleInput adalah jadwal harga diskon yang dibuat admin.
+type PriceScheduleInput struct {
+	SalePrice uint      `json:"salePrice" binding:"required"`
+	StartsAt  time.Time `json:"startsAt" binding:"required"`
+	EndsAt    time.Time `json:"endsAt" binding:"required"`
+}
+
+// Helper Functions
+
+// invalidateProductCache menghapus cache detail dan daftar produk agar harga baru langsung terlihat.
+func invalidateProductCache(productID uint) {
+	cacheKey := fmt.Sprintf("product:%d", productID)
+	if _, err := utils.RedisClient.Del(ctx, cacheKey, productListCacheKey).Result(); err != nil {
+		log.Printf("Warning: Gagal menghapus cache produk: %v", err)
+	}
+}
+
+// applyActivePrices mengisi ActivePrice, CompareAtPrice dan SaleEndsAt produk
+// berdasarkan jadwal diskon yang sedang berjalan. Jika ada beberapa jadwal yang
+// tumpang tindih, harga diskon terendah yang dipakai.
+func applyActivePrices(db *gorm.DB, products []*models.Product) error {
+	if len(products) == 0 {
+		return nil
+	}
+	productIDs := make([]uint, 0, len(products))
+	for _, product := range products {
+		product.ActivePrice = product.Price
+		product.CompareAtPrice = nil
+		product.SaleEndsAt = nil
+		productIDs = append(productIDs, product.ID)
+	}
+
+	now := time.Now()
+	var schedules []models.ProductPriceSchedule
+	if err := db.
+		Where("product_id IN ? AND starts_at <= ? AND ends_at > ?", productIDs, now, now).
+		Find(&schedules).Error; err != nil {
+		return err
+	}
+
+	active := map[uint]models.ProductPriceSchedule{}
+	for _, schedule := range schedules {
+		if current, ok := active[schedule.ProductID]; !ok || schedule.SalePrice < current.SalePrice {
+			active[schedule.ProductID] = schedule
+		}
+	}
+	for _, product := range products {
+		schedule, ok := active[product.ID]
+		if !ok || schedule.SalePrice >= product.Price {
+			continue
+		}
+		compareAt := product.Price
+		endsAt := schedule.EndsAt
+		product.ActivePrice = schedule.SalePrice
+		product.CompareAtPrice = &compareAt
+		product.SaleEndsAt = &endsAt
+	}
+	return nil
+}
+
+// applyProductListPrices adalah versi applyActivePrices untuk slice produk.
+func applyProductListPrices(db *gorm.DB, products []models.Product) error {
+	pointers := make([]*models.Product, len(products))
+	for i := range products {
+		pointers[i] = &products[i]
+	}
+	return applyActivePrices(db, pointers)
+}
+
+// applyCartItemPrices mengisi harga aktif produk pada item keranjang.
+func applyCartItemPrices(db *gorm.DB, items []models.CartItem) error {
+	pointers := make([]*models.Product, 0, len(items))
+	for i := range items {
+		if items[i].Product.ID != 0 {
+			pointers = append(pointers, &items[i].Product)
+		}
+	}
+	return applyActivePrices(db, pointers)
+}
+
+// recordPriceHistory mencatat perubahan harga produk.
+func recordPriceHistory(db *gorm.DB, productID uint, oldPrice uint, newPrice uint, source string, scheduleID *uint, changedByID *uint) error {
+	return db.Create(&models.ProductPriceHistory{
+		ProductID:   productID,
+		OldPrice:    oldPrice,
+		NewPrice:    newPrice,
+		Source:      source,
+		ScheduleID:  scheduleID,
+		ChangedByID: changedByID,
+	}).Error
+}
+
+// processPriceSchedules mencatat awal dan akhir jadwal diskon ke riwayat harga,
+// menghapus cache produk, dan memberi tahu pengguna yang menyimpan produk di wishlist.
+func processPriceSchedules(db *gorm.DB, now time.Time) error {
+	var starting []models.ProductPriceSchedule
+	if err := db.Preload("Product").
+		Where("start_logged = ? AND starts_at <= ? AND ends_at > ?", false, now, now).
+		Find(&starting).Error; err != nil {
+		return err
+	}
+	for _, schedule := range starting {
+		if schedule.Product == nil {
+			continue
+		}
+		scheduleID := schedule.ID
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := recordPriceHistory(tx, schedule.ProductID, schedule.Product.Price, schedule.SalePrice, models.PriceSourceSaleStart, &scheduleID, schedule.CreatedByID); err != nil {
+				return err
+			}
+			return tx.Model(&schedule).Update("start_logged", true).Error
+		})
+		if err != nil {
+			return err
+		}
+		invalidateProductCache(schedule.ProductID)
+
+		product := *schedule.Product
+		product.ActivePrice = schedule.SalePrice
+		if err := notifyWishlistWatchers(db, product, schedule.Product.Price, product.Stock); err != nil {
+			log.Printf("Warning: Gagal mengirim notifikasi wishlist: %v", err)
+		}
+	}
+
+	var ending []models.ProductPriceSchedule
+	if err := db.Preload("Product").
+		Where("end_logged = ? AND ends_at <= ?", false, now).
+		Find(&ending).Error; err != nil {
+		return err
+	}
+	for _, schedule := range ending {
+		scheduleID := schedule.ID
+		err := db.Transaction(func(tx *gorm.DB) error {
+			// Jadwal yang berakhir sebelum sempat dimulai tidak perlu dicatat
+			if schedule.StartLogged && schedule.Product != nil {
+				if err := recordPriceHistory(tx, schedule.ProductID, schedule.SalePrice, schedule.Product.Price, models.PriceSourceSaleEnd, &scheduleID, nil); err != nil {
+					return err
+				}
+			}
+			return tx.Model(&schedule).Updates(map[string]interface{}{"start_logged": true, "end_logged": true}).Error
+		})
+		if err != nil {
+			return err
+		}
+		invalidateProductCache(schedule.ProductID)
+	}
+	return nil
+}
+
+// RunPriceScheduler memproses jadwal diskon setiap menit. Dijalankan sebagai goroutine dari main.
+func RunPriceScheduler() {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for {
+		if err := processPriceSchedules(database.DB, time.Now()); err != nil {
+			log.Printf("Warning: Gagal memproses jadwal harga: %v", err)
+		}
+		<-ticker.C
+	}
+}
+
+// Controller Handlers
+
+// CreatePriceSchedule menjadwalkan harga diskon untuk sebuah produk.
+// Route: POST /product-admin/price-schedule/:id
+func CreatePriceSchedule(c *gin.Context) {
+	Id, _ := c.Get("userId")
+	adminID := utils.InterfaceToUint(Id)
+
+	var product models.Product
+	if err := database.DB.First(&product, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Produk tidak ditemukan"})
+		return
+	}
+
+	var input PriceScheduleInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Input tidak valid", "details": err.Error()})
+		return
+	}
+	if input.SalePrice >= product.Price {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Harga diskon harus lebih rendah dari harga normal"})
+		return
+	}
+	if !input.EndsAt.After(input.StartsAt) || !input.EndsAt.After(time.Now()) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Waktu berakhir harus setelah waktu mulai dan di masa depan"})
+		return
+	}
+
+	var overlapping int64
+	database.DB.Model(&models.ProductPriceSchedule{}).
+		Where("product_id = ? AND starts_at < ? AND ends_at > ?", product.ID, input.EndsAt, input.StartsAt).
+		Count(&overlapping)
+	if overlapping > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Jadwal diskon bertabrakan dengan jadwal lain untuk produk ini"})
+		return
+	}
+
+	schedule := models.ProductPriceSchedule{
+		ProductID:   product.ID,
+		SalePrice:   input.SalePrice,
+		StartsAt:    input.StartsAt,
+		EndsAt:      input.EndsAt,
+		CreatedByID: &adminID,
+	}
+	if err := database.DB.Create(&schedule).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal membuat jadwal harga"})
+		return
+	}
+
+	// Jadwal yang langsung aktif diproses sekarang, tanpa menunggu scheduler
+	if !schedule.StartsAt.After(time.Now()) {
+		if err := processPriceSchedules(database.DB, time.Now()); err != nil {
+			log.Printf("Warning: Gagal memproses jadwal harga: %v", err)
+		}
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"message": "Jadwal harga berhasil dibuat", "data": schedule})
+}
+
+// GetPriceSchedules mengambil semua jadwal harga diskon sebuah produk.
+// Route: GET /product-admin/price-schedule/:id
+func GetPriceSchedules(c *gin.Context) {
+	var schedules []models.ProductPriceSchedule
+	if err := database.DB.
+		Where("product_id = ?", c.Param("id")).
+		Order("starts_at DESC").
+		Find(&schedules).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal mengambil jadwal harga"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Jadwal harga berhasil diambil", "data": schedules})
+}
+
+// DeletePriceSchedule membatalkan jadwal harga diskon. Jika diskon sedang berjalan,
+// akhir diskon dicatat di riwayat harga.
+// Route: DELETE /product-admin/delete-price-schedule/:id
+func DeletePriceSchedule(c *gin.Context) {
+	Id, _ := c.Get("userId")
+	adminID := utils.InterfaceToUint(Id)
+	scheduleID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID jadwal tidak valid"})
+		return
+	}
+
+	var schedule models.ProductPriceSchedule
+	if err := database.DB.Preload("Product").First(&schedule, scheduleID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Jadwal harga tidak ditemukan"})
+		return
+	}
+
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if schedule.StartLogged && !schedule.EndLogged && schedule.Product != nil {
+			id := schedule.ID
+			if err := recordPriceHistory(tx, schedule.ProductID, schedule.SalePrice, schedule.Product.Price, models.PriceSourceSaleEnd, &id, &adminID); err != nil {
+				return err
+			}
+		}
+		return tx.Delete(&schedule).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal menghapus jadwal harga"})
+		return
+	}
+	invalidateProductCache(schedule.ProductID)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Jadwal harga berhasil dihapus"})
+}
+
+// GetPriceHistory mengambil riwayat perubahan harga sebuah produk.
+// Route: GET /product-admin/price-history/:id
+func GetPriceHistory(c *gin.Context) {
+	var history []models.ProductPriceHistory
+	if err := database.DB.
+		Where("product_id = ?", c.Param("id")).
+		Order("created_at DESC").
+		Find(&history).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal mengambil riwayat harga"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Riwayat harga berhasil diambil", "data": history})
+}
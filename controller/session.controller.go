@@ -0,0 +1,348 @@
+package controller
+
+import (
+	"errors"
+	"go-be/database"
+	"go-be/models"
+	"go-be/utils"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// errInvalidRefreshToken dikembalikan saat refresh token tidak dikenal, kedaluwarsa atau sudah dicabut.
+var errInvalidRefreshToken = errors.New("refresh token tidak valid")
+
+// Struct Input DTO
+
+// RefreshTokenInput adalah refresh token yang ditukar dengan token akses baru.
+type RefreshTokenInput struct {
+	RefreshToken string `json:"refreshToken" binding:"required"`
+}
+
+// AuthTokens adalah pasangan token yang dikirim ke klien setelah login atau refresh.
+type AuthTokens struct {
+	Token        string `json:"token"` // token akses berumur pendek
+	RefreshToken string `json:"refreshToken"`
+	ExpiresIn    int    `json:"expiresIn"` // detik sampai token akses kedaluwarsa
+}
+
+// Helper Functions
+
+// refreshTokenTTL adalah masa berlaku refresh token (REFRESH_TOKEN_TTL_DAYS, default 30 hari).
+func refreshTokenTTL() time.Duration {
+	return time.Duration(utils.EnvUint("REFRESH_TOKEN_TTL_DAYS", 30)) * 24 * time.Hour
+}
+
+// issueTokens membuat token akses untuk sesi beserta refresh token barunya.
+func issueTokens(session models.Session, refreshToken string) (AuthTokens, error) {
+	access, err := tokenAccess(database.DB, session.UserID)
+	if err != nil {
+		return AuthTokens{}, err
+	}
+	access.TwoFactor = session.TwoFactor
+	if session.ImpersonatorID != nil {
+		// Sesi impersonasi tidak pernah membawa hak akses staf
+		access.Roles, access.Permissions, access.TwoFactor = []string{}, []string{}, false
+		access.ImpersonatorID = *session.ImpersonatorID
+	}
+	accessToken, err := utils.GenerateToken(session.UserID, session.ID, access)
+	if err != nil {
+		return AuthTokens{}, err
+	}
+	return AuthTokens{
+		Token:        accessToken,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int(utils.AccessTokenTTL().Seconds()),
+	}, nil
+}
+
+// startSession membuat sesi login baru untuk perangkat yang sedang request.
+// twoFactor menandai login yang sudah lolos verifikasi 2FA.
+func startSession(c *gin.Context, userID uint, twoFactor bool) (AuthTokens, error) {
+	refreshToken, err := utils.RandomToken(32)
+	if err != nil {
+		return AuthTokens{}, err
+	}
+	now := time.Now()
+	session := models.Session{
+		UserID:           userID,
+		RefreshTokenHash: utils.HashToken(refreshToken),
+		UserAgent:        c.Request.UserAgent(),
+		IP:               c.ClientIP(),
+		LastUsedAt:       now,
+		ExpiresAt:        now.Add(refreshTokenTTL()),
+		TwoFactor:        twoFactor,
+	}
+	if err := database.DB.Create(&session).Error; err != nil {
+		return AuthTokens{}, err
+	}
+	return issueTokens(session, refreshToken)
+}
+
+// beginSignIn dipanggil setelah faktor pertama (password atau provider OIDC) berhasil.
+// Akun dengan 2FA baru mendapat token setelah kode kedua diverifikasi di /sign-in/2fa.
+func beginSignIn(c *gin.Context, user models.User) {
+	if user.DisabledAt != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": "account disabled, please contact support"})
+		return
+	}
+	if user.PasswordResetRequired {
+		if allowEmailRequest("reset-password", user.Email) {
+			if err := sendPasswordResetEmail(user); err != nil {
+				log.Printf("Warning: Gagal mengirim email reset password ke user %d: %v", user.ID, err)
+			}
+		}
+		c.JSON(http.StatusForbidden, gin.H{
+			"error":                 "password reset required, check your email",
+			"passwordResetRequired": true,
+		})
+		return
+	}
+	if user.TwoFactorEnabledAt == nil {
+		completeSignIn(c, user.ID, false)
+		return
+	}
+	challenge, err := utils.GenerateActionToken(utils.PurposeTwoFactorLogin, user.ID, user.TwoFactorSecret, twoFactorChallengeTTL)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create token"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message":           "Two-factor authentication required",
+		"twoFactorRequired": true,
+		"challengeToken":    challenge,
+		"expiresIn":         int(twoFactorChallengeTTL.Seconds()),
+	})
+}
+
+// completeSignIn membuat sesi login, menggabungkan keranjang tamu lalu mengirim token ke klien.
+func completeSignIn(c *gin.Context, userID uint, twoFactor bool) {
+	tokens, err := startSession(c, userID, twoFactor)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create token"})
+		return
+	}
+
+	// Gabungkan keranjang tamu (jika ada) ke keranjang aktif user
+	mergedItems := mergeGuestCartFromRequest(c, userID)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":         "User login successfully",
+		"token":           tokens.Token,
+		"refreshToken":    tokens.RefreshToken,
+		"expiresIn":       tokens.ExpiresIn,
+		"cartMergedItems": mergedItems,
+	})
+}
+
+// revokeSessions mencabut sesi di database lalu memasukkannya ke daftar pencabutan Redis.
+func revokeSessions(db *gorm.DB, sessions []models.Session) error {
+	if len(sessions) == 0 {
+		return nil
+	}
+	ids := make([]uint, 0, len(sessions))
+	for _, session := range sessions {
+		ids = append(ids, session.ID)
+	}
+	if err := db.Model(&models.Session{}).
+		Where("id IN ? AND revoked_at IS NULL", ids).
+		Update("revoked_at", time.Now()).Error; err != nil {
+		return err
+	}
+	for _, id := range ids {
+		// Jika Redis gagal, token akses sesi ini masih berlaku sampai kedaluwarsa (maks. ACCESS_TOKEN_TTL_MINUTES)
+		if err := utils.RevokeSession(id); err != nil {
+			log.Printf("Warning: Gagal mencatat pencabutan sesi %d di Redis: %v", id, err)
+		}
+	}
+	return nil
+}
+
+// revokeUserSessions mencabut semua sesi aktif user, termasuk token lama tanpa sesi.
+func revokeUserSessions(db *gorm.DB, userID uint) error {
+	var sessions []models.Session
+	if err := db.Select("id").Where("user_id = ? AND revoked_at IS NULL", userID).Find(&sessions).Error; err != nil {
+		return err
+	}
+	if err := revokeSessions(db, sessions); err != nil {
+		return err
+	}
+	if err := utils.RevokeUserTokens(userID); err != nil {
+		log.Printf("Warning: Gagal mencabut token lama user %d di Redis: %v", userID, err)
+	}
+	return nil
+}
+
+// Controller Handlers
+
+// RefreshToken menukar refresh token dengan token akses dan refresh token baru.
+// Refresh token lama yang dipakai ulang dianggap bocor sehingga sesinya langsung dicabut.
+// Route: POST /refresh-token
+func RefreshToken(c *gin.Context) {
+	var input RefreshTokenInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Input tidak valid", "details": err.Error()})
+		return
+	}
+	tokenHash := utils.HashToken(input.RefreshToken)
+
+	newRefreshToken, err := utils.RandomToken(32)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal membuat refresh token"})
+		return
+	}
+
+	var session models.Session
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("refresh_token_hash = ?", tokenHash).
+			First(&session).Error
+		if err == gorm.ErrRecordNotFound {
+			return errInvalidRefreshToken
+		}
+		if err != nil {
+			return err
+		}
+		if session.RevokedAt != nil || time.Now().After(session.ExpiresAt) {
+			return errInvalidRefreshToken
+		}
+
+		session.PreviousTokenHash = session.RefreshTokenHash
+		session.RefreshTokenHash = utils.HashToken(newRefreshToken)
+		session.LastUsedAt = time.Now()
+		session.IP = c.ClientIP()
+		return tx.Model(&session).
+			Select("PreviousTokenHash", "RefreshTokenHash", "LastUsedAt", "IP").
+			Updates(session).Error
+	})
+	if err == errInvalidRefreshToken {
+		// Refresh token yang sudah dirotasi dipakai lagi: kemungkinan dicuri, cabut sesinya
+		var stolen models.Session
+		if database.DB.Where("previous_token_hash = ? AND revoked_at IS NULL", tokenHash).First(&stolen).Error == nil {
+			if err := revokeSessions(database.DB, []models.Session{stolen}); err != nil {
+				log.Printf("Warning: Gagal mencabut sesi %d: %v", stolen.ID, err)
+			}
+		}
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Refresh token tidak valid atau sudah kedaluwarsa, silakan login ulang"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal memperbarui token"})
+		return
+	}
+
+	tokens, err := issueTokens(session, newRefreshToken)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create token"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Token berhasil diperbarui", "data": tokens})
+}
+
+// Logout mengakhiri sesi perangkat yang sedang dipakai.
+// Token lama tanpa sesi dicabut bersama semua token lama milik user.
+// Route: POST /logout
+func Logout(c *gin.Context) {
+	Id, _ := c.Get("userId")
+	userID := utils.InterfaceToUint(Id)
+	sid, _ := c.Get("sessionId")
+	sessionID := utils.InterfaceToUint(sid)
+
+	if sessionID == 0 {
+		if err := utils.RevokeUserTokens(userID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal logout"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Logout berhasil"})
+		return
+	}
+
+	session := models.Session{}
+	session.ID = sessionID
+	if err := revokeSessions(database.DB, []models.Session{session}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal logout"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Logout berhasil"})
+}
+
+// LogoutAll mengakhiri semua sesi user di semua perangkat.
+// Route: POST /logout-all
+func LogoutAll(c *gin.Context) {
+	Id, _ := c.Get("userId")
+	userID := utils.InterfaceToUint(Id)
+
+	if err := revokeUserSessions(database.DB, userID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal logout dari semua perangkat"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Berhasil logout dari semua perangkat"})
+}
+
+// GetSessions menampilkan sesi login aktif milik user.
+// Route: GET /users/sessions
+func GetSessions(c *gin.Context) {
+	Id, _ := c.Get("userId")
+	userID := utils.InterfaceToUint(Id)
+	sid, _ := c.Get("sessionId")
+	currentID := utils.InterfaceToUint(sid)
+
+	var sessions []models.Session
+	if err := database.DB.
+		Where("user_id = ? AND revoked_at IS NULL AND expires_at > ?", userID, time.Now()).
+		Order("last_used_at DESC").
+		Find(&sessions).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal mengambil daftar sesi"})
+		return
+	}
+
+	data := make([]gin.H, 0, len(sessions))
+	for _, session := range sessions {
+		data = append(data, gin.H{
+			"id":         session.ID,
+			"userAgent":  session.UserAgent,
+			"ip":         session.IP,
+			"createdAt":  session.CreatedAt,
+			"lastUsedAt": session.LastUsedAt,
+			"expiresAt":  session.ExpiresAt,
+			"current":    session.ID == currentID,
+		})
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Daftar sesi berhasil diambil", "data": data})
+}
+
+// RevokeSession mengakhiri salah satu sesi milik user, misalnya perangkat yang hilang.
+// Route: DELETE /users/sessions/:id
+func RevokeSession(c *gin.Context) {
+	Id, _ := c.Get("userId")
+	userID := utils.InterfaceToUint(Id)
+
+	var session models.Session
+	if err := database.DB.Where("id = ? AND user_id = ? AND revoked_at IS NULL", c.Param("id"), userID).First(&session).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Sesi tidak ditemukan"})
+		return
+	}
+	if err := revokeSessions(database.DB, []models.Session{session}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal mencabut sesi"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Sesi berhasil dicabut"})
+}
+
+// GetJWKS menampilkan kunci publik untuk memverifikasi token akses, dipakai aplikasi mobile
+// dan layanan lain tanpa perlu berbagi JWT_SECRET.
+// Route: GET /.well-known/jwks.json
+func GetJWKS(c *gin.Context) {
+	jwks, err := utils.JWKS()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal memuat kunci JWT"})
+		return
+	}
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, jwks)
+}
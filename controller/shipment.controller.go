@@ -0,0 +1,453 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"go-be/database"
+	"go-be/models"
+	"go-be/utils"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// errInvalidShipmentTransition dikembalikan saat status pengiriman tidak bisa diubah ke status tujuan.
+var errInvalidShipmentTransition = errors.New("status pengiriman tidak dapat diubah")
+
+// shipmentStatusRank adalah urutan status pengiriman; status hanya boleh maju.
+var shipmentStatusRank = map[string]int{
+	models.ShipmentStatusPending:        0,
+	models.ShipmentStatusShipped:        1,
+	models.ShipmentStatusInTransit:      2,
+	models.ShipmentStatusOutForDelivery: 3,
+	models.ShipmentStatusDelivered:      4,
+}
+
+// shippedStatuses adalah status paket yang sudah diserahkan ke kurir.
+var shippedStatuses = []string{
+	models.ShipmentStatusShipped,
+	models.ShipmentStatusInTransit,
+	models.ShipmentStatusOutForDelivery,
+	models.ShipmentStatusDelivered,
+}
+
+// Struct Input DTO
+
+// ShipmentItemInput adalah baris pesanan yang dimasukkan ke paket.
+type ShipmentItemInput struct {
+	CartItemID uint `json:"cartItemId" binding:"required"`
+	Quantity   uint `json:"quantity" binding:"required,min=1"`
+}
+
+// CreateShipmentInput adalah data paket baru untuk sebuah pesanan.
+type CreateShipmentInput struct {
+	Items          []ShipmentItemInput `json:"items" binding:"required,min=1,dive"`
+	Warehouse      string              `json:"warehouse"`
+	Carrier        string              `json:"carrier"`
+	TrackingNumber string              `json:"trackingNumber"`
+	Note           string              `json:"note"`
+	EstimatedAt    *time.Time          `json:"estimatedAt"`
+}
+
+// UpdateShipmentInput adalah perubahan data kurir dan resi. Field kosong tidak diubah.
+type UpdateShipmentInput struct {
+	Warehouse      *string    `json:"warehouse"`
+	Carrier        *string    `json:"carrier"`
+	TrackingNumber *string    `json:"trackingNumber"`
+	Note           *string    `json:"note"`
+	EstimatedAt    *time.Time `json:"estimatedAt"`
+}
+
+// ShipmentStatusInput adalah pembaruan status pelacakan paket.
+// Status yang sama boleh dikirim ulang untuk mencatat lokasi terbaru.
+type ShipmentStatusInput struct {
+	Status      string     `json:"status" binding:"required"`
+	Location    string     `json:"location"`
+	Description string     `json:"description"`
+	OccurredAt  *time.Time `json:"occurredAt"` // kosong = sekarang
+}
+
+// Helper Functions
+
+// shipmentQuantities menghitung jumlah unit per baris pesanan yang ada di paket berstatus statuses.
+func shipmentQuantities(db *gorm.DB, orderID uint, statuses []string) (map[uint]uint, error) {
+	var rows []struct {
+		CartItemID uint
+		Quantity   uint
+	}
+	err := db.Table("shipment_items").
+		Select("shipment_items.cart_item_id, SUM(shipment_items.quantity) AS quantity").
+		Joins("JOIN shipments ON shipments.id = shipment_items.shipment_id AND shipments.deleted_at IS NULL").
+		Where("shipments.order_id = ? AND shipments.status IN ?", orderID, statuses).
+		Where("shipment_items.deleted_at IS NULL").
+		Group("shipment_items.cart_item_id").
+		Scan(&rows).Error
+	quantities := map[uint]uint{}
+	for _, row := range rows {
+		quantities[row.CartItemID] = row.Quantity
+	}
+	return quantities, err
+}
+
+// syncOrderShipmentStatus menyesuaikan status pesanan dengan status paket-paketnya:
+// Delivered jika semua unit sudah diterima, Shipped jika semua sudah dikirim,
+// dan PartiallyShipped jika baru sebagian yang dikirim.
+func syncOrderShipmentStatus(tx *gorm.DB, order *models.Order) error {
+	switch order.Status {
+	case models.OrderStatusPaid, models.OrderStatusPartiallyShipped, models.OrderStatusShipped:
+	default:
+		return nil
+	}
+
+	items, err := orderCartItems(tx, order.ID)
+	if err != nil {
+		return err
+	}
+	shipped, err := shipmentQuantities(tx, order.ID, shippedStatuses)
+	if err != nil {
+		return err
+	}
+	delivered, err := shipmentQuantities(tx, order.ID, []string{models.ShipmentStatusDelivered})
+	if err != nil {
+		return err
+	}
+
+	var total, totalShipped, totalDelivered uint
+	for _, item := range items {
+		total += item.Quantity
+		totalShipped += min(shipped[item.ID], item.Quantity)
+		totalDelivered += min(delivered[item.ID], item.Quantity)
+	}
+
+	newStatus := models.OrderStatusPaid
+	switch {
+	case total > 0 && totalDelivered == total:
+		newStatus = models.OrderStatusDelivered
+	case total > 0 && totalShipped == total:
+		newStatus = models.OrderStatusShipped
+	case totalShipped > 0:
+		newStatus = models.OrderStatusPartiallyShipped
+	}
+	return updateOrderStatus(tx, order, newStatus)
+}
+
+// transitionShipment mengubah status paket, mencatat riwayat pelacakan,
+// lalu menyesuaikan status pesanannya.
+func transitionShipment(tx *gorm.DB, shipment *models.Shipment, input ShipmentStatusInput) error {
+	if input.Status == models.ShipmentStatusCancelled {
+		if shipment.Status != models.ShipmentStatusPending {
+			return errInvalidShipmentTransition
+		}
+	} else {
+		newRank, ok := shipmentStatusRank[input.Status]
+		currentRank, current := shipmentStatusRank[shipment.Status]
+		if !ok || !current || newRank < currentRank {
+			return errInvalidShipmentTransition
+		}
+		// Status yang sama hanya bermakna sebagai checkpoint selama paket dalam perjalanan
+		if newRank == currentRank && (input.Status == models.ShipmentStatusPending || input.Status == models.ShipmentStatusDelivered) {
+			return errInvalidShipmentTransition
+		}
+	}
+
+	occurredAt := time.Now()
+	if input.OccurredAt != nil {
+		occurredAt = *input.OccurredAt
+	}
+	changed := shipment.Status != input.Status
+	updates := map[string]interface{}{"status": input.Status}
+	if input.Status != models.ShipmentStatusCancelled && input.Status != models.ShipmentStatusPending && shipment.ShippedAt == nil {
+		updates["shipped_at"] = occurredAt
+		shipment.ShippedAt = &occurredAt
+	}
+	if input.Status == models.ShipmentStatusDelivered {
+		updates["delivered_at"] = occurredAt
+		shipment.DeliveredAt = &occurredAt
+	}
+	if err := tx.Model(shipment).Updates(updates).Error; err != nil {
+		return err
+	}
+	shipment.Status = input.Status
+
+	event := models.ShipmentEvent{
+		ShipmentID:  shipment.ID,
+		Status:      input.Status,
+		Location:    input.Location,
+		Description: input.Description,
+		OccurredAt:  occurredAt,
+	}
+	if err := tx.Create(&event).Error; err != nil {
+		return err
+	}
+	shipment.Events = append(shipment.Events, event)
+
+	var order models.Order
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&order, shipment.OrderID).Error; err != nil {
+		return err
+	}
+	if changed {
+		message := fmt.Sprintf("Paket #%d dari pesanan %s: %s", shipment.ID, order.Number, input.Status)
+		if shipment.TrackingNumber != "" {
+			message = fmt.Sprintf("%s (%s %s)", message, shipment.Carrier, shipment.TrackingNumber)
+		}
+		if err := notifyUser(tx, order.UserID, "shipment_status", message, "/oder/tracking/"+order.Number); err != nil {
+			return err
+		}
+	}
+	return syncOrderShipmentStatus(tx, &order)
+}
+
+// Controller Handlers
+
+// GetOrderTracking menampilkan status pesanan, paket-paketnya beserta riwayat pelacakan,
+// dan item yang belum dikirim.
+// Route: GET /oder/tracking/:number
+func GetOrderTracking(c *gin.Context) {
+	Id, exists := c.Get("userId")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "harus login dulu"})
+		return
+	}
+	userID := utils.InterfaceToUint(Id)
+
+	var order models.Order
+	if err := database.DB.
+		Preload("Shipments", "status <> ?", models.ShipmentStatusCancelled).
+		Preload("Shipments.Items.Product", preloadProductWithDeleted).
+		Preload("Shipments.Events", func(db *gorm.DB) *gorm.DB { return db.Order("occurred_at ASC") }).
+		Scopes(userOrder(userID, c.Param("number"))).
+		First(&order).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Pesanan tidak ditemukan atau bukan milik Anda"})
+		return
+	}
+
+	items, err := orderCartItems(database.DB, order.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal mengambil item pesanan"})
+		return
+	}
+	packed, err := shipmentQuantities(database.DB, order.ID, append([]string{models.ShipmentStatusPending}, shippedStatuses...))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal mengambil data pengiriman"})
+		return
+	}
+	unshipped := []gin.H{}
+	for _, item := range items {
+		if packed[item.ID] < item.Quantity {
+			unshipped = append(unshipped, gin.H{
+				"cartItemId": item.ID,
+				"productId":  item.ProductID,
+				"quantity":   item.Quantity - packed[item.ID],
+			})
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Status pengiriman berhasil diambil",
+		"data": gin.H{
+			"orderId":        order.ID,
+			"status":         order.Status,
+			"deliveredAt":    order.DeliveredAt,
+			"shipments":      order.Shipments,
+			"unshippedItems": unshipped,
+		},
+	})
+}
+
+// GetOrderShipments menampilkan semua paket sebuah pesanan, termasuk yang dibatalkan.
+// Route: GET /shipment-admin/order/:orderId
+func GetOrderShipments(c *gin.Context) {
+	var shipments []models.Shipment
+	if err := database.DB.
+		Preload("Items.Product", preloadProductWithDeleted).
+		Preload("Events", func(db *gorm.DB) *gorm.DB { return db.Order("occurred_at ASC") }).
+		Where("order_id = ?", c.Param("orderId")).
+		Order("created_at ASC").
+		Find(&shipments).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal mengambil data pengiriman"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Data pengiriman berhasil diambil", "data": shipments})
+}
+
+// CreateShipment membuat paket baru berisi sebagian atau seluruh item pesanan yang sudah dibayar.
+// Route: POST /shipment-admin/create/:orderId
+func CreateShipment(c *gin.Context) {
+	var input CreateShipmentInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Input tidak valid", "details": err.Error()})
+		return
+	}
+
+	var shipment models.Shipment
+	var validationError string
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		// Kunci pesanan agar dua admin tidak mengemas unit yang sama bersamaan
+		var order models.Order
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&order, c.Param("orderId")).Error; err != nil {
+			return err
+		}
+		if order.Status != models.OrderStatusPaid && order.Status != models.OrderStatusPartiallyShipped {
+			validationError = "Paket hanya bisa dibuat untuk pesanan yang sudah dibayar dan belum terkirim semua"
+			return nil
+		}
+
+		items, err := orderCartItems(tx, order.ID)
+		if err != nil {
+			return err
+		}
+		itemsByID := map[uint]models.CartItem{}
+		for _, item := range items {
+			itemsByID[item.ID] = item
+		}
+		packed, err := shipmentQuantities(tx, order.ID, append([]string{models.ShipmentStatusPending}, shippedStatuses...))
+		if err != nil {
+			return err
+		}
+
+		shipment = models.Shipment{
+			OrderID:        order.ID,
+			Warehouse:      input.Warehouse,
+			Carrier:        input.Carrier,
+			TrackingNumber: input.TrackingNumber,
+			Status:         models.ShipmentStatusPending,
+			Note:           input.Note,
+			EstimatedAt:    input.EstimatedAt,
+		}
+		for _, itemInput := range input.Items {
+			item, ok := itemsByID[itemInput.CartItemID]
+			if !ok {
+				validationError = fmt.Sprintf("Item %d bukan bagian dari pesanan ini", itemInput.CartItemID)
+				return nil
+			}
+			if packed[item.ID]+itemInput.Quantity > item.Quantity {
+				validationError = fmt.Sprintf("Jumlah item %d melebihi sisa yang belum dikirim", itemInput.CartItemID)
+				return nil
+			}
+			packed[item.ID] += itemInput.Quantity
+			shipment.Items = append(shipment.Items, models.ShipmentItem{
+				CartItemID: item.ID,
+				ProductID:  item.ProductID,
+				Quantity:   itemInput.Quantity,
+			})
+		}
+
+		if err := tx.Create(&shipment).Error; err != nil {
+			return err
+		}
+		event := models.ShipmentEvent{
+			ShipmentID:  shipment.ID,
+			Status:      models.ShipmentStatusPending,
+			Location:    input.Warehouse,
+			Description: "Paket sedang dikemas",
+			OccurredAt:  time.Now(),
+		}
+		if err := tx.Create(&event).Error; err != nil {
+			return err
+		}
+		shipment.Events = []models.ShipmentEvent{event}
+		return nil
+	})
+	if err == gorm.ErrRecordNotFound {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Pesanan tidak ditemukan"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal membuat paket pengiriman"})
+		return
+	}
+	if validationError != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": validationError})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"message": "Paket pengiriman berhasil dibuat", "data": shipment})
+}
+
+// UpdateShipment mengubah data gudang, kurir, nomor resi atau estimasi tiba sebuah paket.
+// Route: PUT /shipment-admin/update/:id
+func UpdateShipment(c *gin.Context) {
+	var shipment models.Shipment
+	if err := database.DB.First(&shipment, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Paket pengiriman tidak ditemukan"})
+		return
+	}
+	if shipment.Status == models.ShipmentStatusCancelled || shipment.Status == models.ShipmentStatusDelivered {
+		c.JSON(http.StatusConflict, gin.H{"error": "Paket yang sudah selesai tidak bisa diubah"})
+		return
+	}
+
+	var input UpdateShipmentInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Input tidak valid", "details": err.Error()})
+		return
+	}
+	if input.Warehouse != nil {
+		shipment.Warehouse = *input.Warehouse
+	}
+	if input.Carrier != nil {
+		shipment.Carrier = *input.Carrier
+	}
+	if input.TrackingNumber != nil {
+		shipment.TrackingNumber = *input.TrackingNumber
+	}
+	if input.Note != nil {
+		shipment.Note = *input.Note
+	}
+	if input.EstimatedAt != nil {
+		shipment.EstimatedAt = input.EstimatedAt
+	}
+
+	if err := database.DB.Model(&shipment).
+		Select("Warehouse", "Carrier", "TrackingNumber", "Note", "EstimatedAt").
+		Updates(shipment).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal memperbarui paket pengiriman"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Paket pengiriman berhasil diperbarui", "data": shipment})
+}
+
+// UpdateShipmentStatus memperbarui status pelacakan paket dan menyesuaikan status pesanannya.
+// Route: PUT /shipment-admin/status/:id
+func UpdateShipmentStatus(c *gin.Context) {
+	var input ShipmentStatusInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Input tidak valid", "details": err.Error()})
+		return
+	}
+
+	var shipment models.Shipment
+	var validationError string
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&shipment, c.Param("id")).Error; err != nil {
+			return err
+		}
+		if input.Status != models.ShipmentStatusCancelled && input.Status != models.ShipmentStatusPending &&
+			(shipment.Carrier == "" || shipment.TrackingNumber == "") {
+			validationError = "Isi kurir dan nomor resi sebelum paket dikirim"
+			return nil
+		}
+		return transitionShipment(tx, &shipment, input)
+	})
+	switch {
+	case err == gorm.ErrRecordNotFound:
+		c.JSON(http.StatusNotFound, gin.H{"error": "Paket pengiriman tidak ditemukan"})
+		return
+	case err == errInvalidShipmentTransition:
+		c.JSON(http.StatusConflict, gin.H{"error": "Status paket tidak dapat diubah dari status sekarang"})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal memperbarui status paket"})
+		return
+	case validationError != "":
+		c.JSON(http.StatusBadRequest, gin.H{"error": validationError})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Status paket berhasil diperbarui", "data": shipment})
+}
@@ -0,0 +1,88 @@
+package controller
+
+import (
+	"go-be/database"
+	"go-be/models"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Struct Input DTO
+
+// CategoryTaxInput adalah tarif PPN khusus kategori. taxRate null berarti kembali ke tarif default.
+type CategoryTaxInput struct {
+	TaxRate *uint `json:"taxRate"`
+}
+
+// UserTaxInput adalah status pajak pelanggan B2B.
+type UserTaxInput struct {
+	TaxExempt *bool   `json:"taxExempt" binding:"required"`
+	TaxID     *string `json:"taxId"`
+}
+
+// Controller Handlers
+
+// UpdateCategoryTax mengatur tarif PPN khusus untuk sebuah kategori.
+// Route: PUT /category-admin/tax/:id
+func UpdateCategoryTax(c *gin.Context) {
+	var category models.Category
+	if err := database.DB.First(&category, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "category tidak ditemukan"})
+		return
+	}
+
+	var input CategoryTaxInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Input tidak valid", "details": err.Error()})
+		return
+	}
+	if input.TaxRate != nil && *input.TaxRate > 100 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Tarif PPN harus 0-100 persen"})
+		return
+	}
+
+	if err := database.DB.Model(&category).Update("tax_rate", input.TaxRate).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal memperbarui tarif PPN kategori"})
+		return
+	}
+	category.TaxRate = input.TaxRate
+
+	c.JSON(http.StatusOK, gin.H{"message": "Tarif PPN kategori berhasil diperbarui", "data": category})
+}
+
+// UpdateUserTax mengatur status bebas PPN dan NPWP pelanggan B2B.
+// Route: PUT /user-admin/tax/:id
+func UpdateUserTax(c *gin.Context) {
+	var user models.User
+	if err := database.DB.First(&user, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+		return
+	}
+
+	var input UserTaxInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Input tidak valid", "details": err.Error()})
+		return
+	}
+
+	user.TaxExempt = *input.TaxExempt
+	if input.TaxID != nil {
+		user.TaxID = *input.TaxID
+	}
+	if err := database.DB.Model(&user).Select("TaxExempt", "TaxID").Updates(user).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal memperbarui status pajak user"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Status pajak user berhasil diperbarui",
+		"user": gin.H{
+			"id":        user.ID,
+			"name":      user.Name,
+			"email":     user.Email,
+			"taxExempt": user.TaxExempt,
+			"taxId":     user.TaxID,
+		},
+	})
+}
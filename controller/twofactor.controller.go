@@ -0,0 +1,424 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"go-be/database"
+	"go-be/models"
+	"go-be/utils"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// twoFactorChallengeTTL adalah batas waktu memasukkan kode 2FA setelah password benar.
+const twoFactorChallengeTTL = 5 * time.Minute
+
+// recoveryCodeCount adalah jumlah kode cadangan yang dibuat setiap kali 2FA diaktifkan.
+const recoveryCodeCount = 10
+
+// errInvalidSecondFactor dikembalikan saat kode TOTP atau kode cadangan salah.
+var errInvalidSecondFactor = errors.New("kode 2FA tidak valid")
+
+// Struct Input DTO
+
+// TwoFactorCodeInput adalah kode dari aplikasi authenticator atau kode cadangan.
+type TwoFactorCodeInput struct {
+	Code string `json:"code" binding:"required"`
+}
+
+// DisableTwoFactorInput adalah konfirmasi password dan kode 2FA untuk mematikan 2FA.
+type DisableTwoFactorInput struct {
+	Password string `json:"password" binding:"required"`
+	Code     string `json:"code" binding:"required"`
+}
+
+// SignInTwoFactorInput adalah langkah kedua login untuk akun dengan 2FA.
+type SignInTwoFactorInput struct {
+	ChallengeToken string `json:"challengeToken" binding:"required"`
+	Code           string `json:"code" binding:"required"`
+}
+
+// Helper Functions
+
+// twoFactorIssuer adalah nama layanan yang tampil di aplikasi authenticator (TOTP_ISSUER, default COMPANY_NAME).
+func twoFactorIssuer() string {
+	if issuer := os.Getenv("TOTP_ISSUER"); issuer != "" {
+		return issuer
+	}
+	if name := os.Getenv("COMPANY_NAME"); name != "" {
+		return name
+	}
+	return "Go Market"
+}
+
+// normalizeRecoveryCode membuang tanda hubung dan spasi agar kode cadangan bisa diketik bebas.
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToUpper(code)
+	return strings.NewReplacer("-", "", " ", "").Replace(code)
+}
+
+// generateRecoveryCodes mengganti kode cadangan user dengan yang baru dan mengembalikan kode aslinya.
+// Kode asli hanya ditampilkan sekali; database menyimpan hash-nya.
+func generateRecoveryCodes(tx *gorm.DB, userID uint) ([]string, error) {
+	if err := tx.Unscoped().Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error; err != nil {
+		return nil, err
+	}
+	codes := make([]string, 0, recoveryCodeCount)
+	rows := make([]models.RecoveryCode, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		code, err := utils.RandomCode(10)
+		if err != nil {
+			return nil, err
+		}
+		codes = append(codes, code[:5]+"-"+code[5:])
+		rows = append(rows, models.RecoveryCode{UserID: userID, CodeHash: utils.HashToken(code)})
+	}
+	if err := tx.Create(&rows).Error; err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// verifySecondFactor mengecek kode TOTP atau kode cadangan milik user. Kode yang cocok langsung
+// ditandai terpakai. user harus sudah dikunci (SELECT ... FOR UPDATE) di dalam tx.
+func verifySecondFactor(tx *gorm.DB, user *models.User, code string) error {
+	if step, ok := utils.ValidateTOTP(user.TwoFactorSecret, code, time.Now(), user.TwoFactorLastStep); ok {
+		user.TwoFactorLastStep = step
+		return tx.Model(user).UpdateColumn("two_factor_last_step", step).Error
+	}
+
+	normalized := normalizeRecoveryCode(code)
+	if len(normalized) != 10 {
+		return errInvalidSecondFactor
+	}
+	result := tx.Model(&models.RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", user.ID, utils.HashToken(normalized)).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errInvalidSecondFactor
+	}
+	return nil
+}
+
+// withLockedUser menjalankan fn di dalam transaksi dengan baris user dikunci, agar kode TOTP
+// yang sama tidak bisa dipakai dua kali oleh request bersamaan.
+func withLockedUser(userID uint, fn func(tx *gorm.DB, user *models.User) error) error {
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		var user models.User
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&user, userID).Error; err != nil {
+			return err
+		}
+		return fn(tx, &user)
+	})
+}
+
+// twoFactorBind mengambil secret 2FA user saat ini; token langkah kedua login hangus jika 2FA dimatikan atau diganti.
+func twoFactorBind(userID uint) (string, error) {
+	var user models.User
+	if err := database.DB.Select("id", "two_factor_secret").First(&user, userID).Error; err != nil {
+		return "", err
+	}
+	return user.TwoFactorSecret, nil
+}
+
+// upgradeSessionTwoFactor menandai sesi yang sedang dipakai sudah lolos 2FA dan mengembalikan token barunya.
+func upgradeSessionTwoFactor(sessionID uint) (*AuthTokens, error) {
+	if sessionID == 0 {
+		return nil, nil
+	}
+	refreshToken, err := utils.RandomToken(32)
+	if err != nil {
+		return nil, err
+	}
+	var session models.Session
+	if err := database.DB.First(&session, sessionID).Error; err != nil {
+		return nil, err
+	}
+	session.PreviousTokenHash = session.RefreshTokenHash
+	session.RefreshTokenHash = utils.HashToken(refreshToken)
+	session.TwoFactor = true
+	if err := database.DB.Model(&session).
+		Select("PreviousTokenHash", "RefreshTokenHash", "TwoFactor").
+		Updates(session).Error; err != nil {
+		return nil, err
+	}
+	tokens, err := issueTokens(session, refreshToken)
+	if err != nil {
+		return nil, err
+	}
+	return &tokens, nil
+}
+
+// Controller Handlers
+
+// GetTwoFactorStatus menampilkan status 2FA user yang login.
+// Route: GET /users/2fa
+func GetTwoFactorStatus(c *gin.Context) {
+	Id, _ := c.Get("userId")
+	userID := utils.InterfaceToUint(Id)
+
+	var user models.User
+	if err := database.DB.First(&user, userID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+		return
+	}
+	var remaining int64
+	if err := database.DB.Model(&models.RecoveryCode{}).
+		Where("user_id = ? AND used_at IS NULL", userID).
+		Count(&remaining).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal mengambil status 2FA"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Status 2FA berhasil diambil",
+		"data": gin.H{
+			"enabled":                user.TwoFactorEnabledAt != nil,
+			"enabledAt":              user.TwoFactorEnabledAt,
+			"recoveryCodesRemaining": remaining,
+		},
+	})
+}
+
+// SetupTwoFactor membuat secret TOTP baru untuk didaftarkan ke aplikasi authenticator.
+// 2FA belum aktif sampai kode pertama dikonfirmasi lewat /users/2fa/enable.
+// Route: POST /users/2fa/setup
+func SetupTwoFactor(c *gin.Context) {
+	Id, _ := c.Get("userId")
+	userID := utils.InterfaceToUint(Id)
+
+	var user models.User
+	if err := database.DB.First(&user, userID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+		return
+	}
+	if user.TwoFactorEnabledAt != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "2FA sudah aktif"})
+		return
+	}
+
+	secret, err := utils.GenerateTOTPSecret()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal membuat secret 2FA"})
+		return
+	}
+	if err := database.DB.Model(&user).Update("two_factor_pending_secret", secret).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal menyimpan secret 2FA"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Pindai QR code lalu konfirmasi dengan kode dari aplikasi authenticator",
+		"data": gin.H{
+			"secret":          secret,
+			"provisioningUri": utils.TOTPProvisioningURI(twoFactorIssuer(), user.Email, secret),
+		},
+	})
+}
+
+// EnableTwoFactor mengaktifkan 2FA setelah kode pertama dari aplikasi authenticator benar.
+// Mengembalikan kode cadangan (hanya sekali) dan token baru untuk sesi ini yang sudah lolos 2FA.
+// Route: POST /users/2fa/enable
+func EnableTwoFactor(c *gin.Context) {
+	Id, _ := c.Get("userId")
+	userID := utils.InterfaceToUint(Id)
+	sid, _ := c.Get("sessionId")
+	sessionID := utils.InterfaceToUint(sid)
+
+	var input TwoFactorCodeInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Input tidak valid", "details": err.Error()})
+		return
+	}
+
+	var codes []string
+	err := withLockedUser(userID, func(tx *gorm.DB, user *models.User) error {
+		if user.TwoFactorEnabledAt != nil || user.TwoFactorPendingSecret == "" {
+			return errInvalidSecondFactor
+		}
+		step, ok := utils.ValidateTOTP(user.TwoFactorPendingSecret, input.Code, time.Now(), 0)
+		if !ok {
+			return errInvalidSecondFactor
+		}
+		now := time.Now()
+		if err := tx.Model(user).Updates(map[string]interface{}{
+			"two_factor_secret":         user.TwoFactorPendingSecret,
+			"two_factor_pending_secret": "",
+			"two_factor_last_step":      step,
+			"two_factor_enabled_at":     now,
+		}).Error; err != nil {
+			return err
+		}
+		var err error
+		codes, err = generateRecoveryCodes(tx, user.ID)
+		return err
+	})
+	if err == errInvalidSecondFactor {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Kode 2FA salah atau 2FA belum disiapkan lewat /users/2fa/setup"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal mengaktifkan 2FA"})
+		return
+	}
+
+	response := gin.H{
+		"message":       "2FA berhasil diaktifkan. Simpan kode cadangan di tempat aman",
+		"recoveryCodes": codes,
+	}
+	tokens, err := upgradeSessionTwoFactor(sessionID)
+	if err != nil {
+		log.Printf("Warning: Gagal memperbarui sesi %d setelah 2FA aktif: %v", sessionID, err)
+	} else if tokens != nil {
+		response["data"] = tokens
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// DisableTwoFactor mematikan 2FA dengan konfirmasi password dan kode 2FA.
+// Sesi yang ada tidak lagi dianggap lolos 2FA sehingga akses staf hilang sampai 2FA diaktifkan lagi.
+// Route: POST /users/2fa/disable
+func DisableTwoFactor(c *gin.Context) {
+	Id, _ := c.Get("userId")
+	userID := utils.InterfaceToUint(Id)
+
+	var input DisableTwoFactorInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Input tidak valid", "details": err.Error()})
+		return
+	}
+
+	var versions map[uint]uint
+	err := withLockedUser(userID, func(tx *gorm.DB, user *models.User) error {
+		if user.TwoFactorEnabledAt == nil {
+			return errInvalidSecondFactor
+		}
+		if err := utils.ReverseHash(input.Password, user.Password); err != nil {
+			return errInvalidSecondFactor
+		}
+		if err := verifySecondFactor(tx, user, input.Code); err != nil {
+			return err
+		}
+		if err := tx.Model(user).Updates(map[string]interface{}{
+			"two_factor_secret":     "",
+			"two_factor_last_step":  0,
+			"two_factor_enabled_at": nil,
+		}).Error; err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Where("user_id = ?", user.ID).Delete(&models.RecoveryCode{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&models.Session{}).Where("user_id = ?", user.ID).Update("two_factor", false).Error; err != nil {
+			return err
+		}
+		// Token akses yang masih membawa claim 2FA harus diperbarui lewat refresh token
+		var err error
+		versions, err = bumpRoleVersions(tx, []uint{user.ID})
+		return err
+	})
+	if err == errInvalidSecondFactor {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Password atau kode 2FA salah"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal mematikan 2FA"})
+		return
+	}
+
+	publishRoleVersions(versions)
+	c.JSON(http.StatusOK, gin.H{"message": "2FA berhasil dimatikan"})
+}
+
+// RegenerateRecoveryCodes membuat ulang kode cadangan; kode lama tidak berlaku lagi.
+// Route: POST /users/2fa/recovery-codes
+func RegenerateRecoveryCodes(c *gin.Context) {
+	Id, _ := c.Get("userId")
+	userID := utils.InterfaceToUint(Id)
+
+	var input TwoFactorCodeInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Input tidak valid", "details": err.Error()})
+		return
+	}
+
+	var codes []string
+	err := withLockedUser(userID, func(tx *gorm.DB, user *models.User) error {
+		if user.TwoFactorEnabledAt == nil {
+			return errInvalidSecondFactor
+		}
+		if err := verifySecondFactor(tx, user, input.Code); err != nil {
+			return err
+		}
+		var err error
+		codes, err = generateRecoveryCodes(tx, user.ID)
+		return err
+	})
+	if err == errInvalidSecondFactor {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Kode 2FA salah atau 2FA belum aktif"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal membuat kode cadangan"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message":       "Kode cadangan baru berhasil dibuat. Simpan di tempat aman",
+		"recoveryCodes": codes,
+	})
+}
+
+// SignInTwoFactor adalah langkah kedua login untuk akun dengan 2FA: menukar challengeToken dari
+// /sign-in dan kode TOTP (atau kode cadangan) dengan token akses.
+// Route: POST /sign-in/2fa
+func SignInTwoFactor(c *gin.Context) {
+	var input SignInTwoFactorInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "please input correctly"})
+		return
+	}
+
+	userID, err := utils.ReverseActionToken(input.ChallengeToken, utils.PurposeTwoFactorLogin, twoFactorBind)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Sesi login 2FA tidak valid atau sudah kedaluwarsa, silakan login ulang"})
+		return
+	}
+
+	// Batasi tebakan kode per akun; 6 digit terlalu mudah ditebak tanpa batas
+	allowed, _, err := utils.AllowRequest(fmt.Sprintf("sign-in-2fa:user:%d", userID), 5, twoFactorChallengeTTL)
+	if err != nil {
+		log.Printf("Warning: Rate limit 2FA tidak aktif, Redis error: %v", err)
+	}
+	if !allowed {
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "too many login attempts, please try again later"})
+		return
+	}
+
+	err = withLockedUser(userID, func(tx *gorm.DB, user *models.User) error {
+		// Akun bisa dinonaktifkan admin di antara langkah pertama dan kedua login
+		if user.TwoFactorEnabledAt == nil || user.DisabledAt != nil {
+			return errInvalidSecondFactor
+		}
+		return verifySecondFactor(tx, user, input.Code)
+	})
+	if err == errInvalidSecondFactor {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid two-factor code"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "server error"})
+		return
+	}
+
+	completeSignIn(c, userID, true)
+}
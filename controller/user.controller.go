@@ -4,27 +4,44 @@ import (
 	"go-be/database"
 	"go-be/models"
 	"go-be/utils"
+	"log"
 	"net/http"
+	"net/mail"
+	"strconv"
+	"strings"
+	"sync"
 
 	"github.com/gin-gonic/gin"
 	"github.com/joho/godotenv"
+	"gorm.io/gorm"
 )
 
+// SignUpInput adalah data pendaftaran akun baru.
+type SignUpInput struct {
+	Name     string `json:"name" binding:"required"`
+	Email    string `json:"email" binding:"required,email"`
+	Password string `json:"password" binding:"required,min=8,max=72"`
+}
+
 func SignUp(c *gin.Context) {
-	var user models.User
+	var input SignUpInput
 	godotenv.Load()
 
-	if err := c.ShouldBindJSON(&user); err != nil {
+	if err := c.ShouldBindJSON(&input); err != nil {
 		c.JSON(http.StatusUnprocessableEntity, gin.H{
 			"error": "please input correctly",
 		})
 		return
 	}
+	user := models.User{Name: input.Name, Email: utils.NormalizeEmail(input.Email), Password: input.Password}
 
-	var existUser models.User
-
-	if err := database.DB.Where("email = ?", user.Email).Find(&existUser).Error; err != nil {
-		c.JSON(http.StatusNotAcceptable, gin.H{
+	taken, err := emailTaken(database.DB, user.Email, 0)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "server error"})
+		return
+	}
+	if taken {
+		c.JSON(http.StatusConflict, gin.H{
 			"error": "email already taken",
 		})
 		return
@@ -42,10 +59,20 @@ func SignUp(c *gin.Context) {
 	user.Role = string("user")
 
 	if err := database.DB.Create(&user).Error; err != nil {
+		// Pendaftaran bersamaan dengan email yang sama ditolak unique index
+		if utils.IsUniqueViolation(err) {
+			c.JSON(http.StatusConflict, gin.H{"error": "email already taken"})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "server failed to create user"})
 		return
 	}
-	tokenString, err := utils.GenerateToken(user.ID)
+	if err := sendVerificationEmail(user); err != nil {
+		// Pendaftaran tetap berhasil, user bisa minta kirim ulang lewat /users/resend-verification
+		log.Printf("Warning: Gagal mengirim email verifikasi ke user %d: %v", user.ID, err)
+	}
+
+	tokens, err := startSession(c, user.ID, false)
 	//secret := os.Getenv(("JWT_SECRET"))
 
 	//claim := jwt.MapClaims{
@@ -59,15 +86,27 @@ func SignUp(c *gin.Context) {
 		return
 	}
 
+	// Gabungkan keranjang tamu (jika ada) ke keranjang user baru
+	mergedItems := mergeGuestCartFromRequest(c, user.ID)
+
 	c.JSON(http.StatusOK, gin.H{
-		"message": "User created successfully",
-		"token":   tokenString,
+		"message":         "User created successfully",
+		"token":           tokens.Token,
+		"refreshToken":    tokens.RefreshToken,
+		"expiresIn":       tokens.ExpiresIn,
+		"cartMergedItems": mergedItems,
 	})
 
 }
 
+// SignInInput adalah email dan password untuk login.
+type SignInInput struct {
+	Email    string `json:"email" binding:"required"`
+	Password string `json:"password" binding:"required"`
+}
+
 func SignIn(c *gin.Context) {
-	var input models.User
+	var input SignInInput
 	if err := c.ShouldBindJSON(&input); err != nil {
 		c.JSON(http.StatusUnprocessableEntity, gin.H{
 			"error": "please input correctly",
@@ -75,28 +114,44 @@ func SignIn(c *gin.Context) {
 		return
 	}
 
-	var user models.User
-	if err := database.DB.Where("email = ?", input.Email).First(&user).Error; err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
-		return
-	}
+	email := utils.NormalizeEmail(input.Email)
+	ip := c.ClientIP()
 
-	err := utils.ReverseHash(input.Password, user.Password)
+	retryAfter, err := utils.LoginRetryAfter(email, ip)
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "wrong password"})
+		log.Printf("Warning: Perlindungan brute-force login tidak aktif, Redis error: %v", err)
+	}
+	if retryAfter > 0 {
+		c.Header("Retry-After", strconv.Itoa(int(retryAfter.Seconds())+1))
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "too many login attempts, please try again later"})
 		return
 	}
 
-	tokenString, err := utils.GenerateToken(user.ID)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create token"})
+	// Pesan gagal sama untuk email tidak terdaftar dan password salah agar email terdaftar tidak bisa ditebak
+	var user models.User
+	found := database.DB.Where("LOWER(email) = ?", email).First(&user).Error == nil
+	passwordHash := user.Password
+	if !found {
+		passwordHash = dummyPasswordHash()
+	}
+	if err := utils.ReverseHash(input.Password, passwordHash); err != nil || !found {
+		failure, err := utils.RecordLoginFailure(email, ip)
+		if err != nil {
+			log.Printf("Warning: Gagal mencatat percobaan login gagal: %v", err)
+		}
+		if failure.AccountLocked && found {
+			if err := sendAccountLockedEmail(user, ip); err != nil {
+				log.Printf("Warning: Gagal mengirim email akun terkunci ke user %d: %v", user.ID, err)
+			}
+		}
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid email or password"})
 		return
 	}
+	if err := utils.ClearLoginFailures(email); err != nil {
+		log.Printf("Warning: Gagal menghapus penghitung login gagal: %v", err)
+	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"message": "User login successfully",
-		"token":   tokenString,
-	})
+	beginSignIn(c, user)
 }
 func GetUserById(c *gin.Context) {
 	var user models.User
@@ -115,15 +170,6 @@ func GetUserById(c *gin.Context) {
 
 	c.JSON(http.StatusOK, user)
 }
-func GetUser(c *gin.Context) {
-	var user []models.User
-
-	if err := database.DB.Find(&user).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error server"})
-	}
-
-	c.JSON(http.StatusOK, user)
-}
 func UpdateUser(c *gin.Context) {
 	userID, existUser := c.Get("userId")
 	if !existUser {
@@ -141,6 +187,7 @@ func UpdateUser(c *gin.Context) {
 		Email     string `json:"email"`
 		Password  string `json:"password"`
 		AddressId *uint  `json:"addressId"`
+		TaxID     string `json:"taxId"`
 	}
 	if err := c.ShouldBindJSON(&input); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid input"})
@@ -150,12 +197,30 @@ func UpdateUser(c *gin.Context) {
 	if input.Name != "" {
 		user.Name = input.Name
 	}
-	if input.Email != "" {
-		user.Email = input.Email
+	email := utils.NormalizeEmail(input.Email)
+	emailChanged := email != "" && email != user.Email
+	if emailChanged {
+		if _, err := mail.ParseAddress(email); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid email"})
+			return
+		}
+		taken, err := emailTaken(database.DB, email, user.ID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "server error"})
+			return
+		}
+		if taken {
+			c.JSON(http.StatusConflict, gin.H{"error": "email already taken"})
+			return
+		}
+		user.Email = email
 	}
 	if input.AddressId != nil {
 		user.AddressID = input.AddressId
 	}
+	if input.TaxID != "" {
+		user.TaxID = input.TaxID
+	}
 	if input.Password != "" {
 		hash, err := utils.HashPassword(input.Password)
 		if err != nil {
@@ -167,10 +232,26 @@ func UpdateUser(c *gin.Context) {
 
 	// Simpan ke database
 	if err := database.DB.Model(&user).Updates(user).Error; err != nil {
+		if utils.IsUniqueViolation(err) {
+			c.JSON(http.StatusConflict, gin.H{"error": "email already taken"})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update user"})
 		return
 	}
 
+	// Email baru harus diverifikasi ulang
+	if emailChanged {
+		user.EmailVerifiedAt = nil
+		if err := database.DB.Model(&user).Update("email_verified_at", nil).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update user"})
+			return
+		}
+		if err := sendVerificationEmail(user); err != nil {
+			log.Printf("Warning: Gagal mengirim email verifikasi ke user %d: %v", user.ID, err)
+		}
+	}
+
 	c.JSON(http.StatusOK, gin.H{
 		"message": "user updated successfully",
 		"user": gin.H{
@@ -182,21 +263,74 @@ func UpdateUser(c *gin.Context) {
 	})
 }
 
-func DeleteUser(c *gin.Context) {
-	id, existUser := c.Get("user_id")
-	if !existUser {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
-		return
+var (
+	dummyHash     string
+	dummyHashOnce sync.Once
+)
+
+// dummyPasswordHash adalah hash bcrypt acak untuk dibandingkan saat email tidak terdaftar,
+// sehingga waktu respons login tidak membocorkan apakah email terdaftar.
+func dummyPasswordHash() string {
+	dummyHashOnce.Do(func() {
+		random, _ := utils.RandomToken(16)
+		dummyHash, _ = utils.HashPassword(random)
+	})
+	return dummyHash
+}
+
+// emailTaken mengecek apakah email (tanpa membedakan huruf besar/kecil) sudah dipakai user lain.
+func emailTaken(db *gorm.DB, email string, exceptUserID uint) (bool, error) {
+	var count int64
+	err := db.Model(&models.User{}).
+		Where("LOWER(email) = ? AND id <> ?", utils.NormalizeEmail(email), exceptUserID).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// EmailDuplicate adalah sekelompok akun yang memakai email yang sama (tanpa membedakan huruf besar/kecil).
+type EmailDuplicate struct {
+	Email   string
+	UserIDs []uint
+}
+
+// MigrateUserEmails menormalkan email user lama lalu memasang unique index LOWER(email).
+// Jika masih ada email ganda, email tersebut tidak diubah, index tidak dipasang dan daftar duplikat
+// dikembalikan agar bisa diselesaikan admin. Dipanggil sekali saat aplikasi mulai, setelah migrasi.
+func MigrateUserEmails() ([]EmailDuplicate, error) {
+	var rows []struct {
+		Email   string
+		UserIDs string
 	}
-	var user models.User
-	if err := database.DB.First(&user, id).Error; err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
-		return
+	if err := database.DB.Raw(`SELECT LOWER(TRIM(email)) AS email, STRING_AGG(id::text, ',' ORDER BY id) AS user_ids
+		FROM users WHERE deleted_at IS NULL
+		GROUP BY LOWER(TRIM(email)) HAVING COUNT(*) > 1`).Scan(&rows).Error; err != nil {
+		return nil, err
 	}
-	if err := database.DB.Delete(&user).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete user"})
-		return
+
+	duplicates := make([]EmailDuplicate, 0, len(rows))
+	emails := make([]string, 0, len(rows))
+	for _, row := range rows {
+		duplicate := EmailDuplicate{Email: row.Email}
+		for _, id := range strings.Split(row.UserIDs, ",") {
+			duplicate.UserIDs = append(duplicate.UserIDs, utils.StringToUint(id))
+		}
+		duplicates = append(duplicates, duplicate)
+		emails = append(emails, row.Email)
+	}
+
+	normalize := database.DB.Model(&models.User{}).Where("email <> LOWER(TRIM(email))")
+	if len(emails) > 0 {
+		normalize = normalize.Where("LOWER(TRIM(email)) NOT IN ?", emails)
+	}
+	if err := normalize.UpdateColumn("email", gorm.Expr("LOWER(TRIM(email))")).Error; err != nil {
+		return duplicates, err
+	}
+	if len(duplicates) > 0 {
+		return duplicates, nil
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "User deleted"})
+	// Akun yang sudah dihapus tidak ikut dicek agar email-nya bisa dipakai mendaftar lagi
+	err := database.DB.Exec(`CREATE UNIQUE INDEX IF NOT EXISTS idx_users_email_lower
+		ON users (LOWER(email)) WHERE deleted_at IS NULL`).Error
+	return nil, err
 }
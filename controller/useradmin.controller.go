@@ -0,0 +1,434 @@
+package controller
+
+import (
+	"encoding/json"
+	"go-be/database"
+	"go-be/middleware"
+	"go-be/models"
+	"go-be/utils"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Struct Input DTO
+
+// AdminReasonInput adalah alasan tindakan admin yang dicatat di audit log.
+type AdminReasonInput struct {
+	Reason string `json:"reason" binding:"required,min=5,max=500"`
+}
+
+// Helper Functions
+
+// pageParams membaca ?page=&limit= dengan batas limit 100.
+func pageParams(c *gin.Context) (uint, uint) {
+	page := utils.StringToUint(c.DefaultQuery("page", "1"))
+	if page == 0 {
+		page = 1
+	}
+	limit := utils.StringToUint(c.DefaultQuery("limit", "20"))
+	if limit == 0 || limit > 100 {
+		limit = 20
+	}
+	return page, limit
+}
+
+// impersonationTTL adalah masa berlaku sesi impersonasi (IMPERSONATION_TTL_MINUTES, default 60 menit).
+func impersonationTTL() time.Duration {
+	return time.Duration(utils.EnvUint("IMPERSONATION_TTL_MINUTES", 60)) * time.Minute
+}
+
+// recordAudit mencatat tindakan admin yang sedang login. Kegagalan hanya dicatat di log
+// agar tindakan yang sudah berhasil tidak dilaporkan gagal.
+func recordAudit(c *gin.Context, action, targetType string, targetID uint, detail gin.H) {
+	Id, _ := c.Get("userId")
+	entry := models.AuditLog{
+		ActorID:    utils.InterfaceToUint(Id),
+		Action:     action,
+		TargetType: targetType,
+		TargetID:   targetID,
+		IP:         c.ClientIP(),
+		UserAgent:  c.Request.UserAgent(),
+	}
+	if impersonator, ok := c.Get("impersonatorId"); ok {
+		id := utils.InterfaceToUint(impersonator)
+		entry.ImpersonatorID = &id
+	}
+	if detail != nil {
+		raw, _ := json.Marshal(detail)
+		entry.Detail = string(raw)
+	}
+	if err := models.WriteAuditLog(database.DB, entry); err != nil {
+		log.Printf("Warning: Gagal mencatat audit log %s: %v", action, err)
+	}
+}
+
+// adminUserQuery menyusun query daftar user dari filter ?q= (nama/email), ?status=active|disabled dan ?role=.
+func adminUserQuery(c *gin.Context) *gorm.DB {
+	query := database.DB.Model(&models.User{})
+	if q := strings.TrimSpace(c.Query("q")); q != "" {
+		pattern := "%" + q + "%"
+		query = query.Where("users.name ILIKE ? OR users.email ILIKE ?", pattern, pattern)
+	}
+	switch c.Query("status") {
+	case "active":
+		query = query.Where("users.disabled_at IS NULL")
+	case "disabled":
+		query = query.Where("users.disabled_at IS NOT NULL")
+	}
+	if role := c.Query("role"); role != "" {
+		query = query.Where("users.role = ? OR users.id IN (?)", role,
+			database.DB.Table("user_roles").
+				Select("user_roles.user_id").
+				Joins("JOIN roles ON roles.id = user_roles.role_id").
+				Where("roles.name = ?", role))
+	}
+	return query
+}
+
+// findTargetUser mengambil user dari parameter :id untuk tindakan admin.
+func findTargetUser(c *gin.Context) (models.User, bool) {
+	var user models.User
+	if err := database.DB.First(&user, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+		return user, false
+	}
+	return user, true
+}
+
+// guardStaffTarget menolak aksi terhadap akun staf kecuali pemanggil memegang semua akses (admin),
+// agar pemegang user:manage tidak bisa menonaktifkan atau memaksa reset password admin.
+func guardStaffTarget(c *gin.Context, user models.User) bool {
+	_, permissions, _, err := models.LoadUserAccess(database.DB, user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "server error"})
+		return false
+	}
+	if len(permissions) > 0 && !middleware.HasPermission(c, models.PermAll) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Hanya admin yang bisa mengubah akun staf"})
+		return false
+	}
+	return true
+}
+
+// Controller Handlers
+
+// GetAdminUsers mencari user dengan filter dan pagination (?q=&status=&role=&page=&limit=).
+// Route: GET /user-admin (juga GET /users/admin)
+func GetAdminUsers(c *gin.Context) {
+	page, limit := pageParams(c)
+	query := adminUserQuery(c)
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal mengambil daftar user"})
+		return
+	}
+	var users []models.User
+	if err := query.
+		Preload("Roles").
+		Order("users.created_at DESC").
+		Offset(int((page - 1) * limit)).
+		Limit(int(limit)).
+		Find(&users).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal mengambil daftar user"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Daftar user berhasil diambil",
+		"data":    users,
+		"meta": gin.H{
+			"page":  page,
+			"limit": limit,
+			"total": total,
+		},
+	})
+}
+
+// GetAdminUserByID menampilkan profil user beserta alamat, role, login provider dan ringkasan pesanan.
+// Route: GET /user-admin/:id
+func GetAdminUserByID(c *gin.Context) {
+	var user models.User
+	if err := database.DB.Preload("Roles").First(&user, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+		return
+	}
+
+	var addresses []models.Address
+	var identities []models.UserIdentity
+	var summary struct {
+		Count int64
+		Total uint
+	}
+	if err := database.DB.Where("user_id = ?", user.ID).Find(&addresses).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal mengambil alamat user"})
+		return
+	}
+	if err := database.DB.Where("user_id = ?", user.ID).Find(&identities).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal mengambil login provider user"})
+		return
+	}
+	if err := database.DB.Model(&models.Order{}).
+		Select("COUNT(*) AS count, COALESCE(SUM(total_price), 0) AS total").
+		Where("user_id = ? AND status IN ?", user.ID, models.PaidOrderStatuses).
+		Scan(&summary).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal mengambil ringkasan pesanan"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Detail user berhasil diambil",
+		"data": gin.H{
+			"user":       user,
+			"addresses":  addresses,
+			"identities": identities,
+			"orders": gin.H{
+				"paidCount": summary.Count,
+				"paidTotal": summary.Total,
+			},
+		},
+	})
+}
+
+// GetAdminUserOrders menampilkan pesanan milik user dengan pagination.
+// Route: GET /user-admin/:id/orders
+func GetAdminUserOrders(c *gin.Context) {
+	user, ok := findTargetUser(c)
+	if !ok {
+		return
+	}
+	page, limit := pageParams(c)
+
+	query := database.DB.Model(&models.Order{}).Where("user_id = ?", user.ID)
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal mengambil daftar pesanan"})
+		return
+	}
+	var orders []models.Order
+	if err := query.
+		Order("created_at DESC").
+		Offset(int((page - 1) * limit)).
+		Limit(int(limit)).
+		Find(&orders).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal mengambil daftar pesanan"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Daftar pesanan user berhasil diambil",
+		"data":    orders,
+		"meta": gin.H{
+			"page":  page,
+			"limit": limit,
+			"total": total,
+		},
+	})
+}
+
+// DisableUser menonaktifkan (memblokir) akun dan mengakhiri semua sesinya.
+// Route: PUT /user-admin/disable/:id
+func DisableUser(c *gin.Context) {
+	user, ok := findTargetUser(c)
+	if !ok || !guardStaffTarget(c, user) {
+		return
+	}
+	var input AdminReasonInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Input tidak valid", "details": err.Error()})
+		return
+	}
+	Id, _ := c.Get("userId")
+	if user.ID == utils.InterfaceToUint(Id) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Tidak bisa menonaktifkan akun sendiri"})
+		return
+	}
+	if user.DisabledAt != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Akun sudah nonaktif"})
+		return
+	}
+
+	now := time.Now()
+	if err := database.DB.Model(&user).Updates(map[string]interface{}{
+		"disabled_at":     now,
+		"disabled_reason": input.Reason,
+	}).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal menonaktifkan akun"})
+		return
+	}
+	if err := revokeUserSessions(database.DB, user.ID); err != nil {
+		log.Printf("Warning: Gagal mengakhiri sesi user %d: %v", user.ID, err)
+	}
+	recordAudit(c, "user.disable", "user", user.ID, gin.H{"reason": input.Reason})
+
+	c.JSON(http.StatusOK, gin.H{"message": "Akun berhasil dinonaktifkan"})
+}
+
+// EnableUser mengaktifkan kembali akun yang dinonaktifkan.
+// Route: PUT /user-admin/enable/:id
+func EnableUser(c *gin.Context) {
+	user, ok := findTargetUser(c)
+	if !ok || !guardStaffTarget(c, user) {
+		return
+	}
+	if user.DisabledAt == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Akun tidak sedang nonaktif"})
+		return
+	}
+
+	if err := database.DB.Model(&user).Updates(map[string]interface{}{
+		"disabled_at":     nil,
+		"disabled_reason": "",
+	}).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal mengaktifkan akun"})
+		return
+	}
+	recordAudit(c, "user.enable", "user", user.ID, gin.H{"previousReason": user.DisabledReason})
+
+	c.JSON(http.StatusOK, gin.H{"message": "Akun berhasil diaktifkan kembali"})
+}
+
+// ForcePasswordReset mewajibkan user membuat password baru: semua sesi diakhiri, login dengan
+// password lama ditolak, dan tautan reset password dikirim ke email user.
+// Route: POST /user-admin/force-password-reset/:id
+func ForcePasswordReset(c *gin.Context) {
+	user, ok := findTargetUser(c)
+	if !ok || !guardStaffTarget(c, user) {
+		return
+	}
+	var input AdminReasonInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Input tidak valid", "details": err.Error()})
+		return
+	}
+
+	if err := database.DB.Model(&user).Update("password_reset_required", true).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal mewajibkan reset password"})
+		return
+	}
+	if err := revokeUserSessions(database.DB, user.ID); err != nil {
+		log.Printf("Warning: Gagal mengakhiri sesi user %d: %v", user.ID, err)
+	}
+	emailSent := true
+	if err := sendPasswordResetEmail(user); err != nil {
+		log.Printf("Warning: Gagal mengirim email reset password ke user %d: %v", user.ID, err)
+		emailSent = false
+	}
+	recordAudit(c, "user.force_password_reset", "user", user.ID, gin.H{"reason": input.Reason, "emailSent": emailSent})
+
+	c.JSON(http.StatusOK, gin.H{"message": "User wajib mereset password", "emailSent": emailSent})
+}
+
+// ImpersonateUser membuat sesi berumur pendek untuk masuk sebagai pelanggan saat membantu kendala.
+// Sesi impersonasi tidak membawa hak akses staf, tidak bisa mengubah password/2FA/sesi,
+// dan setiap request yang mengubah data dicatat di audit log. Akhiri dengan POST /logout.
+// Route: POST /user-admin/impersonate/:id
+func ImpersonateUser(c *gin.Context) {
+	user, ok := findTargetUser(c)
+	if !ok {
+		return
+	}
+	var input AdminReasonInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Input tidak valid", "details": err.Error()})
+		return
+	}
+	Id, _ := c.Get("userId")
+	adminID := utils.InterfaceToUint(Id)
+	if user.ID == adminID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Tidak bisa impersonasi akun sendiri"})
+		return
+	}
+	if user.DisabledAt != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Akun nonaktif tidak bisa diimpersonasi"})
+		return
+	}
+	// Akun staf tidak boleh diimpersonasi agar tidak bisa dipakai menaikkan hak akses
+	_, permissions, _, err := models.LoadUserAccess(database.DB, user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "server error"})
+		return
+	}
+	if len(permissions) > 0 {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Akun staf tidak bisa diimpersonasi"})
+		return
+	}
+
+	refreshToken, err := utils.RandomToken(32)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create token"})
+		return
+	}
+	now := time.Now()
+	session := models.Session{
+		UserID:           user.ID,
+		RefreshTokenHash: utils.HashToken(refreshToken),
+		UserAgent:        c.Request.UserAgent(),
+		IP:               c.ClientIP(),
+		LastUsedAt:       now,
+		ExpiresAt:        now.Add(impersonationTTL()),
+		ImpersonatorID:   &adminID,
+	}
+	if err := database.DB.Create(&session).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create token"})
+		return
+	}
+	tokens, err := issueTokens(session, refreshToken)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create token"})
+		return
+	}
+	recordAudit(c, "user.impersonate", "user", user.ID, gin.H{"reason": input.Reason, "sessionId": session.ID})
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":   "Impersonasi dimulai",
+		"data":      tokens,
+		"expiresAt": session.ExpiresAt,
+	})
+}
+
+// GetAuditLogs menampilkan audit log dengan filter ?actorId=&targetId=&action= dan pagination.
+// Route: GET /user-admin/audit-logs
+func GetAuditLogs(c *gin.Context) {
+	page, limit := pageParams(c)
+	query := database.DB.Model(&models.AuditLog{})
+	if actorID := c.Query("actorId"); actorID != "" {
+		query = query.Where("actor_id = ? OR impersonator_id = ?", actorID, actorID)
+	}
+	if targetID := c.Query("targetId"); targetID != "" {
+		query = query.Where("target_id = ?", targetID)
+	}
+	if action := c.Query("action"); action != "" {
+		query = query.Where("action = ?", action)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal mengambil audit log"})
+		return
+	}
+	var logs []models.AuditLog
+	if err := query.
+		Order("created_at DESC").
+		Offset(int((page - 1) * limit)).
+		Limit(int(limit)).
+		Find(&logs).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal mengambil audit log"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Audit log berhasil diambil",
+		"data":    logs,
+		"meta": gin.H{
+			"page":  page,
+			"limit": limit,
+			"total": total,
+		},
+	})
+}
@@ -0,0 +1,532 @@
+package controller
+
+import (
+	"fmt"
+	"go-be/database"
+	"go-be/models"
+	"go-be/utils"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// savedForLaterName adalah nama wishlist default untuk fitur "simpan untuk nanti".
+const savedForLaterName = "Disimpan untuk nanti"
+
+// Struct Input DTO
+
+// WishlistInput adalah data untuk membuat atau mengganti nama wishlist.
+type WishlistInput struct {
+	Name string `json:"name" binding:"required,max=100"`
+}
+
+// AddWishlistItemInput adalah data produk yang ditambahkan ke wishlist.
+type AddWishlistItemInput struct {
+	ProductID         uint  `json:"productId" binding:"required"`
+	NotifyPriceDrop   *bool `json:"notifyPriceDrop"`
+	NotifyBackInStock *bool `json:"notifyBackInStock"`
+}
+
+// MoveToCartInput adalah kuantitas saat item wishlist dipindahkan ke keranjang.
+type MoveToCartInput struct {
+	Quantity uint `json:"quantity"`
+}
+
+// SaveForLaterInput menentukan wishlist tujuan; jika kosong dipakai wishlist default.
+type SaveForLaterInput struct {
+	WishlistID *uint `json:"wishlistId"`
+}
+
+// Helper Functions
+
+// findUserWishlist mencari wishlist berdasarkan ID dan memastikan milik user tersebut.
+func findUserWishlist(db *gorm.DB, wishlistID string, userID uint) (models.Wishlist, error) {
+	var wishlist models.Wishlist
+	err := db.Where("id = ? AND user_id = ?", wishlistID, userID).First(&wishlist).Error
+	return wishlist, err
+}
+
+// getOrCreateSavedForLater mencari wishlist default "simpan untuk nanti" atau membuatnya.
+func getOrCreateSavedForLater(db *gorm.DB, userID uint) (models.Wishlist, error) {
+	wishlist := models.Wishlist{UserID: userID, Name: savedForLaterName}
+	err := db.Where("user_id = ? AND name = ?", userID, savedForLaterName).FirstOrCreate(&wishlist).Error
+	return wishlist, err
+}
+
+// addProductToWishlist menambahkan produk ke wishlist. Jika produk sudah ada, item lama dikembalikan.
+func addProductToWishlist(db *gorm.DB, wishlistID uint, product models.Product, notifyPriceDrop bool, notifyBackInStock bool) (models.WishlistItem, error) {
+	var item models.WishlistItem
+	err := db.Where("wishlist_id = ? AND product_id = ?", wishlistID, product.ID).First(&item).Error
+	if err == nil {
+		return item, nil
+	} else if err != gorm.ErrRecordNotFound {
+		return models.WishlistItem{}, err
+	}
+
+	if err := applyActivePrices(db, []*models.Product{&product}); err != nil {
+		return models.WishlistItem{}, err
+	}
+	item = models.WishlistItem{
+		WishlistID:        wishlistID,
+		ProductID:         product.ID,
+		PriceWhenAdded:    product.ActivePrice,
+		NotifyPriceDrop:   notifyPriceDrop,
+		NotifyBackInStock: notifyBackInStock,
+	}
+	if err := db.Create(&item).Error; err != nil {
+		return models.WishlistItem{}, err
+	}
+	return item, nil
+}
+
+// wishlistWatcher adalah pemilik wishlist yang meminta notifikasi untuk suatu produk.
+type wishlistWatcher struct {
+	UserID         uint
+	PriceWhenAdded uint
+}
+
+// notifyWishlistWatchers mengirim notifikasi penurunan harga dan stok kembali tersedia
+// ke pengguna yang menyimpan produk di wishlist. Dipanggil setelah produk diperbarui
+// atau jadwal diskon dimulai; oldPrice adalah harga aktif sebelum perubahan.
+func notifyWishlistWatchers(db *gorm.DB, product models.Product, oldPrice uint, oldStock *uint) error {
+	link := fmt.Sprintf("/product/%d", product.ID)
+	notified := map[uint]bool{}
+
+	currentPrice := product.ActivePrice
+	if currentPrice == 0 {
+		currentPrice = product.Price
+	}
+	if currentPrice < oldPrice {
+		var watchers []wishlistWatcher
+		if err := db.Table("wishlist_items").
+			Select("DISTINCT wishlists.user_id, wishlist_items.price_when_added").
+			Joins("JOIN wishlists ON wishlists.id = wishlist_items.wishlist_id AND wishlists.deleted_at IS NULL").
+			Where("wishlist_items.product_id = ? AND wishlist_items.notify_price_drop = ? AND wishlist_items.deleted_at IS NULL", product.ID, true).
+			Where("wishlist_items.price_when_added > ?", currentPrice).
+			Scan(&watchers).Error; err != nil {
+			return err
+		}
+		for _, watcher := range watchers {
+			if notified[watcher.UserID] {
+				continue
+			}
+			notified[watcher.UserID] = true
+			message := fmt.Sprintf("Harga %s turun dari Rp%d menjadi Rp%d", product.Name, watcher.PriceWhenAdded, currentPrice)
+			if err := notifyUser(db, watcher.UserID, "wishlist_price_drop", message, link); err != nil {
+				return err
+			}
+		}
+	}
+
+	backInStock := oldStock != nil && *oldStock == 0 && (product.Stock == nil || *product.Stock > 0)
+	if backInStock {
+		var userIDs []uint
+		if err := db.Table("wishlist_items").
+			Distinct("wishlists.user_id").
+			Joins("JOIN wishlists ON wishlists.id = wishlist_items.wishlist_id AND wishlists.deleted_at IS NULL").
+			Where("wishlist_items.product_id = ? AND wishlist_items.notify_back_in_stock = ? AND wishlist_items.deleted_at IS NULL", product.ID, true).
+			Pluck("wishlists.user_id", &userIDs).Error; err != nil {
+			return err
+		}
+		for _, userID := range userIDs {
+			message := fmt.Sprintf("%s kembali tersedia", product.Name)
+			if err := notifyUser(db, userID, "wishlist_back_in_stock", message, link); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// Controller Handlers
+
+// GetWishlists mengambil semua wishlist milik pengguna beserta item dan produknya.
+// Route: GET /wishlist
+func GetWishlists(c *gin.Context) {
+	Id, exists := c.Get("userId")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "harus login dulu"})
+		return
+	}
+	userID := utils.InterfaceToUint(Id)
+
+	var wishlists []models.Wishlist
+	if err := database.DB.
+		Preload("Items.Product").
+		Where("user_id = ?", userID).
+		Order("created_at ASC").
+		Find(&wishlists).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal mengambil wishlist"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Daftar wishlist berhasil diambil",
+		"data":    wishlists,
+	})
+}
+
+// CreateWishlist membuat wishlist baru dengan nama tertentu, misalnya "Bedroom makeover".
+// Route: POST /wishlist/create
+func CreateWishlist(c *gin.Context) {
+	Id, exists := c.Get("userId")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "harus login dulu"})
+		return
+	}
+	userID := utils.InterfaceToUint(Id)
+
+	var input WishlistInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Input tidak valid", "details": err.Error()})
+		return
+	}
+
+	wishlist := models.Wishlist{UserID: userID, Name: input.Name}
+	if err := database.DB.Create(&wishlist).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal membuat wishlist"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"message": "Wishlist berhasil dibuat", "data": wishlist})
+}
+
+// RenameWishlist mengganti nama wishlist.
+// Route: PUT /wishlist/update/:id
+func RenameWishlist(c *gin.Context) {
+	Id, exists := c.Get("userId")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "harus login dulu"})
+		return
+	}
+	userID := utils.InterfaceToUint(Id)
+
+	var input WishlistInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Input tidak valid", "details": err.Error()})
+		return
+	}
+
+	wishlist, err := findUserWishlist(database.DB, c.Param("id"), userID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Wishlist tidak ditemukan atau bukan milik Anda"})
+		return
+	}
+
+	if err := database.DB.Model(&wishlist).Update("name", input.Name).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal memperbarui wishlist"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Wishlist berhasil diperbarui", "data": wishlist})
+}
+
+// DeleteWishlist menghapus wishlist beserta itemnya.
+// Route: DELETE /wishlist/delete/:id
+func DeleteWishlist(c *gin.Context) {
+	Id, exists := c.Get("userId")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "harus login dulu"})
+		return
+	}
+	userID := utils.InterfaceToUint(Id)
+
+	wishlist, err := findUserWishlist(database.DB, c.Param("id"), userID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Wishlist tidak ditemukan atau bukan milik Anda"})
+		return
+	}
+
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("wishlist_id = ?", wishlist.ID).Delete(&models.WishlistItem{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&wishlist).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal menghapus wishlist"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Wishlist berhasil dihapus"})
+}
+
+// AddWishlistItem menambahkan produk ke wishlist tertentu.
+// Route: POST /wishlist/add-item/:id
+func AddWishlistItem(c *gin.Context) {
+	Id, exists := c.Get("userId")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "harus login dulu"})
+		return
+	}
+	userID := utils.InterfaceToUint(Id)
+
+	var input AddWishlistItemInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Input tidak valid", "details": err.Error()})
+		return
+	}
+
+	wishlist, err := findUserWishlist(database.DB, c.Param("id"), userID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Wishlist tidak ditemukan atau bukan milik Anda"})
+		return
+	}
+
+	var product models.Product
+	if err := database.DB.First(&product, input.ProductID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Produk tidak ditemukan"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Kesalahan server saat memeriksa produk"})
+		return
+	}
+
+	// Notifikasi aktif secara default kecuali dimatikan oleh pengguna
+	notifyPriceDrop := input.NotifyPriceDrop == nil || *input.NotifyPriceDrop
+	notifyBackInStock := input.NotifyBackInStock == nil || *input.NotifyBackInStock
+
+	item, err := addProductToWishlist(database.DB, wishlist.ID, product, notifyPriceDrop, notifyBackInStock)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal menambah produk ke wishlist"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"message": "Produk berhasil ditambahkan ke wishlist", "data": item})
+}
+
+// RemoveWishlistItem menghapus item dari wishlist.
+// Route: DELETE /wishlist/delete-item/:id
+func RemoveWishlistItem(c *gin.Context) {
+	Id, exists := c.Get("userId")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "harus login dulu"})
+		return
+	}
+	userID := utils.InterfaceToUint(Id)
+	itemID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID item wishlist tidak valid"})
+		return
+	}
+
+	var item models.WishlistItem
+	// Pastikan item berada di wishlist milik pengguna
+	if err := database.DB.
+		Joins("JOIN wishlists ON wishlists.id = wishlist_items.wishlist_id").
+		Where("wishlist_items.id = ? AND wishlists.user_id = ?", itemID, userID).
+		First(&item).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Item wishlist tidak ditemukan atau bukan milik Anda"})
+		return
+	}
+
+	if err := database.DB.Delete(&item).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal menghapus item wishlist"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Item wishlist berhasil dihapus"})
+}
+
+// MoveWishlistItemToCart memindahkan item wishlist ke keranjang aktif pengguna.
+// Route: POST /wishlist/move-to-cart/:id
+func MoveWishlistItemToCart(c *gin.Context) {
+	Id, exists := c.Get("userId")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "harus login dulu"})
+		return
+	}
+	userID := utils.InterfaceToUint(Id)
+	itemID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID item wishlist tidak valid"})
+		return
+	}
+
+	var input MoveToCartInput
+	// Body opsional, kuantitas default 1
+	_ = c.ShouldBindJSON(&input)
+	if input.Quantity == 0 {
+		input.Quantity = 1
+	}
+
+	var item models.WishlistItem
+	if err := database.DB.
+		Preload("Product").
+		Joins("JOIN wishlists ON wishlists.id = wishlist_items.wishlist_id").
+		Where("wishlist_items.id = ? AND wishlists.user_id = ?", itemID, userID).
+		First(&item).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Item wishlist tidak ditemukan atau bukan milik Anda"})
+		return
+	}
+	if item.Product.ID == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Produk sudah tidak tersedia"})
+		return
+	}
+
+	var cartItem models.CartItem
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		cart, err := getOrCreateUserCart(userID, tx)
+		if err != nil {
+			return err
+		}
+		cartItem, _, err = addProductToCart(tx, cart.ID, item.Product, input.Quantity)
+		if err != nil {
+			return err
+		}
+		return tx.Delete(&item).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal memindahkan item ke keranjang"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Item berhasil dipindahkan ke keranjang", "data": cartItem})
+}
+
+// SaveCartItemForLater memindahkan item keranjang aktif ke wishlist.
+// Jika wishlistId tidak dikirim, item disimpan ke wishlist "Disimpan untuk nanti".
+// Route: POST /wishlist/save-for-later/:id
+func SaveCartItemForLater(c *gin.Context) {
+	Id, exists := c.Get("userId")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "harus login dulu"})
+		return
+	}
+	userID := utils.InterfaceToUint(Id)
+	cartItemID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID item keranjang tidak valid"})
+		return
+	}
+
+	var input SaveForLaterInput
+	// Body opsional
+	_ = c.ShouldBindJSON(&input)
+
+	var cartItem models.CartItem
+	// Cari item, pastikan item tersebut ada di keranjang AKTIF (order_id IS NULL) milik pengguna yang benar.
+	if err := database.DB.
+		Preload("Product").
+		Joins("JOIN carts ON carts.id = cart_items.cart_id").
+		Where("cart_items.id = ? AND carts.user_id = ? AND carts.order_id IS NULL", cartItemID, userID).
+		First(&cartItem).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Item keranjang tidak ditemukan atau bukan milik Anda"})
+		return
+	}
+
+	var wishlistItem models.WishlistItem
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		var wishlist models.Wishlist
+		var err error
+		if input.WishlistID != nil {
+			wishlist, err = findUserWishlist(tx, utils.UintToString(*input.WishlistID), userID)
+		} else {
+			wishlist, err = getOrCreateSavedForLater(tx, userID)
+		}
+		if err != nil {
+			return err
+		}
+		wishlistItem, err = addProductToWishlist(tx, wishlist.ID, cartItem.Product, true, true)
+		if err != nil {
+			return err
+		}
+		return tx.Delete(&cartItem).Error
+	})
+	if err == gorm.ErrRecordNotFound {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Wishlist tidak ditemukan atau bukan milik Anda"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal menyimpan item ke wishlist"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Item berhasil disimpan untuk nanti", "data": wishlistItem})
+}
+
+// ShareWishlist membuat link baca-saja untuk wishlist.
+// Route: POST /wishlist/share/:id
+func ShareWishlist(c *gin.Context) {
+	Id, exists := c.Get("userId")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "harus login dulu"})
+		return
+	}
+	userID := utils.InterfaceToUint(Id)
+
+	wishlist, err := findUserWishlist(database.DB, c.Param("id"), userID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Wishlist tidak ditemukan atau bukan milik Anda"})
+		return
+	}
+
+	if wishlist.ShareToken == nil {
+		token, err := utils.RandomToken(16)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal membuat link wishlist"})
+			return
+		}
+		if err := database.DB.Model(&wishlist).Update("share_token", token).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal membuat link wishlist"})
+			return
+		}
+		wishlist.ShareToken = &token
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":    "Link wishlist berhasil dibuat",
+		"shareToken": *wishlist.ShareToken,
+		"sharePath":  "/shared-wishlist/" + *wishlist.ShareToken,
+	})
+}
+
+// UnshareWishlist mencabut link wishlist sehingga tidak bisa diakses lagi.
+// Route: DELETE /wishlist/share/:id
+func UnshareWishlist(c *gin.Context) {
+	Id, exists := c.Get("userId")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "harus login dulu"})
+		return
+	}
+	userID := utils.InterfaceToUint(Id)
+
+	wishlist, err := findUserWishlist(database.DB, c.Param("id"), userID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Wishlist tidak ditemukan atau bukan milik Anda"})
+		return
+	}
+
+	if err := database.DB.Model(&wishlist).Update("share_token", nil).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal mencabut link wishlist"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Link wishlist berhasil dicabut"})
+}
+
+// GetSharedWishlist menampilkan wishlist yang dibagikan (baca-saja, tanpa login).
+// Route: GET /shared-wishlist/:token
+func GetSharedWishlist(c *gin.Context) {
+	var wishlist models.Wishlist
+	if err := database.DB.
+		Preload("User", selectPublicUser).
+		Preload("Items.Product").
+		Where("share_token = ?", c.Param("token")).
+		First(&wishlist).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Wishlist tidak ditemukan"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Wishlist berhasil diambil",
+		"data": gin.H{
+			"name":  wishlist.Name,
+			"owner": wishlist.User.Name,
+			"items": wishlist.Items,
+		},
+	})
+}
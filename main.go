@@ -5,6 +5,7 @@ import (
 	"log"
 	"os"
 
+	"go-be/controller"
 	"go-be/database"
 	"go-be/models"
 	"go-be/route"
@@ -25,28 +26,107 @@ func main() {
 	defer logger.Sync()
 	logger.Info("Starting server...")
 
+	// Muat kunci JWT lebih dulu agar salah konfigurasi langsung ketahuan
+	if err := utils.LoadJWTKeys(); err != nil {
+		logger.Fatal("Invalid JWT key configuration", zap.Error(err))
+	}
+
 	// Connect Database
 	database.ConnectDB()
 	utils.InitRedis()
 	defer utils.RedisClient.Close()
 	err := database.DB.AutoMigrate(
 		&models.User{},
+		&models.Role{},
+		&models.RolePermission{},
+		&models.Session{},
+		&models.RecoveryCode{},
+		&models.UserIdentity{},
+		&models.AuditLog{},
 		&models.Address{},
 		&models.Cart{},
 		&models.CartItem{},
 		&models.Category{},
 		&models.Product{},
 		&models.Order{},
+		&models.OrderNote{},
+		&models.Invoice{},
+		&models.InvoiceSequence{},
+		&models.Notification{},
+		&models.ProductQuestion{},
+		&models.ProductAnswer{},
+		&models.AnswerVote{},
+		&models.Wishlist{},
+		&models.WishlistItem{},
+		&models.Coupon{},
+		&models.Promotion{},
+		&models.Redemption{},
+		&models.ProductPriceSchedule{},
+		&models.ProductPriceHistory{},
+		&models.GiftCard{},
+		&models.GiftCardTransaction{},
+		&models.StoreCreditEntry{},
+		&models.LoyaltyEntry{},
+		&models.ReturnRequest{},
+		&models.ReturnItem{},
+		&models.ReturnPhoto{},
+		&models.ReturnEvent{},
+		&models.Shipment{},
+		&models.ShipmentItem{},
+		&models.ShipmentEvent{},
 	)
 	if err != nil {
 		logger.Fatal("Failed to migrate database", zap.Error(err))
 	}
 	logger.Info("Database connected and migrated successfully",
 		zap.Strings("tables", []string{
-			"user", "address", "cart", "cartitem", "category", "product", "order",
+			"user", "role", "role_permission", "session", "recovery_code", "user_identity", "audit_log", "address", "cart", "cartitem", "category", "product", "order", "order_note",
+			"invoice", "invoice_sequence",
+			"notification", "product_question", "product_answer", "answer_vote",
+			"wishlist", "wishlist_item", "coupon", "promotion", "redemption",
+			"product_price_schedule", "product_price_history",
+			"gift_card", "gift_card_transaction", "store_credit_entry",
+			"loyalty_entry", "return_request", "return_item", "return_photo", "return_event",
+			"shipment", "shipment_item", "shipment_event",
 		}),
 	)
 
+	// Buat role bawaan dan pindahkan admin lama ke role admin
+	if err := controller.SeedRoles(); err != nil {
+		logger.Fatal("Failed to seed roles", zap.Error(err))
+	}
+
+	// Normalkan email user lama dan pasang unique index email
+	duplicates, err := controller.MigrateUserEmails()
+	if err != nil {
+		logger.Fatal("Failed to migrate user emails", zap.Error(err))
+	}
+	for _, duplicate := range duplicates {
+		logger.Warn("Duplicate user email, unique email index not created until resolved",
+			zap.String("email", duplicate.Email),
+			zap.Uints("userIds", duplicate.UserIDs),
+		)
+	}
+
+	// Kode kupon yang sudah dihapus boleh dipakai lagi
+	if err := controller.MigrateCouponCodes(); err != nil {
+		logger.Fatal("Failed to migrate coupon codes", zap.Error(err))
+	}
+
+	// Pesanan tidak boleh ikut terhapus saat user dihapus
+	if err := controller.MigrateOrderRetention(); err != nil {
+		logger.Fatal("Failed to migrate order retention", zap.Error(err))
+	}
+
+	// Beri nomor pada pesanan lama yang belum punya nomor pesanan
+	if err := controller.BackfillOrderNumbers(); err != nil {
+		logger.Fatal("Failed to backfill order numbers", zap.Error(err))
+	}
+
+	// Jalankan scheduler harga diskon dan kedaluwarsa poin di background
+	go controller.RunPriceScheduler()
+	go controller.RunLoyaltyScheduler()
+
 	// Setup Gin router
 	r := route.SetupRoute()
 
@@ -1,9 +1,11 @@
 package middleware
 
 import (
+	"encoding/json"
 	"go-be/database"
 	"go-be/models"
 	"go-be/utils"
+	"log"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
@@ -20,32 +22,167 @@ func AuthMiddleware() gin.HandlerFunc {
 			return
 		}
 
-		userID, err := utils.ReverseToken(tokenString)
+		claims, err := utils.ReverseToken(tokenString)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "error parse token"})
+			// 401 agar klien tahu harus memperbarui token lewat refresh token
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "error parse token"})
 			c.Abort()
 			return
 		}
-		c.Set("userId", userID)
-		println(userID)
+
+		// Tolak token dari sesi yang sudah logout atau dicabut.
+		// Akun yang dinonaktifkan ikut tertolak karena DisableUser mencabut semua sesinya.
+		revoked, err := utils.IsTokenRevoked(claims)
+		if err != nil {
+			// Redis tidak tersedia, cek langsung status sesi dan akun di database.
+			// Token lama tanpa sesi tidak bisa dicek sehingga ditolak.
+			revoked = true
+			if claims.SessionID != 0 {
+				var count int64
+				if err := database.DB.Model(&models.Session{}).
+					Joins("JOIN users ON users.id = sessions.user_id").
+					Where("sessions.id = ? AND sessions.user_id = ? AND sessions.revoked_at IS NULL AND users.disabled_at IS NULL", claims.SessionID, claims.UserID).
+					Count(&count).Error; err != nil {
+					c.JSON(http.StatusServiceUnavailable, gin.H{"error": "session check unavailable"})
+					c.Abort()
+					return
+				}
+				revoked = count == 0
+			}
+		}
+		if revoked {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "session revoked"})
+			c.Abort()
+			return
+		}
+
+		if claims.Access != nil {
+			// Role berubah setelah token dibuat: klien harus refresh agar membawa role terbaru
+			stale, err := utils.IsRoleVersionStale(claims.UserID, claims.Access.Version)
+			if err != nil {
+				// Redis tidak tersedia, bandingkan dengan versi role di database
+				_, _, version, dbErr := models.LoadUserAccess(database.DB, claims.UserID)
+				stale = dbErr != nil || claims.Access.Version < version
+			}
+			if stale {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "token outdated, please refresh"})
+				c.Abort()
+				return
+			}
+			c.Set("roles", claims.Access.Roles)
+			c.Set("permissions", claims.Access.Permissions)
+			c.Set("twoFactor", claims.Access.TwoFactor)
+		}
+
+		c.Set("userId", claims.UserID)
+		c.Set("sessionId", claims.SessionID)
+
+		if claims.Access == nil || claims.Access.ImpersonatorID == 0 {
+			c.Next()
+			return
+		}
+		impersonatorID := claims.Access.ImpersonatorID
+		c.Set("impersonatorId", impersonatorID)
 		c.Next()
+		auditImpersonatedRequest(c, claims.UserID, impersonatorID)
 	}
 }
 
-func AdminMiddleware(c *gin.Context) {
-	var user models.User
-	userID, exists := c.Get("userId")
-	if !exists {
-		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Forbidden: Admin access only"})
+// auditImpersonatedRequest mencatat setiap request yang mengubah data selama admin masuk sebagai user.
+func auditImpersonatedRequest(c *gin.Context, userID, impersonatorID uint) {
+	if c.Request.Method == http.MethodGet || c.Request.Method == http.MethodHead || c.Request.Method == http.MethodOptions {
 		return
 	}
-	if err := database.DB.First(&user, userID).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "server error"})
-		return
+	detail, _ := json.Marshal(gin.H{
+		"method": c.Request.Method,
+		"path":   c.Request.URL.Path,
+		"status": c.Writer.Status(),
+	})
+	if err := models.WriteAuditLog(database.DB, models.AuditLog{
+		ActorID:        userID,
+		ImpersonatorID: &impersonatorID,
+		Action:         "impersonation.request",
+		TargetType:     "user",
+		TargetID:       userID,
+		IP:             c.ClientIP(),
+		UserAgent:      c.Request.UserAgent(),
+		Detail:         string(detail),
+	}); err != nil {
+		log.Printf("Warning: Gagal mencatat audit log impersonasi: %v", err)
 	}
-	if user.Role != "admin" {
-		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Forbidden: Admin access only"})
+}
+
+// DenyImpersonation menolak route sensitif (password, 2FA, sesi, hapus akun) saat admin masuk sebagai user.
+func DenyImpersonation(c *gin.Context) {
+	if _, impersonating := c.Get("impersonatorId"); impersonating {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Forbidden: not allowed while impersonating"})
 		return
 	}
 	c.Next()
 }
+
+// permissionsFromContext mengambil permission dari claim token. Token lama tanpa claim role
+// dibaca dari database sekali lalu disimpan di context.
+func permissionsFromContext(c *gin.Context) []string {
+	if perms, exists := c.Get("permissions"); exists {
+		return perms.([]string)
+	}
+	userID, exists := c.Get("userId")
+	if !exists {
+		return nil
+	}
+	roles, perms, _, err := models.LoadUserAccess(database.DB, utils.InterfaceToUint(userID))
+	if err != nil {
+		return nil
+	}
+	c.Set("roles", roles)
+	c.Set("permissions", perms)
+	return perms
+}
+
+// grantsPermission mengecek apakah role user memberikan salah satu permission.
+func grantsPermission(c *gin.Context, permissions ...string) bool {
+	for _, owned := range permissionsFromContext(c) {
+		if owned == models.PermAll {
+			return true
+		}
+		for _, required := range permissions {
+			if owned == required {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// twoFactorPassed mengecek apakah token berasal dari login yang sudah lolos 2FA.
+func twoFactorPassed(c *gin.Context) bool {
+	passed, _ := c.Get("twoFactor")
+	ok, _ := passed.(bool)
+	return ok
+}
+
+// HasPermission mengecek apakah user yang login memiliki salah satu permission.
+// Hak akses staf hanya berlaku untuk login yang sudah lolos 2FA.
+func HasPermission(c *gin.Context, permissions ...string) bool {
+	return grantsPermission(c, permissions...) && twoFactorPassed(c)
+}
+
+// RequirePermission membatasi route untuk user yang memiliki salah satu permission
+// dan login dengan 2FA. Dipasang setelah AuthMiddleware.
+func RequirePermission(permissions ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !grantsPermission(c, permissions...) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Forbidden: missing permission"})
+			return
+		}
+		if !twoFactorPassed(c) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+				"error":             "Forbidden: two-factor authentication required",
+				"twoFactorRequired": true,
+			})
+			return
+		}
+		c.Next()
+	}
+}
@@ -1,7 +1,10 @@
 package middleware
 
 import (
+	"go-be/utils"
+	"log"
 	"net/http"
+	"strconv"
 	"sync"
 	"time"
 
@@ -75,3 +78,23 @@ func main() {
     r.Run()
 }
 */
+
+// LimitByIPWindow membatasi request per IP untuk satu endpoint (name) menggunakan penghitung di Redis,
+// sehingga batas tetap berlaku di semua instance aplikasi. Jika Redis tidak tersedia, request diteruskan.
+func LimitByIPWindow(name string, limit uint, window time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		allowed, retryAfter, err := utils.AllowRequest(name+":ip:"+c.ClientIP(), limit, window)
+		if err != nil {
+			log.Printf("Warning: Rate limit %s tidak aktif, Redis error: %v", name, err)
+		}
+		if !allowed {
+			c.Header("Retry-After", strconv.Itoa(int(retryAfter.Seconds())+1))
+			c.JSON(http.StatusTooManyRequests, gin.H{
+				"error": "Terlalu banyak permintaan. Mohon coba lagi nanti.",
+			})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,29 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// AuditLog mencatat tindakan admin dan request selama impersonasi. Tidak pernah diubah atau dihapus.
+type AuditLog struct {
+	ID             uint      `json:"id" gorm:"primaryKey"`
+	CreatedAt      time.Time `json:"createdAt" gorm:"index"`
+	ActorID        uint      `json:"actorId" gorm:"index"` // user yang melakukan tindakan
+	ImpersonatorID *uint     `json:"impersonatorId"`       // admin di balik tindakan saat impersonasi
+	Action         string    `json:"action" gorm:"index"`  // misalnya "user.disable", "user.impersonate"
+	TargetType     string    `json:"targetType"`           // misalnya "user"
+	TargetID       uint      `json:"targetId" gorm:"index"`
+	IP             string    `json:"ip"`
+	UserAgent      string    `json:"userAgent"`
+	Detail         string    `json:"detail" gorm:"type:jsonb"` // data tambahan dalam JSON
+}
+
+// WriteAuditLog menyimpan satu entri audit log.
+func WriteAuditLog(db *gorm.DB, entry AuditLog) error {
+	if entry.Detail == "" {
+		entry.Detail = "{}"
+	}
+	return db.Create(&entry).Error
+}
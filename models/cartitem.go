@@ -4,8 +4,16 @@ import "gorm.io/gorm"
 
 type CartItem struct {
 	gorm.Model
-	CartID    uint    `json:"cartId"`
-	ProductID uint    `json:"productId"`
-	Product   Product `json:"product" gorm:"foreignKey:ProductID;constraint:OnDelete:CASCADE;"`
-	Quantity  uint    `json:"quantity"`
+	CartID     uint    `json:"cartId"`
+	ProductID  uint    `json:"productId"`
+	Product    Product `json:"product" gorm:"foreignKey:ProductID;constraint:OnDelete:CASCADE;"`
+	Quantity   uint    `json:"quantity"`
+	PriceAtAdd uint    `json:"priceAtAdd"` // harga yang dilihat pengguna saat item ditambahkan/dikonfirmasi
+
+	// Rincian harga baris yang disimpan saat checkout
+	UnitPrice      uint `json:"unitPrice"`
+	DiscountAmount uint `json:"discountAmount"`
+	TaxRate        uint `json:"taxRate"`
+	TaxAmount      uint `json:"taxAmount"`
+	LineTotal      uint `json:"lineTotal"`
 }
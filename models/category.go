@@ -4,6 +4,8 @@ import "gorm.io/gorm"
 
 type Category struct {
 	gorm.Model
-	Name     string    `json:"name"`
-	Products []Product `json:"products" gorm:"foreignKey:CategoryID;constraint:OnDelete:CASCADE;"`
+	Name        string    `json:"name"`
+	TaxRate     *uint     `json:"taxRate"`     // tarif PPN khusus kategori dalam persen, nil = tarif default PPN_RATE
+	LoyaltyRate *uint     `json:"loyaltyRate"` // poin per LOYALTY_EARN_UNIT rupiah, nil = tarif default LOYALTY_EARN_RATE
+	Products    []Product `json:"products" gorm:"foreignKey:CategoryID;constraint:OnDelete:CASCADE;"`
 }
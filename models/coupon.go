@@ -0,0 +1,61 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Jenis kupon
+const (
+	CouponTypePercentage   = "percentage"
+	CouponTypeFixed        = "fixed"
+	CouponTypeFreeShipping = "free_shipping"
+)
+
+type Coupon struct {
+	gorm.Model
+	Code           string     `json:"code"` // unik di antara kupon yang belum dihapus, lihat controller.MigrateCouponCodes
+	Description    string     `json:"description"`
+	Type           string     `json:"type"`
+	Value          uint       `json:"value"`       // persen atau nominal rupiah
+	MaxDiscount    uint       `json:"maxDiscount"` // batas diskon kupon persentase, 0 = tanpa batas
+	MinSpend       uint       `json:"minSpend"`
+	CategoryID     *uint      `json:"categoryId"` // hanya berlaku untuk kategori ini
+	ProductID      *uint      `json:"productId"`  // hanya berlaku untuk produk ini
+	FirstOrderOnly bool       `json:"firstOrderOnly"`
+	UsageLimit     uint       `json:"usageLimit"`   // batas pemakaian global, 0 = tanpa batas
+	PerUserLimit   uint       `json:"perUserLimit"` // batas pemakaian per user, 0 = tanpa batas
+	StartsAt       *time.Time `json:"startsAt"`
+	EndsAt         *time.Time `json:"endsAt"`
+	Active         bool       `json:"active"`
+}
+
+// Promotion adalah promo otomatis "beli X dapat Y dengan diskon", misalnya
+// beli sofa dapat meja samping diskon 50%.
+type Promotion struct {
+	gorm.Model
+	Name            string     `json:"name"`
+	BuyProductID    *uint      `json:"buyProductId"`
+	BuyCategoryID   *uint      `json:"buyCategoryId"`
+	BuyQuantity     uint       `json:"buyQuantity"` // jumlah yang harus dibeli untuk satu item diskon
+	GetProductID    *uint      `json:"getProductId"`
+	GetCategoryID   *uint      `json:"getCategoryId"`
+	DiscountPercent uint       `json:"discountPercent"`
+	StartsAt        *time.Time `json:"startsAt"`
+	EndsAt          *time.Time `json:"endsAt"`
+	Active          bool       `json:"active"`
+}
+
+// Redemption mencatat pemakaian kupon atau promo pada sebuah pesanan.
+type Redemption struct {
+	gorm.Model
+	OrderID     uint       `json:"orderId" gorm:"index"`
+	Order       *Order     `json:"-" gorm:"foreignKey:OrderID;constraint:OnDelete:CASCADE;"`
+	UserID      uint       `json:"userId" gorm:"index"`
+	CouponID    *uint      `json:"couponId" gorm:"index"`
+	Coupon      *Coupon    `json:"coupon,omitempty" gorm:"foreignKey:CouponID;constraint:OnDelete:SET NULL;"`
+	PromotionID *uint      `json:"promotionId" gorm:"index"`
+	Promotion   *Promotion `json:"promotion,omitempty" gorm:"foreignKey:PromotionID;constraint:OnDelete:SET NULL;"`
+	Amount      uint       `json:"amount"`
+}
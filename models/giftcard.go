@@ -0,0 +1,63 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Status gift card
+const (
+	GiftCardStatusPending   = "pending" // menunggu pembayaran pesanan pembelian
+	GiftCardStatusActive    = "active"
+	GiftCardStatusCancelled = "cancelled"
+)
+
+// Alasan mutasi saldo gift card dan saldo toko
+const (
+	CreditReasonPurchase    = "purchase"     // gift card aktif setelah dibayar
+	CreditReasonOrderPay    = "order_pay"    // dipakai untuk membayar pesanan
+	CreditReasonOrderRefund = "order_refund" // dikembalikan karena pesanan gagal
+	CreditReasonRedeem      = "redeem"       // gift card ditukar menjadi saldo toko
+	CreditReasonAdjustment  = "adjustment"   // diberikan atau dikoreksi admin
+	CreditReasonReturn      = "return"       // pengembalian dana retur barang
+)
+
+// GiftCard adalah gift card digital yang dibeli pelanggan dan dapat dipakai saat checkout.
+type GiftCard struct {
+	gorm.Model
+	Code           string     `json:"code" gorm:"uniqueIndex"`
+	InitialAmount  uint       `json:"initialAmount"`
+	Balance        uint       `json:"balance"`
+	Status         string     `json:"status" gorm:"default:'pending'"`
+	PurchaserID    *uint      `json:"purchaserId" gorm:"index"`
+	OrderID        *uint      `json:"orderId" gorm:"index"` // pesanan pembelian gift card
+	RecipientName  string     `json:"recipientName"`
+	RecipientEmail string     `json:"recipientEmail"`
+	Message        string     `json:"message"`
+	ExpiresAt      *time.Time `json:"expiresAt"`
+}
+
+// GiftCardTransaction mencatat setiap mutasi saldo gift card.
+type GiftCardTransaction struct {
+	gorm.Model
+	GiftCardID uint   `json:"giftCardId" gorm:"index"`
+	OrderID    *uint  `json:"orderId" gorm:"index"`
+	UserID     *uint  `json:"userId"`
+	Amount     int    `json:"amount"` // positif menambah saldo, negatif mengurangi saldo
+	Reason     string `json:"reason"`
+}
+
+// StoreCreditEntry adalah baris buku besar saldo toko milik user.
+// Saldo user adalah jumlah Amount semua baris miliknya.
+type StoreCreditEntry struct {
+	gorm.Model
+	UserID      uint   `json:"userId" gorm:"index"`
+	User        User   `json:"-" gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE;"`
+	Amount      int    `json:"amount"` // positif menambah saldo, negatif mengurangi saldo
+	Reason      string `json:"reason"`
+	OrderID     *uint  `json:"orderId" gorm:"index"`
+	GiftCardID  *uint  `json:"giftCardId"`
+	Note        string `json:"note"`
+	CreatedByID *uint  `json:"createdById"`
+}
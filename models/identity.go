@@ -0,0 +1,19 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// UserIdentity menghubungkan user dengan akun di provider login OpenID Connect (misalnya Google).
+// Satu user bisa punya beberapa identitas; satu identitas (provider + subject) hanya milik satu user.
+type UserIdentity struct {
+	gorm.Model
+	UserID      uint      `json:"-" gorm:"index"`
+	User        User      `json:"-" gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE;"`
+	Provider    string    `json:"provider" gorm:"uniqueIndex:idx_identity_provider_subject"`
+	Subject     string    `json:"-" gorm:"uniqueIndex:idx_identity_provider_subject"` // claim sub dari provider
+	Email       string    `json:"email"`
+	LastLoginAt time.Time `json:"lastLoginAt"`
+}
@@ -0,0 +1,28 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Invoice adalah faktur resmi untuk pesanan yang sudah dibayar.
+// Nomor faktur berurutan per tahun dan terpisah dari ID maupun nomor pesanan.
+type Invoice struct {
+	gorm.Model
+	Number        string    `json:"number" gorm:"uniqueIndex"` // contoh INV/2026/000123
+	Year          int       `json:"year" gorm:"uniqueIndex:idx_invoice_year_sequence"`
+	Sequence      uint      `json:"sequence" gorm:"uniqueIndex:idx_invoice_year_sequence"`
+	OrderID       uint      `json:"orderId" gorm:"uniqueIndex"`
+	IssuedAt      time.Time `json:"issuedAt"`
+	CustomerName  string    `json:"customerName"` // data pembeli saat faktur diterbitkan
+	CustomerEmail string    `json:"customerEmail"`
+	CustomerTaxID string    `json:"customerTaxId"`
+	Total         uint      `json:"total"`
+}
+
+// InvoiceSequence menyimpan nomor urut faktur terakhir per tahun.
+type InvoiceSequence struct {
+	Year       int  `gorm:"primaryKey;autoIncrement:false"`
+	LastNumber uint `json:"lastNumber"`
+}
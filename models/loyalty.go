@@ -0,0 +1,33 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Alasan mutasi poin loyalitas
+const (
+	LoyaltyReasonEarn        = "earn"         // poin dari pesanan
+	LoyaltyReasonReverse     = "reverse"      // poin pesanan ditarik karena pesanan gagal/dikembalikan
+	LoyaltyReasonRedeem      = "redeem"       // poin ditukar menjadi diskon saat checkout
+	LoyaltyReasonOrderRefund = "order_refund" // poin yang ditukar dikembalikan karena pesanan gagal
+	LoyaltyReasonExpire      = "expire"
+	LoyaltyReasonAdjustment  = "adjustment"
+)
+
+// LoyaltyEntry adalah baris buku besar poin loyalitas milik user.
+// Saldo poin adalah jumlah Points semua baris. Baris positif menyimpan sisa poin
+// (Remaining) yang belum dipakai agar poin terlama dipakai dan kedaluwarsa lebih dulu.
+type LoyaltyEntry struct {
+	gorm.Model
+	UserID      uint       `json:"userId" gorm:"index"`
+	User        User       `json:"-" gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE;"`
+	Points      int        `json:"points"`
+	Remaining   uint       `json:"remaining"`
+	Reason      string     `json:"reason"`
+	OrderID     *uint      `json:"orderId" gorm:"index"`
+	ExpiresAt   *time.Time `json:"expiresAt" gorm:"index"`
+	Note        string     `json:"note"`
+	CreatedByID *uint      `json:"createdById"`
+}
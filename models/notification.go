@@ -0,0 +1,17 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type Notification struct {
+	gorm.Model
+	UserID  uint       `json:"userId" gorm:"index"`
+	User    User       `json:"-" gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE;"`
+	Type    string     `json:"type"`
+	Message string     `json:"message"`
+	Link    string     `json:"link"`
+	ReadAt  *time.Time `json:"readAt"`
+}
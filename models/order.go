@@ -1,16 +1,72 @@
 package models
 
-import "gorm.io/gorm"
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Status pesanan
+const (
+	OrderStatusPending          = "Pending"
+	OrderStatusPaid             = "Paid"
+	OrderStatusFailed           = "Failed"
+	OrderStatusPartiallyShipped = "PartiallyShipped" // sebagian item sudah dikirim
+	OrderStatusShipped          = "Shipped"          // semua item sudah dikirim
+	OrderStatusDelivered        = "Delivered"
+)
+
+// PaidOrderStatuses adalah status pesanan yang sudah dibayar, termasuk yang sedang atau sudah dikirim.
+var PaidOrderStatuses = []string{OrderStatusPaid, OrderStatusPartiallyShipped, OrderStatusShipped, OrderStatusDelivered}
 
 type Order struct {
 	gorm.Model
-	UserID          uint   `json:"userId"`
-	Cart            []Cart `json:"cart" gorm:"constraint:OnDelete:CASCADE;"`
-	TotalPrice      uint   `json:"totalPrice"`
-	Payment         string `json:"payment"`
-	Quantity        uint   `json:"quantity"`
-	Status          string `json:"status" gorm:"default:'Pending'"`
-	DuitkuReference string `json:"duitkuReference"`
+	Number            string      `json:"number" gorm:"uniqueIndex"` // nomor pesanan untuk pelanggan dan Duitku, contoh FS-20261018-7K3Q
+	UserID            uint        `json:"userId"`
+	Cart              []Cart      `json:"cart" gorm:"constraint:OnDelete:CASCADE;"`
+	Subtotal          uint        `json:"subtotal"`
+	DiscountTotal     uint        `json:"discountTotal"`
+	CouponCode        string      `json:"couponCode"`
+	TaxTotal          uint        `json:"taxTotal"`
+	TaxInclusive      bool        `json:"taxInclusive"` // harga katalog sudah termasuk PPN
+	TaxExempt         bool        `json:"taxExempt"`
+	CustomerTaxID     string      `json:"customerTaxId"` // NPWP pelanggan saat checkout
+	ShippingFee       uint        `json:"shippingFee"`
+	ServiceFee        uint        `json:"serviceFee"`
+	TotalPrice        uint        `json:"totalPrice"` // grand total pesanan
+	GiftCardID        *uint       `json:"giftCardId"`
+	GiftCardAmount    uint        `json:"giftCardAmount"`    // dibayar dengan gift card
+	StoreCreditAmount uint        `json:"storeCreditAmount"` // dibayar dengan saldo toko
+	LoyaltyPointsUsed uint        `json:"loyaltyPointsUsed"`
+	LoyaltyDiscount   uint        `json:"loyaltyDiscount"` // sudah termasuk dalam DiscountTotal
+	LoyaltyPoints     uint        `json:"loyaltyPoints"`   // poin yang didapat dari pesanan ini
+	Payment           string      `json:"payment"`
+	Quantity          uint        `json:"quantity"`
+	Status            string      `json:"status" gorm:"default:'Pending'"`
+	DeliveredAt       *time.Time  `json:"deliveredAt"`
+	ReplacementOf     *uint       `json:"replacementOf"` // pesanan asal jika ini pesanan pengganti dari retur
+	DuitkuReference   string      `json:"duitkuReference"`
+	Shipments         []Shipment  `json:"shipments,omitempty" gorm:"constraint:OnDelete:CASCADE;"`
+	Notes             []OrderNote `json:"notes,omitempty" gorm:"constraint:OnDelete:CASCADE;"` // hanya untuk admin
+}
+
+// OrderNote adalah catatan internal admin pada pesanan, termasuk jejak perubahan status manual.
+type OrderNote struct {
+	gorm.Model
+	OrderID    uint   `json:"orderId" gorm:"index"`
+	AuthorID   uint   `json:"authorId"`
+	Note       string `json:"note"`
+	FromStatus string `json:"fromStatus,omitempty"`
+	ToStatus   string `json:"toStatus,omitempty"`
+}
+
+// AmountDue adalah sisa tagihan yang dibayar lewat Duitku setelah gift card dan saldo toko.
+func (o Order) AmountDue() uint {
+	paid := o.GiftCardAmount + o.StoreCreditAmount
+	if paid >= o.TotalPrice {
+		return 0
+	}
+	return o.TotalPrice - paid
 }
 
 //type Order struct {
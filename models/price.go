@@ -0,0 +1,39 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Sumber perubahan harga pada riwayat harga
+const (
+	PriceSourceManual    = "manual"
+	PriceSourceSaleStart = "sale_start"
+	PriceSourceSaleEnd   = "sale_end"
+)
+
+// ProductPriceSchedule adalah harga diskon terjadwal; selama StartsAt <= sekarang < EndsAt
+// harga aktif produk adalah SalePrice dan Product.Price ditampilkan sebagai harga coret.
+type ProductPriceSchedule struct {
+	gorm.Model
+	ProductID   uint      `json:"productId" gorm:"index"`
+	Product     *Product  `json:"-" gorm:"foreignKey:ProductID;constraint:OnDelete:CASCADE;"`
+	SalePrice   uint      `json:"salePrice"`
+	StartsAt    time.Time `json:"startsAt" gorm:"index"`
+	EndsAt      time.Time `json:"endsAt" gorm:"index"`
+	CreatedByID *uint     `json:"createdById"`
+	StartLogged bool      `json:"-"` // awal diskon sudah dicatat di riwayat harga
+	EndLogged   bool      `json:"-"` // akhir diskon sudah dicatat di riwayat harga
+}
+
+type ProductPriceHistory struct {
+	gorm.Model
+	ProductID   uint     `json:"productId" gorm:"index"`
+	Product     *Product `json:"-" gorm:"foreignKey:ProductID;constraint:OnDelete:CASCADE;"`
+	OldPrice    uint     `json:"oldPrice"`
+	NewPrice    uint     `json:"newPrice"`
+	Source      string   `json:"source"`
+	ScheduleID  *uint    `json:"scheduleId"`
+	ChangedByID *uint    `json:"changedById"`
+}
@@ -1,15 +1,25 @@
 package models
 
-import "gorm.io/gorm"
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
 
 type Product struct {
 	gorm.Model
 	Name        string     `json:"name"`
 	Price       uint       `json:"price"`
+	Stock       *uint      `json:"stock"` // nil jika stok tidak dilacak (selalu tersedia)
 	Image       string     `json:"image"`
 	PublicID    string     `json:"public_id"`
 	Description string     `json:"description"`
 	CategoryID  uint       `json:"categoryId"`
 	Category    Category   `json:"category" gorm:"foreignKey:CategoryID;constraint:OnDelete:CASCADE;"`
 	CartItems   []CartItem `json:"cartItems" gorm:"constraint:OnDelete:CASCADE;"`
+
+	// Harga aktif dihitung dari jadwal diskon saat dibaca, tidak disimpan di tabel products
+	ActivePrice    uint       `json:"activePrice" gorm:"-"`
+	CompareAtPrice *uint      `json:"compareAtPrice" gorm:"-"` // harga coret selama diskon berlangsung
+	SaleEndsAt     *time.Time `json:"saleEndsAt" gorm:"-"`
 }
@@ -0,0 +1,36 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type ProductQuestion struct {
+	gorm.Model
+	ProductID  uint            `json:"productId" gorm:"index"`
+	Product    *Product        `json:"product,omitempty" gorm:"foreignKey:ProductID;constraint:OnDelete:CASCADE;"`
+	UserID     uint            `json:"userId"`
+	User       User            `json:"user" gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE;"`
+	Question   string          `json:"question"`
+	AnsweredAt *time.Time      `json:"answeredAt" gorm:"index"`
+	Answers    []ProductAnswer `json:"answers" gorm:"foreignKey:QuestionID;constraint:OnDelete:CASCADE;"`
+}
+
+type ProductAnswer struct {
+	gorm.Model
+	QuestionID      uint   `json:"questionId" gorm:"index"`
+	UserID          uint   `json:"userId"`
+	User            User   `json:"user" gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE;"`
+	Answer          string `json:"answer"`
+	IsAdmin         bool   `json:"isAdmin"`
+	IsVerifiedBuyer bool   `json:"isVerifiedBuyer"`
+	Upvotes         uint   `json:"upvotes" gorm:"default:0"`
+}
+
+// AnswerVote mencatat upvote agar satu user hanya bisa memberi satu vote per jawaban.
+type AnswerVote struct {
+	gorm.Model
+	AnswerID uint `json:"answerId" gorm:"uniqueIndex:idx_answer_vote_user"`
+	UserID   uint `json:"userId" gorm:"uniqueIndex:idx_answer_vote_user"`
+}
@@ -0,0 +1,88 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Status permintaan retur
+const (
+	ReturnStatusRequested        = "requested"
+	ReturnStatusApproved         = "approved"
+	ReturnStatusRejected         = "rejected"
+	ReturnStatusCancelled        = "cancelled"
+	ReturnStatusPickupScheduled  = "pickup_scheduled"
+	ReturnStatusReceived         = "received" // barang sudah diambil dan diterima gudang
+	ReturnStatusInspectionPassed = "inspection_passed"
+	ReturnStatusInspectionFailed = "inspection_failed"
+	ReturnStatusRefunded         = "refunded"
+	ReturnStatusReplaced         = "replaced"
+)
+
+// Alasan retur
+const (
+	ReturnReasonDamaged        = "damaged"
+	ReturnReasonWrongItem      = "wrong_item"
+	ReturnReasonWrongColour    = "wrong_colour"
+	ReturnReasonNotAsDescribed = "not_as_described"
+	ReturnReasonChangedMind    = "changed_mind"
+	ReturnReasonOther          = "other"
+)
+
+// Penyelesaian retur
+const (
+	ReturnResolutionRefund      = "refund"
+	ReturnResolutionReplacement = "replacement"
+)
+
+// ReturnRequest adalah permintaan retur untuk pesanan yang sudah diterima pelanggan.
+type ReturnRequest struct {
+	gorm.Model
+	OrderID            uint          `json:"orderId" gorm:"index"`
+	Order              *Order        `json:"order,omitempty"`
+	UserID             uint          `json:"userId" gorm:"index"`
+	User               User          `json:"-" gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE;"`
+	Status             string        `json:"status" gorm:"index;default:'requested'"`
+	Reason             string        `json:"reason"`
+	Description        string        `json:"description"`
+	Resolution         string        `json:"resolution"` // penyelesaian yang diminta/diputuskan: refund atau replacement
+	AdminNote          string        `json:"adminNote"`
+	PickupAt           *time.Time    `json:"pickupAt"`
+	PickupAddress      string        `json:"pickupAddress"`
+	InspectionNote     string        `json:"inspectionNote"`
+	RefundAmount       uint          `json:"refundAmount"` // dikembalikan sebagai saldo toko
+	ReplacementOrderID *uint         `json:"replacementOrderId"`
+	Items              []ReturnItem  `json:"items" gorm:"constraint:OnDelete:CASCADE;"`
+	Photos             []ReturnPhoto `json:"photos" gorm:"constraint:OnDelete:CASCADE;"`
+	Events             []ReturnEvent `json:"events" gorm:"constraint:OnDelete:CASCADE;"`
+}
+
+// ReturnItem adalah baris pesanan yang diretur.
+type ReturnItem struct {
+	gorm.Model
+	ReturnRequestID uint     `json:"returnRequestId" gorm:"index"`
+	CartItemID      uint     `json:"cartItemId"`
+	CartItem        CartItem `json:"-" gorm:"foreignKey:CartItemID"`
+	ProductID       uint     `json:"productId"`
+	Product         Product  `json:"product" gorm:"foreignKey:ProductID"`
+	Quantity        uint     `json:"quantity"`
+	Amount          uint     `json:"amount"` // nilai baris yang diretur sesuai harga yang dibayar
+}
+
+// ReturnPhoto adalah foto bukti kerusakan atau kesalahan barang.
+type ReturnPhoto struct {
+	gorm.Model
+	ReturnRequestID uint   `json:"returnRequestId" gorm:"index"`
+	Image           string `json:"image"`
+	PublicID        string `json:"-"`
+}
+
+// ReturnEvent mencatat riwayat status retur yang bisa dilihat pelanggan.
+type ReturnEvent struct {
+	gorm.Model
+	ReturnRequestID uint   `json:"returnRequestId" gorm:"index"`
+	Status          string `json:"status"`
+	Note            string `json:"note"`
+	ActorID         *uint  `json:"actorId"`
+}
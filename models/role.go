@@ -0,0 +1,103 @@
+package models
+
+import "gorm.io/gorm"
+
+// Permission yang bisa diberikan ke role. Dicek per route lewat middleware.RequirePermission.
+const (
+	PermAll             = "*" // semua akses, hanya untuk role admin
+	PermCatalogManage   = "catalog:manage"
+	PermPromotionManage = "promotion:manage"
+	PermQuestionManage  = "question:manage"
+	PermOrderRead       = "order:read"
+	PermOrderManage     = "order:manage"
+	PermOrderNote       = "order:note"
+	PermShipmentManage  = "shipment:manage"
+	PermReturnManage    = "return:manage"
+	PermFinanceManage   = "finance:manage"
+	PermRoleManage      = "role:manage"
+	PermUserRead        = "user:read"
+	PermUserManage      = "user:manage"
+	PermUserImpersonate = "user:impersonate"
+	PermAuditRead       = "audit:read"
+)
+
+// AllPermissions adalah daftar permission yang dikenal beserta penjelasannya.
+var AllPermissions = map[string]string{
+	PermCatalogManage:   "Kelola produk, kategori dan harga",
+	PermPromotionManage: "Kelola kupon dan promo",
+	PermQuestionManage:  "Jawab resmi dan moderasi tanya jawab produk",
+	PermOrderRead:       "Lihat dan ekspor pesanan",
+	PermOrderManage:     "Ubah status pesanan",
+	PermOrderNote:       "Tambah catatan internal pesanan",
+	PermShipmentManage:  "Kelola paket pengiriman",
+	PermReturnManage:    "Proses retur",
+	PermFinanceManage:   "Kelola PPN, saldo toko, poin loyalitas dan gift card",
+	PermRoleManage:      "Kelola role dan hak akses staf",
+	PermUserRead:        "Lihat data pelanggan, alamat dan pesanannya",
+	PermUserManage:      "Nonaktifkan akun dan paksa reset password",
+	PermUserImpersonate: "Masuk sebagai pelanggan untuk bantuan (tercatat di audit log)",
+	PermAuditRead:       "Lihat audit log",
+}
+
+// Role bawaan
+const (
+	RoleAdmin           = "admin"
+	RoleCatalogManager  = "catalog_manager"
+	RoleOrderFulfilment = "order_fulfilment"
+	RoleCustomerSupport = "customer_support"
+	RoleFinance         = "finance"
+)
+
+// DefaultRolePermissions adalah permission awal role bawaan saat pertama dibuat.
+var DefaultRolePermissions = map[string][]string{
+	RoleAdmin:           {PermAll},
+	RoleCatalogManager:  {PermCatalogManage, PermPromotionManage, PermQuestionManage},
+	RoleOrderFulfilment: {PermOrderRead, PermOrderManage, PermOrderNote, PermShipmentManage, PermReturnManage},
+	RoleCustomerSupport: {PermOrderRead, PermOrderNote, PermReturnManage, PermQuestionManage, PermUserRead, PermUserImpersonate},
+	RoleFinance:         {PermOrderRead, PermFinanceManage},
+}
+
+// Role adalah kumpulan permission yang diberikan ke staf.
+type Role struct {
+	gorm.Model
+	Name        string           `json:"name" gorm:"uniqueIndex"`
+	Description string           `json:"description"`
+	BuiltIn     bool             `json:"builtIn"` // role bawaan tidak bisa dihapus
+	Permissions []RolePermission `json:"permissions" gorm:"constraint:OnDelete:CASCADE;"`
+}
+
+// RolePermission adalah satu permission milik role.
+type RolePermission struct {
+	RoleID     uint   `json:"-" gorm:"primaryKey"`
+	Permission string `json:"permission" gorm:"primaryKey"`
+}
+
+// LoadUserAccess mengambil nama role dan gabungan permission milik user, beserta versi role-nya.
+// User lama dengan Role "admin" tetap dianggap admin.
+func LoadUserAccess(db *gorm.DB, userID uint) (roles []string, permissions []string, version uint, err error) {
+	var user User
+	if err = db.Preload("Roles.Permissions").Select("id", "role", "role_version").First(&user, userID).Error; err != nil {
+		return nil, nil, 0, err
+	}
+
+	roles = []string{}
+	permissions = []string{}
+	seen := map[string]bool{}
+	addPermission := func(permission string) {
+		if !seen[permission] {
+			seen[permission] = true
+			permissions = append(permissions, permission)
+		}
+	}
+	for _, role := range user.Roles {
+		roles = append(roles, role.Name)
+		for _, permission := range role.Permissions {
+			addPermission(permission.Permission)
+		}
+	}
+	if user.Role == RoleAdmin && !seen[PermAll] {
+		roles = append(roles, RoleAdmin)
+		addPermission(PermAll)
+	}
+	return roles, permissions, user.RoleVersion, nil
+}
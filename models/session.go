@@ -0,0 +1,24 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Session adalah sesi login di satu perangkat. Refresh token disimpan sebagai hash
+// dan diganti setiap kali dipakai (rotasi).
+type Session struct {
+	gorm.Model
+	UserID            uint       `json:"userId" gorm:"index"`
+	User              User       `json:"-" gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE;"`
+	RefreshTokenHash  string     `json:"-" gorm:"uniqueIndex"`
+	PreviousTokenHash string     `json:"-" gorm:"index"` // refresh token sebelum rotasi, untuk mendeteksi token dicuri
+	UserAgent         string     `json:"userAgent"`
+	IP                string     `json:"ip"`
+	LastUsedAt        time.Time  `json:"lastUsedAt"`
+	ExpiresAt         time.Time  `json:"expiresAt"`
+	RevokedAt         *time.Time `json:"revokedAt"`
+	TwoFactor         bool       `json:"twoFactor"`      // login sudah lolos verifikasi 2FA
+	ImpersonatorID    *uint      `json:"impersonatorId"` // admin yang masuk sebagai user ini untuk bantuan
+}
@@ -0,0 +1,55 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Status pengiriman, berurutan dari dikemas sampai diterima
+const (
+	ShipmentStatusPending        = "pending" // sedang dikemas di gudang
+	ShipmentStatusShipped        = "shipped" // sudah diserahkan ke kurir
+	ShipmentStatusInTransit      = "in_transit"
+	ShipmentStatusOutForDelivery = "out_for_delivery"
+	ShipmentStatusDelivered      = "delivered"
+	ShipmentStatusCancelled      = "cancelled"
+)
+
+// Shipment adalah satu paket pengiriman dari sebuah pesanan.
+// Satu pesanan bisa dikirim dalam beberapa paket dari gudang atau kurir yang berbeda.
+type Shipment struct {
+	gorm.Model
+	OrderID        uint            `json:"orderId" gorm:"index"`
+	Warehouse      string          `json:"warehouse"`
+	Carrier        string          `json:"carrier"`
+	TrackingNumber string          `json:"trackingNumber" gorm:"index"`
+	Status         string          `json:"status" gorm:"index;default:'pending'"`
+	Note           string          `json:"note"`
+	EstimatedAt    *time.Time      `json:"estimatedAt"`
+	ShippedAt      *time.Time      `json:"shippedAt"`
+	DeliveredAt    *time.Time      `json:"deliveredAt"`
+	Items          []ShipmentItem  `json:"items" gorm:"constraint:OnDelete:CASCADE;"`
+	Events         []ShipmentEvent `json:"events" gorm:"constraint:OnDelete:CASCADE;"`
+}
+
+// ShipmentItem adalah baris pesanan (sebagian atau seluruhnya) yang ada di dalam paket.
+type ShipmentItem struct {
+	gorm.Model
+	ShipmentID uint     `json:"shipmentId" gorm:"index"`
+	CartItemID uint     `json:"cartItemId" gorm:"index"`
+	CartItem   CartItem `json:"-" gorm:"foreignKey:CartItemID"`
+	ProductID  uint     `json:"productId"`
+	Product    Product  `json:"product" gorm:"foreignKey:ProductID"`
+	Quantity   uint     `json:"quantity"`
+}
+
+// ShipmentEvent adalah riwayat pelacakan paket yang bisa dilihat pelanggan.
+type ShipmentEvent struct {
+	gorm.Model
+	ShipmentID  uint      `json:"shipmentId" gorm:"index"`
+	Status      string    `json:"status"`
+	Location    string    `json:"location"`
+	Description string    `json:"description"`
+	OccurredAt  time.Time `json:"occurredAt"`
+}
@@ -0,0 +1,17 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// RecoveryCode adalah kode cadangan sekali pakai untuk login 2FA saat perangkat authenticator hilang.
+// Kode disimpan sebagai hash.
+type RecoveryCode struct {
+	gorm.Model
+	UserID   uint       `json:"-" gorm:"index"`
+	User     User       `json:"-" gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE;"`
+	CodeHash string     `json:"-" gorm:"uniqueIndex"`
+	UsedAt   *time.Time `json:"usedAt"`
+}
@@ -1,15 +1,32 @@
 package models
 
-import "gorm.io/gorm"
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
 
 type User struct {
 	gorm.Model
-	Name      string  `json:"name"`
-	Email     string  `json:"email"`
-	Password  string  `json:"-"`
-	Role      string  `json:"role"`
-	AddressID *uint   `json:"addressId"`
-	Address   Address `gorm:"foreignKey:AddressID;constraint:OnUpdate:CASCADE,OnDelete:SET NULL;"`
-	Orders    []Order `json:"orders" gorm:"constraint:OnDelete:CASCADE;"`
-	Carts     []Cart  `json:"carts" gorm:"constraint:OnDelete:CASCADE;"`
+	Name            string     `json:"name"`
+	Email           string     `json:"email"`
+	Password        string     `json:"-"`
+	EmailVerifiedAt *time.Time `json:"emailVerifiedAt"`
+	// 2FA TOTP: secret aktif, secret yang sedang didaftarkan, dan langkah waktu kode terakhir (anti pemakaian ulang)
+	TwoFactorSecret        string     `json:"-"`
+	TwoFactorPendingSecret string     `json:"-"`
+	TwoFactorLastStep      int64      `json:"-"`
+	TwoFactorEnabledAt     *time.Time `json:"twoFactorEnabledAt"`
+	DisabledAt             *time.Time `json:"disabledAt"` // akun dinonaktifkan/diblokir admin
+	DisabledReason         string     `json:"disabledReason"`
+	PasswordResetRequired  bool       `json:"passwordResetRequired"` // dipaksa admin, login ditolak sampai password direset
+	Role                   string     `json:"role"`                  // "admin" lama; hak akses staf diatur lewat Roles
+	Roles                  []Role     `json:"roles,omitempty" gorm:"many2many:user_roles;constraint:OnDelete:CASCADE;"`
+	RoleVersion            uint       `json:"-"`         // naik setiap role user berubah agar token lama diperbarui
+	TaxExempt              bool       `json:"taxExempt"` // pelanggan B2B yang dibebaskan dari PPN
+	TaxID                  string     `json:"taxId"`     // NPWP pelanggan
+	AddressID              *uint      `json:"addressId"`
+	Address                Address    `gorm:"foreignKey:AddressID;constraint:OnUpdate:CASCADE,OnDelete:SET NULL;"`
+	Orders                 []Order    `json:"orders" gorm:"constraint:OnDelete:RESTRICT;"` // pesanan disimpan untuk akuntansi walau akun dihapus
+	Carts                  []Cart     `json:"carts" gorm:"constraint:OnDelete:CASCADE;"`
 }
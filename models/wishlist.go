@@ -0,0 +1,22 @@
+package models
+
+import "gorm.io/gorm"
+
+type Wishlist struct {
+	gorm.Model
+	UserID     uint           `json:"userId" gorm:"index"`
+	User       User           `json:"-" gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE;"`
+	Name       string         `json:"name"`
+	ShareToken *string        `json:"shareToken" gorm:"uniqueIndex"`
+	Items      []WishlistItem `json:"items" gorm:"constraint:OnDelete:CASCADE;"`
+}
+
+type WishlistItem struct {
+	gorm.Model
+	WishlistID        uint    `json:"wishlistId" gorm:"index"`
+	ProductID         uint    `json:"productId" gorm:"index"`
+	Product           Product `json:"product" gorm:"foreignKey:ProductID;constraint:OnDelete:CASCADE;"`
+	PriceWhenAdded    uint    `json:"priceWhenAdded"` // acuan notifikasi penurunan harga
+	NotifyPriceDrop   bool    `json:"notifyPriceDrop"`
+	NotifyBackInStock bool    `json:"notifyBackInStock"`
+}
@@ -3,6 +3,8 @@ package route
 import (
 	"go-be/controller"
 	"go-be/middleware"
+	"go-be/models"
+	"time"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
@@ -13,44 +15,124 @@ func SetupRoute() *gin.Engine {
 	r.Use(cors.New(cors.Config{
 		AllowOrigins:     []string{"*"},
 		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowHeaders:     []string{"Origin", "Content-Type", "Authorization"},
-		ExposeHeaders:    []string{"Content-Length"},
+		AllowHeaders:     []string{"Origin", "Content-Type", "Authorization", controller.CartTokenHeader},
+		ExposeHeaders:    []string{"Content-Length", controller.CartTokenHeader},
 		AllowCredentials: true,
 	}))
 
 	r.POST("/sign-up", controller.SignUp)
 	r.POST("/sign-in", controller.SignIn)
+	r.POST("/sign-in/2fa", middleware.LimitByIPWindow("sign-in-2fa", 20, 15*time.Minute), controller.SignInTwoFactor)
+	r.POST("/refresh-token", controller.RefreshToken)
+	r.GET("/auth/oidc", controller.GetOIDCProviders)
+	r.GET("/auth/oidc/:provider/login", middleware.LimitByIPWindow("oidc-login", 30, 15*time.Minute), controller.StartOIDCLogin)
+	r.POST("/auth/oidc/:provider/callback", middleware.LimitByIPWindow("oidc-callback", 30, 15*time.Minute), controller.OIDCCallback)
+	r.GET("/.well-known/jwks.json", controller.GetJWKS)
+	r.POST("/verify-email", middleware.LimitByIPWindow("verify-email", 20, time.Hour), controller.VerifyEmail)
+	r.POST("/forgot-password", middleware.LimitByIPWindow("forgot-password", 5, time.Hour), controller.ForgotPassword)
+	r.POST("/reset-password", middleware.LimitByIPWindow("reset-password", 10, time.Hour), controller.ResetPassword)
+	r.POST("/logout", middleware.AuthMiddleware(), controller.Logout)
+	r.POST("/logout-all", middleware.AuthMiddleware(), middleware.DenyImpersonation, controller.LogoutAll)
 	r.GET("/product", controller.GetProduct)
 	r.GET("/product/:id", controller.GetProductByID)
+	r.GET("/product/:id/questions", controller.GetProductQuestions)
 	r.POST("/api/v1/duitku/callback", controller.HandleDuitkuCallback)
 	r.GET("/category", controller.GetCategory)
+	r.GET("/shared-wishlist/:token", controller.GetSharedWishlist)
 
 	userRoute := r.Group("/users", middleware.AuthMiddleware())
 	{
 		userRoute.GET("", controller.GetUserById)
-		userRoute.GET("/admin", controller.GetUser)
-		userRoute.PUT("/update", controller.UpdateUser)
-		userRoute.DELETE("/delete", controller.DeleteUser)
+		userRoute.GET("/admin", middleware.RequirePermission(models.PermUserRead), controller.GetAdminUsers)
+		userRoute.PUT("/update", middleware.DenyImpersonation, controller.UpdateUser)
+		userRoute.DELETE("/delete", middleware.DenyImpersonation, controller.DeleteUser)
+		userRoute.GET("/export", middleware.DenyImpersonation, controller.ExportPersonalData)
 		userRoute.GET("/address", controller.GetAddress)
 		userRoute.POST("/create-address", controller.CreateAddress)
 		userRoute.PUT("/update-address", controller.UpdateAddress)
 		userRoute.DELETE("/delete-address", controller.DeleteAddress)
+		userRoute.GET("/notifications", controller.GetNotifications)
+		userRoute.PUT("/notifications/read/:id", controller.MarkNotificationRead)
+		userRoute.GET("/store-credit", controller.GetStoreCredit)
+		userRoute.GET("/loyalty", controller.GetLoyalty)
+		userRoute.GET("/sessions", controller.GetSessions)
+		userRoute.DELETE("/sessions/:id", middleware.DenyImpersonation, controller.RevokeSession)
+		userRoute.GET("/2fa", controller.GetTwoFactorStatus)
+		userRoute.POST("/2fa/setup", middleware.DenyImpersonation, controller.SetupTwoFactor)
+		userRoute.POST("/2fa/enable", middleware.DenyImpersonation, controller.EnableTwoFactor)
+		userRoute.POST("/2fa/disable", middleware.DenyImpersonation, controller.DisableTwoFactor)
+		userRoute.POST("/2fa/recovery-codes", middleware.DenyImpersonation, controller.RegenerateRecoveryCodes)
+		userRoute.POST("/resend-verification", middleware.LimitByIPWindow("resend-verification", 5, time.Hour), controller.ResendVerification)
 
 	}
-	productRoute := r.Group("/product-admin", middleware.AuthMiddleware(), middleware.AdminMiddleware)
+	productRoute := r.Group("/product-admin", middleware.AuthMiddleware(), middleware.RequirePermission(models.PermCatalogManage))
 	{
 		productRoute.POST("/create", controller.CreateProduct)
 		productRoute.PUT("/update/:id", controller.UpdateProduct)
 		productRoute.DELETE("/delete/:id", controller.DeleteProduct)
+		productRoute.POST("/price-schedule/:id", controller.CreatePriceSchedule)
+		productRoute.GET("/price-schedule/:id", controller.GetPriceSchedules)
+		productRoute.DELETE("/delete-price-schedule/:id", controller.DeletePriceSchedule)
+		productRoute.GET("/price-history/:id", controller.GetPriceHistory)
 	}
-	categoryRoute := r.Group("/category-admin", middleware.AuthMiddleware(), middleware.AdminMiddleware)
+	categoryRoute := r.Group("/category-admin", middleware.AuthMiddleware())
 	{
-		categoryRoute.POST("/create", controller.CreateCategory)
-		categoryRoute.DELETE("/delete/:id", controller.DeleteCategory)
+		categoryRoute.POST("/create", middleware.RequirePermission(models.PermCatalogManage), controller.CreateCategory)
+		categoryRoute.DELETE("/delete/:id", middleware.RequirePermission(models.PermCatalogManage), controller.DeleteCategory)
+		categoryRoute.PUT("/tax/:id", middleware.RequirePermission(models.PermFinanceManage), controller.UpdateCategoryTax)
+		categoryRoute.PUT("/loyalty/:id", middleware.RequirePermission(models.PermFinanceManage), controller.UpdateCategoryLoyaltyRate)
+	}
+	userAdminRoute := r.Group("/user-admin", middleware.AuthMiddleware())
+	{
+		userAdminRoute.GET("", middleware.RequirePermission(models.PermUserRead), controller.GetAdminUsers)
+		userAdminRoute.GET("/audit-logs", middleware.RequirePermission(models.PermAuditRead), controller.GetAuditLogs)
+		userAdminRoute.GET("/:id", middleware.RequirePermission(models.PermUserRead), controller.GetAdminUserByID)
+		userAdminRoute.GET("/:id/orders", middleware.RequirePermission(models.PermUserRead), controller.GetAdminUserOrders)
+		userAdminRoute.PUT("/disable/:id", middleware.RequirePermission(models.PermUserManage), controller.DisableUser)
+		userAdminRoute.PUT("/enable/:id", middleware.RequirePermission(models.PermUserManage), controller.EnableUser)
+		userAdminRoute.POST("/force-password-reset/:id", middleware.RequirePermission(models.PermUserManage), controller.ForcePasswordReset)
+		userAdminRoute.POST("/impersonate/:id", middleware.RequirePermission(models.PermUserImpersonate), controller.ImpersonateUser)
+		userAdminRoute.PUT("/tax/:id", middleware.RequirePermission(models.PermFinanceManage), controller.UpdateUserTax)
+		userAdminRoute.POST("/store-credit/:id", middleware.RequirePermission(models.PermFinanceManage), controller.AdjustStoreCredit)
+		userAdminRoute.POST("/loyalty/:id", middleware.RequirePermission(models.PermFinanceManage), controller.AdjustLoyaltyPoints)
+	}
+	giftCardRoute := r.Group("/gift-card", middleware.AuthMiddleware())
+	{
+		giftCardRoute.GET("", controller.GetMyGiftCards)
+		giftCardRoute.POST("/purchase", controller.PurchaseGiftCard)
+		giftCardRoute.GET("/balance/:code", middleware.LimitByIPWindow("gift-card-balance", 20, 15*time.Minute), controller.CheckGiftCardBalance)
+		giftCardRoute.POST("/redeem", middleware.LimitByIPWindow("gift-card-redeem", 20, 15*time.Minute), controller.RedeemGiftCard)
+	}
+	returnRoute := r.Group("/return", middleware.AuthMiddleware())
+	{
+		returnRoute.GET("", controller.GetUserReturns)
+		returnRoute.GET("/:id", controller.GetUserReturnByID)
+		returnRoute.POST("/create/:number", controller.CreateReturnRequest)
+		returnRoute.POST("/photo/:id", controller.UploadReturnPhotos)
+		returnRoute.DELETE("/cancel/:id", controller.CancelReturnRequest)
+	}
+	returnAdminRoute := r.Group("/return-admin", middleware.AuthMiddleware(), middleware.RequirePermission(models.PermReturnManage))
+	{
+		returnAdminRoute.GET("", controller.GetReturns)
+		returnAdminRoute.GET("/:id", controller.GetReturnByID)
+		returnAdminRoute.PUT("/approve/:id", controller.ApproveReturn)
+		returnAdminRoute.PUT("/reject/:id", controller.RejectReturn)
+		returnAdminRoute.PUT("/schedule-pickup/:id", controller.ScheduleReturnPickup)
+		returnAdminRoute.PUT("/received/:id", controller.MarkReturnReceived)
+		returnAdminRoute.PUT("/inspect/:id", controller.InspectReturn)
+		returnAdminRoute.PUT("/resolve/:id", controller.ResolveReturn)
+	}
+	giftCardAdminRoute := r.Group("/gift-card-admin", middleware.AuthMiddleware(), middleware.RequirePermission(models.PermFinanceManage))
+	{
+		giftCardAdminRoute.GET("", controller.GetGiftCards)
 	}
 	cartRoute := r.Group("/cart", middleware.AuthMiddleware())
 	{
 		cartRoute.GET("", controller.GetUserCart)
+		cartRoute.POST("/acknowledge", controller.AcknowledgeCartChanges)
+		cartRoute.GET("/totals", controller.GetCartTotals)
+		cartRoute.POST("/coupon", controller.ApplyCartCoupon)
+		cartRoute.DELETE("/coupon", controller.RemoveCartCoupon)
 		cartRoute.POST("/create", controller.AddToCart)
 		cartRoute.PUT("/update/:id", controller.UpdateCartItem)
 		cartRoute.DELETE("/delete/:id", controller.DeleteCartItem)
@@ -58,11 +140,84 @@ func SetupRoute() *gin.Engine {
 		cartRoute.PUT("/update-cart/:id", controller.UpdateCartItemQuantity)
 		cartRoute.DELETE("/delete-cart/:id", controller.DeleteCartItem)
 	}
+	couponRoute := r.Group("/coupon-admin", middleware.AuthMiddleware(), middleware.RequirePermission(models.PermPromotionManage))
+	{
+		couponRoute.GET("", controller.GetCoupons)
+		couponRoute.POST("/create", controller.CreateCoupon)
+		couponRoute.PUT("/update/:id", controller.UpdateCoupon)
+		couponRoute.DELETE("/delete/:id", controller.DeleteCoupon)
+		couponRoute.GET("/redemptions/:id", controller.GetCouponRedemptions)
+	}
+	promotionRoute := r.Group("/promotion-admin", middleware.AuthMiddleware(), middleware.RequirePermission(models.PermPromotionManage))
+	{
+		promotionRoute.GET("", controller.GetPromotions)
+		promotionRoute.POST("/create", controller.CreatePromotion)
+		promotionRoute.PUT("/update/:id", controller.UpdatePromotion)
+		promotionRoute.DELETE("/delete/:id", controller.DeletePromotion)
+	}
+	guestCartRoute := r.Group("/guest-cart")
+	{
+		guestCartRoute.GET("", controller.GetGuestCart)
+		guestCartRoute.POST("/create", middleware.LimitByIPWindow("guest-cart", 30, 15*time.Minute), controller.AddToGuestCart)
+		guestCartRoute.PUT("/update/:id", controller.UpdateGuestCartItem)
+		guestCartRoute.DELETE("/delete/:id", controller.DeleteGuestCartItem)
+	}
 	orderRoute := r.Group("/oder", middleware.AuthMiddleware())
 	{
 		orderRoute.POST("/checkout", middleware.LimitByIP(), controller.Checkout)
 		orderRoute.GET("/", controller.GetUserOrders)
-		orderRoute.GET("/:id", controller.GetOrderByID)
+		orderRoute.GET("/:number", controller.GetOrderByID)
+		orderRoute.GET("/:number/invoice", controller.GetOrderInvoice)
+		orderRoute.GET("/tracking/:number", controller.GetOrderTracking)
+	}
+	orderAdminRoute := r.Group("/order-admin", middleware.AuthMiddleware())
+	{
+		orderAdminRoute.GET("", middleware.RequirePermission(models.PermOrderRead), controller.GetAdminOrders)
+		orderAdminRoute.GET("/export", middleware.RequirePermission(models.PermOrderRead), controller.ExportAdminOrders)
+		orderAdminRoute.GET("/:id", middleware.RequirePermission(models.PermOrderRead), controller.GetAdminOrderByID)
+		orderAdminRoute.PUT("/status/:id", middleware.RequirePermission(models.PermOrderManage), controller.UpdateAdminOrderStatus)
+		orderAdminRoute.POST("/note/:id", middleware.RequirePermission(models.PermOrderNote), controller.AddOrderNote)
+	}
+	shipmentAdminRoute := r.Group("/shipment-admin", middleware.AuthMiddleware(), middleware.RequirePermission(models.PermShipmentManage))
+	{
+		shipmentAdminRoute.GET("/order/:orderId", controller.GetOrderShipments)
+		shipmentAdminRoute.POST("/create/:orderId", controller.CreateShipment)
+		shipmentAdminRoute.PUT("/update/:id", controller.UpdateShipment)
+		shipmentAdminRoute.PUT("/status/:id", controller.UpdateShipmentStatus)
+	}
+
+	wishlistRoute := r.Group("/wishlist", middleware.AuthMiddleware())
+	{
+		wishlistRoute.GET("", controller.GetWishlists)
+		wishlistRoute.POST("/create", controller.CreateWishlist)
+		wishlistRoute.PUT("/update/:id", controller.RenameWishlist)
+		wishlistRoute.DELETE("/delete/:id", controller.DeleteWishlist)
+		wishlistRoute.POST("/add-item/:id", controller.AddWishlistItem)
+		wishlistRoute.DELETE("/delete-item/:id", controller.RemoveWishlistItem)
+		wishlistRoute.POST("/move-to-cart/:id", controller.MoveWishlistItemToCart)
+		wishlistRoute.POST("/save-for-later/:id", controller.SaveCartItemForLater)
+		wishlistRoute.POST("/share/:id", controller.ShareWishlist)
+		wishlistRoute.DELETE("/share/:id", controller.UnshareWishlist)
+	}
+	questionRoute := r.Group("/question", middleware.AuthMiddleware())
+	{
+		questionRoute.POST("/create/:productId", controller.AskQuestion)
+		questionRoute.POST("/answer/:id", controller.AnswerQuestion)
+		questionRoute.POST("/upvote/:id", controller.UpvoteAnswer)
+	}
+	questionAdminRoute := r.Group("/question-admin", middleware.AuthMiddleware(), middleware.RequirePermission(models.PermQuestionManage))
+	{
+		questionAdminRoute.GET("/unanswered", controller.GetUnansweredQuestions)
+		questionAdminRoute.DELETE("/delete/:id", controller.DeleteQuestion)
+	}
+	roleAdminRoute := r.Group("/role-admin", middleware.AuthMiddleware(), middleware.RequirePermission(models.PermRoleManage))
+	{
+		roleAdminRoute.GET("", controller.GetRoles)
+		roleAdminRoute.GET("/permissions", controller.GetPermissions)
+		roleAdminRoute.POST("/create", controller.CreateRole)
+		roleAdminRoute.PUT("/update/:id", controller.UpdateRole)
+		roleAdminRoute.DELETE("/delete/:id", controller.DeleteRole)
+		roleAdminRoute.PUT("/assign/:userId", controller.AssignUserRoles)
 	}
 
 	return r
@@ -0,0 +1,19 @@
+package utils
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// NormalizeEmail menyeragamkan email sebelum disimpan atau dicari: spasi dibuang dan huruf dikecilkan.
+func NormalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// IsUniqueViolation mengecek apakah error berasal dari pelanggaran unique index Postgres.
+func IsUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23505"
+}
@@ -0,0 +1,24 @@
+package utils
+
+import (
+	"os"
+	"strconv"
+)
+
+// EnvUint membaca variabel environment bertipe angka, atau def jika kosong/tidak valid.
+func EnvUint(key string, def uint) uint {
+	val, err := strconv.ParseUint(os.Getenv(key), 10, 64)
+	if err != nil {
+		return def
+	}
+	return uint(val)
+}
+
+// EnvBool membaca variabel environment bertipe boolean ("true", "1", ...), atau def jika kosong/tidak valid.
+func EnvBool(key string, def bool) bool {
+	val, err := strconv.ParseBool(os.Getenv(key))
+	if err != nil {
+		return def
+	}
+	return val
+}
@@ -0,0 +1,238 @@
+package utils
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/joho/godotenv"
+)
+
+// jwtKeySet adalah kunci penandatangan token akses dan kunci-kunci verifikasinya.
+// Dimuat sekali dari environment:
+//   - JWT_SIGNING_ALG: HS256 (default), RS256 atau EdDSA
+//   - JWT_PRIVATE_KEY_FILE / JWT_PRIVATE_KEY: kunci privat PEM untuk RS256/EdDSA
+//   - JWT_KEY_ID: kid kunci aktif (default sidik jari kunci publik)
+//   - JWT_PUBLIC_KEYS: kunci publik lama yang masih diterima saat rotasi, format "kid=file.pem,kid2=file2.pem"
+//   - JWT_ALLOW_HS256: tetap terima token HS256 lama setelah pindah ke kunci asimetris
+type jwtKeySet struct {
+	secret      []byte
+	method      jwt.SigningMethod
+	signingKey  crypto.PrivateKey
+	signingKid  string
+	verifyKeys  map[string]crypto.PublicKey
+	allowHMAC   bool
+	orderedKids []string // urutan kid untuk JWKS, kunci aktif lebih dulu
+}
+
+var (
+	jwtKeys     *jwtKeySet
+	jwtKeysErr  error
+	jwtKeysOnce sync.Once
+)
+
+// LoadJWTKeys memuat konfigurasi kunci JWT. Dipanggil saat aplikasi mulai agar salah konfigurasi langsung ketahuan.
+func LoadJWTKeys() error {
+	jwtKeysOnce.Do(func() {
+		godotenv.Load()
+		jwtKeys, jwtKeysErr = loadJWTKeySet()
+	})
+	return jwtKeysErr
+}
+
+func currentJWTKeys() (*jwtKeySet, error) {
+	if err := LoadJWTKeys(); err != nil {
+		return nil, err
+	}
+	return jwtKeys, nil
+}
+
+func loadJWTKeySet() (*jwtKeySet, error) {
+	keys := &jwtKeySet{
+		secret:     []byte(os.Getenv("JWT_SECRET")),
+		verifyKeys: map[string]crypto.PublicKey{},
+	}
+
+	alg := strings.ToUpper(os.Getenv("JWT_SIGNING_ALG"))
+	switch alg {
+	case "", "HS256":
+		keys.method = jwt.SigningMethodHS256
+		keys.allowHMAC = true
+	case "RS256", "EDDSA":
+		pemBytes, err := readPEM("JWT_PRIVATE_KEY_FILE", "JWT_PRIVATE_KEY")
+		if err != nil {
+			return nil, err
+		}
+		var public crypto.PublicKey
+		if alg == "RS256" {
+			private, err := jwt.ParseRSAPrivateKeyFromPEM(pemBytes)
+			if err != nil {
+				return nil, fmt.Errorf("JWT_PRIVATE_KEY bukan kunci RSA yang valid: %w", err)
+			}
+			keys.method, keys.signingKey, public = jwt.SigningMethodRS256, private, &private.PublicKey
+		} else {
+			private, err := jwt.ParseEdPrivateKeyFromPEM(pemBytes)
+			if err != nil {
+				return nil, fmt.Errorf("JWT_PRIVATE_KEY bukan kunci Ed25519 yang valid: %w", err)
+			}
+			edPrivate := private.(ed25519.PrivateKey)
+			keys.method, keys.signingKey, public = jwt.SigningMethodEdDSA, edPrivate, edPrivate.Public()
+		}
+		kid := os.Getenv("JWT_KEY_ID")
+		if kid == "" {
+			if kid, err = keyThumbprint(public); err != nil {
+				return nil, err
+			}
+		}
+		keys.signingKid = kid
+		keys.verifyKeys[kid] = public
+		keys.orderedKids = append(keys.orderedKids, kid)
+		keys.allowHMAC = EnvBool("JWT_ALLOW_HS256", false)
+	default:
+		return nil, fmt.Errorf("JWT_SIGNING_ALG %q tidak didukung", alg)
+	}
+
+	for _, entry := range strings.Split(os.Getenv("JWT_PUBLIC_KEYS"), ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		kid, path, ok := strings.Cut(entry, "=")
+		if !ok {
+			return nil, fmt.Errorf("format JWT_PUBLIC_KEYS harus kid=file.pem: %q", entry)
+		}
+		pemBytes, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("gagal membaca kunci publik %s: %w", kid, err)
+		}
+		public, err := parsePublicKeyPEM(pemBytes)
+		if err != nil {
+			return nil, fmt.Errorf("kunci publik %s tidak valid: %w", kid, err)
+		}
+		if _, exists := keys.verifyKeys[kid]; !exists {
+			keys.orderedKids = append(keys.orderedKids, kid)
+		}
+		keys.verifyKeys[kid] = public
+	}
+
+	// JWT_SECRET tetap dipakai untuk token HS256 dan token keranjang tamu
+	if len(keys.secret) == 0 {
+		return nil, errors.New("JWT_SECRET wajib diisi")
+	}
+	return keys, nil
+}
+
+// readPEM membaca PEM dari file (fileKey) atau langsung dari isi variabel environment (valueKey).
+func readPEM(fileKey, valueKey string) ([]byte, error) {
+	if path := os.Getenv(fileKey); path != "" {
+		return os.ReadFile(path)
+	}
+	if value := os.Getenv(valueKey); value != "" {
+		// Baris baru sering ditulis sebagai \n di file .env
+		return []byte(strings.ReplaceAll(value, `\n`, "\n")), nil
+	}
+	return nil, fmt.Errorf("%s atau %s wajib diisi", fileKey, valueKey)
+}
+
+// parsePublicKeyPEM membaca kunci publik RSA atau Ed25519.
+func parsePublicKeyPEM(pemBytes []byte) (crypto.PublicKey, error) {
+	if key, err := jwt.ParseRSAPublicKeyFromPEM(pemBytes); err == nil {
+		return key, nil
+	}
+	return jwt.ParseEdPublicKeyFromPEM(pemBytes)
+}
+
+// keyThumbprint membuat kid dari hash SHA-256 kunci publik.
+func keyThumbprint(public crypto.PublicKey) (string, error) {
+	der, err := x509.MarshalPKIXPublicKey(public)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(der)
+	return hex.EncodeToString(sum[:8]), nil
+}
+
+// actionSecret adalah kunci HMAC khusus token aksi (verifikasi email, reset password, login 2FA),
+// diturunkan dari JWT_SECRET agar tanda tangannya tidak pernah valid sebagai token akses.
+func (k *jwtKeySet) actionSecret() []byte {
+	mac := hmac.New(sha256.New, k.secret)
+	mac.Write([]byte("go-be action token"))
+	return mac.Sum(nil)
+}
+
+// sign menandatangani claims dengan kunci aktif dan menyertakan kid di header.
+func (k *jwtKeySet) sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(k.method, claims)
+	if k.signingKey == nil {
+		return token.SignedString(k.secret)
+	}
+	token.Header["kid"] = k.signingKid
+	return token.SignedString(k.signingKey)
+}
+
+// keyFunc memilih kunci verifikasi berdasarkan algoritma dan kid di header token.
+func (k *jwtKeySet) keyFunc(token *jwt.Token) (interface{}, error) {
+	switch token.Method.(type) {
+	case *jwt.SigningMethodHMAC:
+		if !k.allowHMAC {
+			return nil, jwt.ErrSignatureInvalid
+		}
+		return k.secret, nil
+	case *jwt.SigningMethodRSA, *jwt.SigningMethodEd25519:
+		kid, _ := token.Header["kid"].(string)
+		key, ok := k.verifyKeys[kid]
+		if !ok {
+			return nil, fmt.Errorf("kid %q tidak dikenal", kid)
+		}
+		switch key.(type) {
+		case *rsa.PublicKey:
+			if _, ok := token.Method.(*jwt.SigningMethodRSA); ok {
+				return key, nil
+			}
+		case ed25519.PublicKey:
+			if _, ok := token.Method.(*jwt.SigningMethodEd25519); ok {
+				return key, nil
+			}
+		}
+		return nil, jwt.ErrSignatureInvalid
+	}
+	return nil, jwt.ErrSignatureInvalid
+}
+
+// JWKS mengembalikan kunci publik verifikasi token akses dalam format JSON Web Key Set.
+func JWKS() (map[string]interface{}, error) {
+	keys, err := currentJWTKeys()
+	if err != nil {
+		return nil, err
+	}
+	encode := base64.RawURLEncoding.EncodeToString
+	list := make([]map[string]string, 0, len(keys.orderedKids))
+	for _, kid := range keys.orderedKids {
+		switch key := keys.verifyKeys[kid].(type) {
+		case *rsa.PublicKey:
+			list = append(list, map[string]string{
+				"kty": "RSA", "use": "sig", "alg": "RS256", "kid": kid,
+				"n": encode(key.N.Bytes()),
+				"e": encode(big.NewInt(int64(key.E)).Bytes()),
+			})
+		case ed25519.PublicKey:
+			list = append(list, map[string]string{
+				"kty": "OKP", "use": "sig", "alg": "EdDSA", "crv": "Ed25519", "kid": kid,
+				"x": encode(key),
+			})
+		}
+	}
+	return map[string]interface{}{"keys": list}, nil
+}
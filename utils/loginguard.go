@@ -0,0 +1,127 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Perlindungan brute-force login. Percobaan gagal dihitung per akun (email) dan per IP di Redis:
+//   - LOGIN_DELAY_AFTER (default 3): setelah sekian kali gagal, percobaan berikutnya harus menunggu
+//     1, 2, 4, ... detik (maks. 60 detik)
+//   - LOGIN_MAX_ATTEMPTS (default 5): akun dikunci sementara setelah sekian kali gagal
+//   - LOGIN_IP_MAX_ATTEMPTS (default 20): IP dikunci sementara setelah sekian kali gagal di akun mana pun
+//   - LOGIN_FAILURE_WINDOW_MINUTES (default 15): jendela waktu penghitungan percobaan gagal
+//   - LOGIN_LOCKOUT_MINUTES (default 15): lama penguncian
+const maxLoginDelay = 60 * time.Second
+
+func loginFailKey(scope, id string) string {
+	return fmt.Sprintf("login:fail:%s:%s", scope, id)
+}
+
+func loginLockKey(scope, id string) string {
+	return fmt.Sprintf("login:lock:%s:%s", scope, id)
+}
+
+func loginDelayKey(email string) string {
+	return fmt.Sprintf("login:delay:%s", email)
+}
+
+func loginFailureWindow() time.Duration {
+	return time.Duration(EnvUint("LOGIN_FAILURE_WINDOW_MINUTES", 15)) * time.Minute
+}
+
+// LoginLockoutDuration adalah lama akun atau IP dikunci setelah terlalu banyak percobaan gagal.
+func LoginLockoutDuration() time.Duration {
+	return time.Duration(EnvUint("LOGIN_LOCKOUT_MINUTES", 15)) * time.Minute
+}
+
+// LoginFailure adalah hasil pencatatan satu percobaan login yang gagal.
+type LoginFailure struct {
+	AccountLocked bool // akun baru saja dikunci oleh percobaan ini
+	IPLocked      bool // IP baru saja dikunci oleh percobaan ini
+}
+
+// LoginRetryAfter mengembalikan lama waktu tunggu sebelum email/IP boleh mencoba login lagi,
+// atau 0 jika boleh mencoba sekarang.
+func LoginRetryAfter(email, ip string) (time.Duration, error) {
+	ctx := context.Background()
+	var wait time.Duration
+	for _, key := range []string{loginLockKey("ip", ip), loginLockKey("account", email), loginDelayKey(email)} {
+		ttl, err := RedisClient.PTTL(ctx, key).Result()
+		if err != nil {
+			return 0, err
+		}
+		wait = max(wait, ttl)
+	}
+	return wait, nil
+}
+
+// RecordLoginFailure menambah penghitung gagal akun dan IP, memasang jeda progresif,
+// dan mengunci akun/IP jika batas terlampaui.
+func RecordLoginFailure(email, ip string) (LoginFailure, error) {
+	ctx := context.Background()
+	window := loginFailureWindow()
+	lockout := LoginLockoutDuration()
+	var result LoginFailure
+
+	accountFails, err := incrWithin(ctx, loginFailKey("account", email), window)
+	if err != nil {
+		return result, err
+	}
+	ipFails, err := incrWithin(ctx, loginFailKey("ip", ip), window)
+	if err != nil {
+		return result, err
+	}
+
+	if accountFails >= int64(EnvUint("LOGIN_MAX_ATTEMPTS", 5)) {
+		// SetNX agar email pemberitahuan hanya dikirim sekali per penguncian
+		locked, err := RedisClient.SetNX(ctx, loginLockKey("account", email), "1", lockout).Result()
+		if err != nil {
+			return result, err
+		}
+		result.AccountLocked = locked
+		RedisClient.Del(ctx, loginFailKey("account", email))
+	} else if delayAfter := int64(EnvUint("LOGIN_DELAY_AFTER", 3)); accountFails >= delayAfter {
+		delay := min(time.Second<<(accountFails-delayAfter), maxLoginDelay)
+		if err := RedisClient.Set(ctx, loginDelayKey(email), "1", delay).Err(); err != nil {
+			return result, err
+		}
+	}
+
+	if ipFails >= int64(EnvUint("LOGIN_IP_MAX_ATTEMPTS", 20)) {
+		locked, err := RedisClient.SetNX(ctx, loginLockKey("ip", ip), "1", lockout).Result()
+		if err != nil {
+			return result, err
+		}
+		result.IPLocked = locked
+		RedisClient.Del(ctx, loginFailKey("ip", ip))
+	}
+	return result, nil
+}
+
+// ClearLoginFailures menghapus penghitung gagal akun setelah login berhasil.
+// Penghitung IP tetap berjalan agar satu akun milik penyerang tidak bisa dipakai untuk mereset batas IP.
+func ClearLoginFailures(email string) error {
+	return RedisClient.Del(context.Background(), loginFailKey("account", email), loginDelayKey(email)).Err()
+}
+
+// UnlockLogin membuka kunci akun, misalnya setelah password berhasil direset.
+func UnlockLogin(email string) error {
+	return RedisClient.Del(context.Background(),
+		loginFailKey("account", email), loginLockKey("account", email), loginDelayKey(email)).Err()
+}
+
+// incrWithin menaikkan penghitung dan memasang masa berlaku pada kenaikan pertama.
+func incrWithin(ctx context.Context, key string, window time.Duration) (int64, error) {
+	count, err := RedisClient.Incr(ctx, key).Result()
+	if err != nil {
+		return 0, err
+	}
+	if count == 1 {
+		if err := RedisClient.Expire(ctx, key, window).Err(); err != nil {
+			return count, err
+		}
+	}
+	return count, nil
+}
@@ -0,0 +1,129 @@
+package utils
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"mime"
+	"net"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/joho/godotenv"
+)
+
+// Mail adalah satu email keluar berformat teks biasa.
+type Mail struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer mengirim email keluar.
+type Mailer interface {
+	Send(mail Mail) error
+}
+
+// SMTPMailer mengirim email lewat server SMTP.
+type SMTPMailer struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	From     string
+}
+
+// Send mengirim email lewat SMTP dengan autentikasi PLAIN jika username diisi.
+func (m SMTPMailer) Send(mail Mail) error {
+	var auth smtp.Auth
+	if m.Username != "" {
+		auth = smtp.PlainAuth("", m.Username, m.Password, m.Host)
+	}
+	return smtp.SendMail(net.JoinHostPort(m.Host, m.Port), auth, m.From, []string{mail.To}, buildMessage(m.From, mail))
+}
+
+// FileMailer menulis email ke folder lokal dan mencatatnya di log, untuk development.
+type FileMailer struct {
+	Dir  string
+	From string
+}
+
+// Send menyimpan email sebagai file .eml di Dir.
+func (m FileMailer) Send(mail Mail) error {
+	log.Printf("Mail ke %s: %s\n%s", mail.To, mail.Subject, mail.Body)
+	if m.Dir == "" {
+		return nil
+	}
+	if err := os.MkdirAll(m.Dir, 0o755); err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%s-%s.eml", time.Now().Format("20060102-150405.000000"), sanitizeFileName(mail.To))
+	return os.WriteFile(filepath.Join(m.Dir, name), buildMessage(m.From, mail), 0o644)
+}
+
+// buildMessage menyusun pesan MIME sederhana dengan subject ter-encode UTF-8.
+func buildMessage(from string, mail Mail) []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", from)
+	fmt.Fprintf(&buf, "To: %s\r\n", mail.To)
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", mail.Subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	buf.WriteString(strings.ReplaceAll(mail.Body, "\n", "\r\n"))
+	return buf.Bytes()
+}
+
+func sanitizeFileName(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '@' || r == '.' || r == '-' || r == '_' || ('a' <= r && r <= 'z') || ('A' <= r && r <= 'Z') || ('0' <= r && r <= '9') {
+			return r
+		}
+		return '_'
+	}, s)
+}
+
+var (
+	mailer     Mailer
+	mailerOnce sync.Once
+)
+
+// MailerFromEnv memilih Mailer dari environment:
+//   - MAIL_DRIVER: "smtp" atau "file" (default, untuk development)
+//   - SMTP_HOST, SMTP_PORT (default 587), SMTP_USERNAME, SMTP_PASSWORD
+//   - MAIL_FROM: alamat pengirim
+//   - MAIL_DIR: folder tujuan FileMailer (kosong = hanya dicatat di log)
+func MailerFromEnv() Mailer {
+	mailerOnce.Do(func() {
+		godotenv.Load()
+		from := os.Getenv("MAIL_FROM")
+		if from == "" {
+			from = "no-reply@localhost"
+		}
+		if strings.ToLower(os.Getenv("MAIL_DRIVER")) == "smtp" {
+			port := os.Getenv("SMTP_PORT")
+			if port == "" {
+				port = "587"
+			}
+			mailer = SMTPMailer{
+				Host:     os.Getenv("SMTP_HOST"),
+				Port:     port,
+				Username: os.Getenv("SMTP_USERNAME"),
+				Password: os.Getenv("SMTP_PASSWORD"),
+				From:     from,
+			}
+			return
+		}
+		mailer = FileMailer{Dir: os.Getenv("MAIL_DIR"), From: from}
+	})
+	return mailer
+}
+
+// SendMail mengirim email dengan Mailer dari environment.
+func SendMail(mail Mail) error {
+	return MailerFromEnv().Send(mail)
+}
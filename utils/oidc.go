@@ -0,0 +1,304 @@
+package utils
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/joho/godotenv"
+)
+
+// OIDCProvider adalah satu penyedia login OpenID Connect (Google, mock issuer lokal, dll).
+// Dikonfigurasi dari environment:
+//   - OIDC_PROVIDERS: daftar nama provider, misalnya "google,mock"
+//   - OIDC_<NAMA>_ISSUER, OIDC_<NAMA>_CLIENT_ID, OIDC_<NAMA>_CLIENT_SECRET, OIDC_<NAMA>_REDIRECT_URL
+//   - OIDC_<NAMA>_SCOPES: default "openid email profile"
+type OIDCProvider struct {
+	Name         string
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+
+	mu        sync.Mutex
+	discovery *oidcDiscovery
+	keys      map[string]crypto.PublicKey
+	keysAt    time.Time
+}
+
+// oidcDiscovery adalah bagian dokumen /.well-known/openid-configuration yang dipakai.
+type oidcDiscovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// OIDCIdentity adalah data user dari ID token yang sudah diverifikasi.
+type OIDCIdentity struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+}
+
+// oidcKeysTTL adalah lama kunci publik provider di-cache sebelum diambil ulang.
+const oidcKeysTTL = time.Hour
+
+var (
+	oidcProviders     map[string]*OIDCProvider
+	oidcProvidersOnce sync.Once
+	oidcHTTPClient    = &http.Client{Timeout: 10 * time.Second}
+)
+
+// OIDCProviders mengembalikan semua provider yang dikonfigurasi.
+func OIDCProviders() map[string]*OIDCProvider {
+	oidcProvidersOnce.Do(func() {
+		godotenv.Load()
+		oidcProviders = map[string]*OIDCProvider{}
+		for _, name := range strings.Split(os.Getenv("OIDC_PROVIDERS"), ",") {
+			name = strings.ToLower(strings.TrimSpace(name))
+			if name == "" {
+				continue
+			}
+			prefix := "OIDC_" + strings.ToUpper(name) + "_"
+			scopes := strings.Fields(os.Getenv(prefix + "SCOPES"))
+			if len(scopes) == 0 {
+				scopes = []string{"openid", "email", "profile"}
+			}
+			oidcProviders[name] = &OIDCProvider{
+				Name:         name,
+				Issuer:       strings.TrimRight(os.Getenv(prefix+"ISSUER"), "/"),
+				ClientID:     os.Getenv(prefix + "CLIENT_ID"),
+				ClientSecret: os.Getenv(prefix + "CLIENT_SECRET"),
+				RedirectURL:  os.Getenv(prefix + "REDIRECT_URL"),
+				Scopes:       scopes,
+			}
+		}
+	})
+	return oidcProviders
+}
+
+// PKCEChallenge membuat code_challenge S256 dari code_verifier.
+func PKCEChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// getJSON mengambil dan membaca respons JSON.
+func getJSON(endpoint string, out interface{}) error {
+	resp, err := oidcHTTPClient.Get(endpoint)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: status %d", endpoint, resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// discover mengambil (dan meng-cache) dokumen discovery provider.
+func (p *OIDCProvider) discover() (*oidcDiscovery, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.discovery != nil {
+		return p.discovery, nil
+	}
+	var doc oidcDiscovery
+	if err := getJSON(p.Issuer+"/.well-known/openid-configuration", &doc); err != nil {
+		return nil, err
+	}
+	if strings.TrimRight(doc.Issuer, "/") != p.Issuer {
+		return nil, fmt.Errorf("issuer discovery %q tidak sama dengan %q", doc.Issuer, p.Issuer)
+	}
+	p.discovery = &doc
+	return p.discovery, nil
+}
+
+// AuthorizationURL membuat URL halaman login provider untuk authorization code flow dengan PKCE.
+func (p *OIDCProvider) AuthorizationURL(state, nonce, codeVerifier string) (string, error) {
+	doc, err := p.discover()
+	if err != nil {
+		return "", err
+	}
+	query := url.Values{}
+	query.Set("response_type", "code")
+	query.Set("client_id", p.ClientID)
+	query.Set("redirect_uri", p.RedirectURL)
+	query.Set("scope", strings.Join(p.Scopes, " "))
+	query.Set("state", state)
+	query.Set("nonce", nonce)
+	query.Set("code_challenge", PKCEChallenge(codeVerifier))
+	query.Set("code_challenge_method", "S256")
+
+	separator := "?"
+	if strings.Contains(doc.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+	return doc.AuthorizationEndpoint + separator + query.Encode(), nil
+}
+
+// Exchange menukar authorization code dengan token lalu memverifikasi ID token-nya.
+func (p *OIDCProvider) Exchange(code, codeVerifier, nonce string) (OIDCIdentity, error) {
+	doc, err := p.discover()
+	if err != nil {
+		return OIDCIdentity{}, err
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", p.RedirectURL)
+	form.Set("client_id", p.ClientID)
+	form.Set("code_verifier", codeVerifier)
+	if p.ClientSecret != "" {
+		form.Set("client_secret", p.ClientSecret)
+	}
+	resp, err := oidcHTTPClient.PostForm(doc.TokenEndpoint, form)
+	if err != nil {
+		return OIDCIdentity{}, err
+	}
+	defer resp.Body.Close()
+
+	var token struct {
+		IDToken string `json:"id_token"`
+		Error   string `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return OIDCIdentity{}, err
+	}
+	if resp.StatusCode != http.StatusOK || token.IDToken == "" {
+		return OIDCIdentity{}, fmt.Errorf("penukaran code gagal: status %d %s", resp.StatusCode, token.Error)
+	}
+	return p.verifyIDToken(token.IDToken, nonce)
+}
+
+// verifyIDToken memverifikasi tanda tangan, issuer, audience, masa berlaku dan nonce ID token.
+func (p *OIDCProvider) verifyIDToken(idToken, nonce string) (OIDCIdentity, error) {
+	token, err := jwt.Parse(idToken, p.keyFunc,
+		jwt.WithValidMethods([]string{"RS256", "ES256"}),
+		jwt.WithIssuer(p.Issuer),
+		jwt.WithAudience(p.ClientID),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		return OIDCIdentity{}, err
+	}
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid {
+		return OIDCIdentity{}, errors.New("ID token tidak valid")
+	}
+	if claims["nonce"] != nonce {
+		return OIDCIdentity{}, errors.New("nonce ID token tidak cocok")
+	}
+
+	identity := OIDCIdentity{}
+	identity.Subject, _ = claims["sub"].(string)
+	identity.Email, _ = claims["email"].(string)
+	identity.Name, _ = claims["name"].(string)
+	// Beberapa provider mengirim email_verified sebagai string
+	switch verified := claims["email_verified"].(type) {
+	case bool:
+		identity.EmailVerified = verified
+	case string:
+		identity.EmailVerified = verified == "true"
+	}
+	if identity.Subject == "" {
+		return OIDCIdentity{}, errors.New("ID token tanpa sub")
+	}
+	return identity, nil
+}
+
+// keyFunc memilih kunci publik provider berdasarkan kid. Kid yang belum dikenal memicu
+// pengambilan ulang JWKS karena provider bisa merotasi kunci kapan saja.
+func (p *OIDCProvider) keyFunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	p.mu.Lock()
+	key, ok := p.keys[kid]
+	fresh := time.Since(p.keysAt) < oidcKeysTTL
+	p.mu.Unlock()
+	if ok && fresh {
+		return key, nil
+	}
+	// Batasi pengambilan ulang agar token dengan kid palsu tidak membanjiri provider
+	if !ok && fresh && time.Since(p.keysAt) < time.Minute {
+		return nil, fmt.Errorf("kid %q tidak dikenal", kid)
+	}
+	if err := p.refreshKeys(); err != nil {
+		return nil, err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if key, ok := p.keys[kid]; ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("kid %q tidak dikenal", kid)
+}
+
+// refreshKeys mengambil ulang JWKS provider.
+func (p *OIDCProvider) refreshKeys() error {
+	doc, err := p.discover()
+	if err != nil {
+		return err
+	}
+	var set struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+			Crv string `json:"crv"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+		} `json:"keys"`
+	}
+	if err := getJSON(doc.JWKSURI, &set); err != nil {
+		return err
+	}
+
+	decode := base64.RawURLEncoding.DecodeString
+	keys := map[string]crypto.PublicKey{}
+	for _, jwk := range set.Keys {
+		switch jwk.Kty {
+		case "RSA":
+			n, errN := decode(jwk.N)
+			e, errE := decode(jwk.E)
+			if errN != nil || errE != nil {
+				continue
+			}
+			keys[jwk.Kid] = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+		case "EC":
+			if jwk.Crv != "P-256" {
+				continue
+			}
+			x, errX := decode(jwk.X)
+			y, errY := decode(jwk.Y)
+			if errX != nil || errY != nil {
+				continue
+			}
+			keys[jwk.Kid] = &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		}
+	}
+
+	p.mu.Lock()
+	p.keys = keys
+	p.keysAt = time.Now()
+	p.mu.Unlock()
+	return nil
+}
@@ -0,0 +1,138 @@
+package utils
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// Ukuran halaman A4 dalam point (1/72 inci)
+const (
+	PDFPageWidth  = 595.0
+	PDFPageHeight = 842.0
+)
+
+// helveticaWidths adalah lebar karakter ASCII 32-126 font Helvetica per 1000 unit.
+var helveticaWidths = [...]int{
+	278, 278, 355, 556, 556, 889, 667, 191, 333, 333, 389, 584, 278, 333, 278, 278,
+	556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 278, 278, 584, 584, 584, 556,
+	1015, 667, 667, 722, 722, 667, 611, 778, 722, 278, 500, 667, 556, 833, 722, 778,
+	667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 278, 278, 278, 469, 556,
+	333, 556, 556, 500, 556, 556, 278, 556, 556, 222, 222, 500, 222, 833, 556, 556,
+	556, 556, 333, 500, 278, 556, 500, 722, 500, 500, 500, 334, 260, 334, 584,
+}
+
+// PDF adalah penulis dokumen PDF sederhana: teks Helvetica dan garis di halaman A4.
+// Koordinat diukur dari pojok kiri atas halaman.
+type PDF struct {
+	pages []*bytes.Buffer
+}
+
+// NewPDF membuat dokumen PDF kosong dengan satu halaman.
+func NewPDF() *PDF {
+	pdf := &PDF{}
+	pdf.AddPage()
+	return pdf
+}
+
+// AddPage menambah halaman baru; teks dan garis berikutnya ditulis ke halaman ini.
+func (p *PDF) AddPage() {
+	p.pages = append(p.pages, &bytes.Buffer{})
+}
+
+func (p *PDF) current() *bytes.Buffer {
+	return p.pages[len(p.pages)-1]
+}
+
+// pdfText membuang karakter di luar ASCII yang bisa dicetak dan meng-escape karakter khusus PDF.
+func pdfText(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if r < 32 || r > 126 {
+			r = '?'
+		}
+		if r == '(' || r == ')' || r == '\\' {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// TextWidth menghitung lebar teks dalam point dengan metrik Helvetica biasa.
+func TextWidth(s string, size float64) float64 {
+	width := 0
+	for _, r := range s {
+		if r < 32 || r > 126 {
+			r = '?'
+		}
+		width += helveticaWidths[r-32]
+	}
+	return float64(width) * size / 1000
+}
+
+// FitText memotong teks dengan "..." agar lebarnya tidak melebihi maxWidth.
+func FitText(s string, size float64, maxWidth float64) string {
+	if TextWidth(s, size) <= maxWidth {
+		return s
+	}
+	runes := []rune(s)
+	for len(runes) > 0 && TextWidth(string(runes)+"...", size) > maxWidth {
+		runes = runes[:len(runes)-1]
+	}
+	return string(runes) + "..."
+}
+
+// Text menulis teks dengan garis dasar di (x, y).
+func (p *PDF) Text(x, y, size float64, bold bool, s string) {
+	font := "F1"
+	if bold {
+		font = "F2"
+	}
+	fmt.Fprintf(p.current(), "BT /%s %.1f Tf %.2f %.2f Td (%s) Tj ET\n", font, size, x, PDFPageHeight-y, pdfText(s))
+}
+
+// TextRight menulis teks rata kanan yang berakhir di x.
+func (p *PDF) TextRight(x, y, size float64, bold bool, s string) {
+	p.Text(x-TextWidth(s, size), y, size, bold, s)
+}
+
+// Line menggambar garis dari (x1, y1) ke (x2, y2).
+func (p *PDF) Line(x1, y1, x2, y2 float64) {
+	fmt.Fprintf(p.current(), "0.5 w %.2f %.2f m %.2f %.2f l S\n", x1, PDFPageHeight-y1, x2, PDFPageHeight-y2)
+}
+
+// Bytes menyusun seluruh halaman menjadi file PDF.
+func (p *PDF) Bytes() []byte {
+	var out bytes.Buffer
+	offsets := []int{}
+	writeObject := func(body string) {
+		offsets = append(offsets, out.Len())
+		fmt.Fprintf(&out, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+
+	out.WriteString("%PDF-1.4\n")
+	// Objek 1: katalog, 2: daftar halaman, 3-4: font, lalu pasangan halaman dan isinya
+	writeObject("<< /Type /Catalog /Pages 2 0 R >>")
+	kids := make([]string, len(p.pages))
+	for i := range p.pages {
+		kids[i] = fmt.Sprintf("%d 0 R", 5+i*2)
+	}
+	writeObject(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(p.pages)))
+	writeObject("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>")
+	writeObject("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>")
+	for i, page := range p.pages {
+		writeObject(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.0f %.0f] "+
+			"/Resources << /Font << /F1 3 0 R /F2 4 0 R >> >> /Contents %d 0 R >>",
+			PDFPageWidth, PDFPageHeight, 6+i*2))
+		writeObject(fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", page.Len(), page.String()))
+	}
+
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&out, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+	return out.Bytes()
+}
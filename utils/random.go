@@ -0,0 +1,37 @@
+package utils
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+)
+
+// RandomToken membuat string hex acak sepanjang nBytes*2 karakter.
+func RandomToken(nBytes int) (string, error) {
+	b := make([]byte, nBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// codeAlphabet tidak memuat karakter yang mirip (0/O, 1/I/L) agar mudah dibacakan lewat telepon.
+const codeAlphabet = "23456789ABCDEFGHJKMNPQRSTUVWXYZ"
+
+// RandomCode membuat kode acak sepanjang n karakter dari codeAlphabet.
+func RandomCode(n int) (string, error) {
+	// Byte di atas kelipatan terbesar panjang alfabet dibuang agar tiap karakter berpeluang sama
+	limit := 256 - 256%len(codeAlphabet)
+	code := make([]byte, 0, n)
+	buf := make([]byte, n)
+	for len(code) < n {
+		if _, err := rand.Read(buf); err != nil {
+			return "", err
+		}
+		for _, b := range buf {
+			if int(b) < limit && len(code) < n {
+				code = append(code, codeAlphabet[int(b)%len(codeAlphabet)])
+			}
+		}
+	}
+	return string(code), nil
+}
@@ -0,0 +1,35 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// AllowRequest menghitung request untuk key dalam jendela waktu tetap di Redis.
+// Mengembalikan false beserta sisa waktu tunggu jika batas sudah terlampaui.
+func AllowRequest(key string, limit uint, window time.Duration) (bool, time.Duration, error) {
+	ctx := context.Background()
+	redisKey := fmt.Sprintf("ratelimit:%s", key)
+
+	count, err := RedisClient.Incr(ctx, redisKey).Result()
+	if err != nil {
+		return true, 0, err
+	}
+	if count == 1 {
+		if err := RedisClient.Expire(ctx, redisKey, window).Err(); err != nil {
+			return true, 0, err
+		}
+	}
+	if uint(count) <= limit {
+		return true, 0, nil
+	}
+
+	ttl, err := RedisClient.TTL(ctx, redisKey).Result()
+	if err != nil || ttl < 0 {
+		// Key tanpa masa berlaku (misalnya Expire gagal sebelumnya) dipasang ulang agar tidak terkunci selamanya
+		RedisClient.Expire(ctx, redisKey, window)
+		ttl = window
+	}
+	return false, ttl, nil
+}
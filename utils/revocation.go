@@ -0,0 +1,79 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// legacyTokenTTL adalah masa berlaku token lama (sebelum ada sesi) yang masih mungkin beredar.
+const legacyTokenTTL = 24 * time.Hour
+
+func revokedSessionKey(sessionID uint) string {
+	return fmt.Sprintf("revoked:session:%d", sessionID)
+}
+
+func revokedUserKey(userID uint) string {
+	return fmt.Sprintf("revoked:user:%d", userID)
+}
+
+func roleVersionKey(userID uint) string {
+	return fmt.Sprintf("role_version:user:%d", userID)
+}
+
+// RevokeSession memasukkan sesi ke daftar pencabutan sampai token aksesnya pasti kedaluwarsa.
+func RevokeSession(sessionID uint) error {
+	return RedisClient.Set(context.Background(), revokedSessionKey(sessionID), "1", AccessTokenTTL()).Err()
+}
+
+// RevokeUserTokens mencabut token lama (tanpa sesi) milik user yang dibuat sebelum saat ini.
+// Token bersesi dicabut per sesi lewat RevokeSession.
+func RevokeUserTokens(userID uint) error {
+	ttl := max(AccessTokenTTL(), legacyTokenTTL)
+	return RedisClient.Set(context.Background(), revokedUserKey(userID), time.Now().Unix(), ttl).Err()
+}
+
+// IsTokenRevoked mengecek token akses terhadap daftar pencabutan di Redis.
+func IsTokenRevoked(claims AccessClaims) (bool, error) {
+	ctx := context.Background()
+	if claims.SessionID != 0 {
+		exists, err := RedisClient.Exists(ctx, revokedSessionKey(claims.SessionID)).Result()
+		if err != nil {
+			return false, err
+		}
+		return exists > 0, nil
+	}
+
+	revokedBefore, err := RedisClient.Get(ctx, revokedUserKey(claims.UserID)).Result()
+	if err == redis.Nil {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	unix, _ := strconv.ParseInt(revokedBefore, 10, 64)
+	// Token lama yang dibuat pada detik yang sama dengan pencabutan ikut dicabut
+	return claims.IssuedAt.Unix() <= unix, nil
+}
+
+// SetRoleVersion mencatat versi role terbaru user. Token dengan versi lebih lama ditolak
+// sampai klien memperbarui token, sehingga perubahan role langsung berlaku.
+func SetRoleVersion(userID uint, version uint) error {
+	return RedisClient.Set(context.Background(), roleVersionKey(userID), version, AccessTokenTTL()).Err()
+}
+
+// IsRoleVersionStale mengecek apakah role di token sudah berubah sejak token dibuat.
+func IsRoleVersionStale(userID uint, version uint) (bool, error) {
+	current, err := RedisClient.Get(context.Background(), roleVersionKey(userID)).Result()
+	if err == redis.Nil {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	latest, _ := strconv.ParseUint(current, 10, 64)
+	return uint64(version) < latest, nil
+}
@@ -1,64 +1,265 @@
 package utils
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"os"
 	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
-	"github.com/joho/godotenv"
 )
 
-// GenerateToken membuat token JWT baru untuk user tertentu
-func GenerateToken(userId uint) (string, error) {
-	godotenv.Load()
-	secret := os.Getenv("JWT_SECRET")
+// TokenAccess adalah role dan permission user yang dibawa token akses,
+// agar middleware tidak perlu membaca database di setiap request.
+type TokenAccess struct {
+	Roles       []string
+	Permissions []string
+	Version     uint // versi role user saat token dibuat
+	TwoFactor   bool // sesi sudah lolos verifikasi 2FA
+	// ImpersonatorID adalah admin yang masuk sebagai user ini, 0 jika bukan impersonasi
+	ImpersonatorID uint
+}
+
+// AccessClaims adalah isi token akses yang sudah diverifikasi.
+type AccessClaims struct {
+	UserID    uint
+	SessionID uint // 0 untuk token lama yang dibuat sebelum ada sesi
+	IssuedAt  time.Time
+	Access    *TokenAccess // nil untuk token lama tanpa claim role
+}
+
+// tokenTypeAccess adalah claim typ token akses. Token lain yang ditandatangani kunci yang sama
+// (token aksi, token keranjang tamu) membawa typ berbeda dan tidak boleh dipakai sebagai token akses.
+const tokenTypeAccess = "access"
+
+// AccessTokenTTL adalah masa berlaku token akses (ACCESS_TOKEN_TTL_MINUTES, default 15 menit).
+func AccessTokenTTL() time.Duration {
+	return time.Duration(EnvUint("ACCESS_TOKEN_TTL_MINUTES", 15)) * time.Minute
+}
 
+// GenerateToken membuat token akses JWT berumur pendek untuk sesi login user tertentu,
+// ditandatangani dengan kunci aktif (lihat jwtKeySet)
+func GenerateToken(userId uint, sessionId uint, access TokenAccess) (string, error) {
+	keys, err := currentJWTKeys()
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
 	claims := jwt.MapClaims{
+		"typ":     tokenTypeAccess,
 		"user_id": userId,
-		"exp":     time.Now().Add(24 * time.Hour).Unix(),
+		"sid":     sessionId,
+		"roles":   access.Roles,
+		"perms":   access.Permissions,
+		"rv":      access.Version,
+		"mfa":     access.TwoFactor,
+		"imp":     access.ImpersonatorID,
+		"iat":     now.Unix(),
+		"exp":     now.Add(AccessTokenTTL()).Unix(),
+	}
+	if issuer := os.Getenv("JWT_ISSUER"); issuer != "" {
+		claims["iss"] = issuer
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenString, err := token.SignedString([]byte(secret))
+	return keys.sign(claims)
+}
+
+// ReverseToken memverifikasi token akses dan mengembalikan isinya
+func ReverseToken(tokenStr string) (AccessClaims, error) {
+	keys, err := currentJWTKeys()
+	if err != nil {
+		return AccessClaims{}, err
+	}
+
+	if tokenStr == "" {
+		return AccessClaims{}, errors.New("token tidak boleh kosong")
+	}
+
+	tokenStr = strings.TrimPrefix(tokenStr, "Bearer ")
+
+	token, err := jwt.Parse(tokenStr, keys.keyFunc, jwt.WithValidMethods([]string{"HS256", "RS256", "EdDSA"}))
+	if err != nil {
+		return AccessClaims{}, err
+	}
+
+	if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
+		// Token akses lama tidak punya typ, token bertipe lain ditolak
+		if typ, exists := claims["typ"]; exists && typ != tokenTypeAccess {
+			return AccessClaims{}, errors.New("bukan token akses")
+		}
+		userIDFloat, ok := claims["user_id"].(float64)
+		if !ok {
+			return AccessClaims{}, errors.New("user_id tidak valid di token")
+		}
+		result := AccessClaims{UserID: uint(userIDFloat)}
+		if sid, ok := claims["sid"].(float64); ok {
+			result.SessionID = uint(sid)
+		}
+		if iat, ok := claims["iat"].(float64); ok {
+			result.IssuedAt = time.Unix(int64(iat), 0)
+		}
+		if perms, ok := claims["perms"].([]interface{}); ok {
+			access := &TokenAccess{
+				Roles:       claimStrings(claims["roles"]),
+				Permissions: claimStrings(perms),
+			}
+			if version, ok := claims["rv"].(float64); ok {
+				access.Version = uint(version)
+			}
+			access.TwoFactor, _ = claims["mfa"].(bool)
+			if impersonator, ok := claims["imp"].(float64); ok {
+				access.ImpersonatorID = uint(impersonator)
+			}
+			result.Access = access
+		}
+		return result, nil
+	}
+
+	return AccessClaims{}, errors.New("token tidak valid")
+}
+
+// claimStrings mengubah claim array JSON menjadi []string.
+func claimStrings(value interface{}) []string {
+	list, _ := value.([]interface{})
+	result := make([]string, 0, len(list))
+	for _, item := range list {
+		if s, ok := item.(string); ok {
+			result = append(result, s)
+		}
+	}
+	return result
+}
+
+// HashToken menghasilkan hash SHA-256 dari token acak (refresh token) untuk disimpan di database.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// GenerateCartToken membuat token bertanda tangan untuk keranjang tamu (guest cart)
+func GenerateCartToken(cartID uint) (string, error) {
+	keys, err := currentJWTKeys()
 	if err != nil {
 		return "", err
 	}
 
-	return tokenString, nil
+	claims := jwt.MapClaims{
+		"cart_id": cartID,
+		"typ":     "guest_cart",
+		"exp":     time.Now().Add(30 * 24 * time.Hour).Unix(),
+	}
+
+	// Token keranjang hanya dibaca server ini sehingga tetap memakai HS256
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return token.SignedString(keys.secret)
 }
 
-// ReverseToken memverifikasi token dan mengembalikan user_id
-func ReverseToken(tokenStr string) (uint, error) {
-	godotenv.Load()
-	secret := os.Getenv("JWT_SECRET")
+// ReverseCartToken memverifikasi token keranjang tamu dan mengembalikan cart_id
+func ReverseCartToken(tokenStr string) (uint, error) {
+	keys, err := currentJWTKeys()
+	if err != nil {
+		return 0, err
+	}
 
 	if tokenStr == "" {
-		return 0, errors.New("token tidak boleh kosong")
+		return 0, errors.New("token keranjang tidak boleh kosong")
 	}
 
-	tokenStr = strings.TrimPrefix(tokenStr, "Bearer ")
-
 	token, err := jwt.Parse(tokenStr, func(token *jwt.Token) (interface{}, error) {
-
 		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
 			return nil, jwt.ErrSignatureInvalid
 		}
-		return []byte(secret), nil
+		return keys.secret, nil
 	})
+	if err != nil {
+		return 0, err
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid || claims["typ"] != "guest_cart" {
+		return 0, errors.New("token keranjang tidak valid")
+	}
+	cartIDFloat, ok := claims["cart_id"].(float64)
+	if !ok {
+		return 0, errors.New("cart_id tidak valid di token")
+	}
+	return uint(cartIDFloat), nil
+}
+
+// Tujuan token aksi. Token satu tujuan tidak bisa dipakai untuk tujuan lain.
+const (
+	PurposeVerifyEmail    = "verify_email"
+	PurposeResetPassword  = "reset_password"
+	PurposeTwoFactorLogin = "two_factor_login"
+)
+
+// actionTokenAudience membedakan token aksi dari token akses dan token keranjang tamu.
+const actionTokenAudience = "action"
+
+// GenerateActionToken membuat token bertanda tangan berumur pendek untuk satu aksi
+// (tautan verifikasi email, reset password, langkah kedua login 2FA).
+// bind adalah nilai yang harus sama saat token dipakai (misalnya email atau hash password saat ini),
+// sehingga token otomatis tidak berlaku setelah nilai tersebut berubah.
+func GenerateActionToken(purpose string, userID uint, bind string, ttl time.Duration) (string, error) {
+	keys, err := currentJWTKeys()
+	if err != nil {
+		return "", err
+	}
+
+	claims := jwt.MapClaims{
+		"user_id": userID,
+		"typ":     purpose,
+		"aud":     actionTokenAudience,
+		"bind":    HashToken(bind)[:16],
+		"exp":     time.Now().Add(ttl).Unix(),
+	}
+
+	// Token aksi hanya dibaca server ini sehingga tetap memakai HS256
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return token.SignedString(keys.actionSecret())
+}
 
+// ReverseActionToken memverifikasi token aksi untuk tujuan tertentu dan mengembalikan user_id.
+// bind harus bernilai sama dengan saat token dibuat.
+func ReverseActionToken(tokenStr string, purpose string, bind func(userID uint) (string, error)) (uint, error) {
+	keys, err := currentJWTKeys()
 	if err != nil {
 		return 0, err
 	}
 
-	if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
-		userIDFloat, ok := claims["user_id"].(float64)
-		if !ok {
-			return 0, errors.New("user_id tidak valid di token")
+	if tokenStr == "" {
+		return 0, errors.New("token tidak boleh kosong")
+	}
+
+	token, err := jwt.Parse(tokenStr, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, jwt.ErrSignatureInvalid
 		}
-		return uint(userIDFloat), nil
+		return keys.actionSecret(), nil
+	}, jwt.WithAudience(actionTokenAudience))
+	if err != nil {
+		return 0, err
 	}
 
-	return 0, errors.New("token tidak valid")
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid || claims["typ"] != purpose {
+		return 0, errors.New("token tidak valid")
+	}
+	userIDFloat, ok := claims["user_id"].(float64)
+	if !ok {
+		return 0, errors.New("user_id tidak valid di token")
+	}
+	userID := uint(userIDFloat)
+
+	current, err := bind(userID)
+	if err != nil {
+		return 0, err
+	}
+	if claims["bind"] != HashToken(current)[:16] {
+		return 0, errors.New("token sudah tidak berlaku")
+	}
+	return userID, nil
 }